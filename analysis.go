@@ -0,0 +1,111 @@
+package gorule
+
+import (
+	"fmt"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// FindingKind classifies a Finding of Engine.Analyze.
+type FindingKind string
+
+const (
+	// FindingUnsatisfiable is a rule whose condition is contradictory, so it never matches.
+	FindingUnsatisfiable FindingKind = "unsatisfiable"
+	// FindingEquivalent are two rules matching exactly the same facts.
+	FindingEquivalent FindingKind = "equivalent"
+	// FindingSubsumed is a rule, the first one, which only matches facts the second one matches as well.
+	FindingSubsumed FindingKind = "subsumed"
+	// FindingOverlap are two rules comparing a variable in common and matching some facts in common.
+	FindingOverlap FindingKind = "overlap"
+	// FindingGap are facts no row of a decision table matches, see DecisionTable.Validate.
+	FindingGap FindingKind = "gap"
+)
+
+// Finding is a problem found by Engine.Analyze. Witness holds example facts both rules match,
+// or no rule matches for gaps, and is nil for unsatisfiable rules.
+type Finding struct {
+	Kind    FindingKind            `json:"kind"`
+	Rules   []string               `json:"rules"`
+	Message string                 `json:"message"`
+	Witness map[string]interface{} `json:"witness,omitempty"`
+}
+
+// AnalysisReport holds the findings of Engine.Analyze and the rules which could not be analyzed,
+// mapped to the reason.
+type AnalysisReport struct {
+	Findings []Finding         `json:"findings"`
+	Skipped  map[string]string `json:"skipped,omitempty"`
+}
+
+// Analyze compares the conditions of the rules of the engine pairwise and reports rules which never match,
+// match the same facts as another rule or whose matches overlap with another rule.
+// Only conditions comparing numeric, bool and enumerated (string) variables with literals can be analyzed,
+// see parser.Analyzer; other rules are skipped.
+func (e *Engine) Analyze() AnalysisReport {
+	return AnalyzeRules(e.Rules())
+}
+
+// AnalyzeRules works like Engine.Analyze for rules not added to an engine.
+// The rules are analyzed in the order given, which determines the order of the findings.
+func AnalyzeRules(rules []*Rule) AnalysisReport {
+	report := AnalysisReport{Findings: make([]Finding, 0), Skipped: map[string]string{}}
+
+	type analyzedRule struct {
+		name      string
+		condition *parser.AnalyzedCondition
+	}
+
+	analyzer := parser.NewAnalyzer()
+	var analyzed []analyzedRule
+	for _, r := range rules {
+		c, err := analyzer.Add(r.condition)
+		if err != nil {
+			report.Skipped[r.Name()] = err.Error()
+			continue
+		}
+		if _, ok := c.Satisfiable(); !ok {
+			report.Findings = append(report.Findings, Finding{
+				Kind:    FindingUnsatisfiable,
+				Rules:   []string{r.Name()},
+				Message: fmt.Sprintf("rule %s never matches, as its condition is contradictory", r.Name()),
+			})
+			continue
+		}
+		analyzed = append(analyzed, analyzedRule{name: r.Name(), condition: c})
+	}
+
+	for i, a := range analyzed {
+		for _, b := range analyzed[i+1:] {
+			witness, ok := a.condition.Overlaps(b.condition)
+			if !ok {
+				continue
+			}
+
+			finding := Finding{Kind: FindingOverlap, Rules: []string{a.name, b.name}, Witness: witness}
+			aImpliesB, _, errA := a.condition.Implies(b.condition)
+			bImpliesA, _, errB := b.condition.Implies(a.condition)
+			switch {
+			case errA != nil || errB != nil || !aImpliesB && !bImpliesA:
+				// rules on distinct variables always overlap, which is not worth reporting
+				if !a.condition.SharesVariables(b.condition) {
+					continue
+				}
+				finding.Message = fmt.Sprintf("rules %s and %s match some facts in common", a.name, b.name)
+			case aImpliesB && bImpliesA:
+				finding.Kind = FindingEquivalent
+				finding.Message = fmt.Sprintf("rules %s and %s match exactly the same facts", a.name, b.name)
+			case aImpliesB:
+				finding.Kind = FindingSubsumed
+				finding.Message = fmt.Sprintf("rule %s only matches facts rule %s matches as well", a.name, b.name)
+			case bImpliesA:
+				finding.Kind = FindingSubsumed
+				finding.Rules = []string{b.name, a.name}
+				finding.Message = fmt.Sprintf("rule %s only matches facts rule %s matches as well", b.name, a.name)
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,85 @@
+package gorule
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func TestEngine_Analyze(t *testing.T) {
+	engine := NewEngine(WithLogger(log.New(io.Discard, "", log.LstdFlags)))
+	for _, r := range []*Rule{
+		NewRule("a gold", `tier == "gold" && amount >= 100`, nil),
+		NewRule("b gold eu", `tier == "gold" && amount > 200 && region == "eu"`, nil),
+		NewRule("c silver", `tier == "silver" && amount in 100..<500`, nil),
+		NewRule("d big", `amount >= 400`, nil),
+		NewRule("e never", `amount > 10 && amount < 5`, nil),
+		NewRule("f gold copy", `!(tier != "gold") && 100 <= amount`, nil),
+		NewRule("g custom", `len(tier) > 3`, nil),
+		NewRule("h eu", `region == "eu"`, nil),
+		NewRule("i vip", `vip`, nil),
+	} {
+		if err := engine.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := engine.Analyze()
+
+	want := []struct {
+		kind  FindingKind
+		rules []string
+	}{
+		{FindingUnsatisfiable, []string{"e never"}},
+		{FindingSubsumed, []string{"b gold eu", "a gold"}},
+		{FindingOverlap, []string{"a gold", "d big"}},
+		{FindingEquivalent, []string{"a gold", "f gold copy"}},
+		{FindingOverlap, []string{"b gold eu", "d big"}},
+		{FindingSubsumed, []string{"b gold eu", "f gold copy"}},
+		{FindingSubsumed, []string{"b gold eu", "h eu"}},
+		// rules on distinct variables like d big and h eu, or i vip and any other rule, are no overlap
+		{FindingOverlap, []string{"c silver", "d big"}},
+		{FindingOverlap, []string{"d big", "f gold copy"}},
+	}
+	if len(report.Findings) != len(want) {
+		t.Fatalf("Analyze() = %+v, want %d findings", report.Findings, len(want))
+	}
+	for i, f := range report.Findings {
+		if f.Kind != want[i].kind || !reflect.DeepEqual(f.Rules, want[i].rules) {
+			t.Errorf("Analyze() finding %d = %s %v, want %s %v", i, f.Kind, f.Rules, want[i].kind, want[i].rules)
+		}
+		if f.Kind == FindingUnsatisfiable {
+			continue
+		}
+		// the witness has to match both rules
+		for _, name := range f.Rules {
+			res, err := parser.Evaluate(ruleByName(engine, name).Condition(), f.Witness, nil)
+			if err != nil || res != true {
+				t.Errorf("witness %v of finding %d does not match rule %s: %v, %v", f.Witness, i, name, res, err)
+			}
+		}
+	}
+
+	if msg := report.Findings[2].Message; msg != "rules a gold and d big match some facts in common" {
+		t.Errorf("Analyze() overlap message = %q", msg)
+	}
+	if msg := report.Findings[3].Message; msg != "rules a gold and f gold copy match exactly the same facts" {
+		t.Errorf("Analyze() equivalent message = %q", msg)
+	}
+
+	if _, ok := report.Skipped["g custom"]; !ok || len(report.Skipped) != 1 {
+		t.Errorf("Analyze() skipped = %v, want g custom", report.Skipped)
+	}
+}
+
+func ruleByName(e *Engine, name string) *Rule {
+	for _, r := range e.Rules() {
+		if r.Name() == name {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func runAnalyze(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("analyze", "[-json] rule-file", stderr)
+	asJSON := fs.Bool("json", false, "print the report as JSON object")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path := fs.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+	defer f.Close()
+
+	rules, err := gorule.LoadRules(f)
+	if err != nil {
+		return fail(fmt.Errorf("%s: %w", path, err), *asJSON, stdout, stderr)
+	}
+
+	report := gorule.AnalyzeRules(rules)
+	if *asJSON {
+		writeJSON(stdout, report)
+	} else {
+		writeReport(stdout, report)
+	}
+	if len(report.Findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// writeReport prints a finding per line, followed by the parts skipped.
+func writeReport(w io.Writer, report gorule.AnalysisReport) {
+	for _, finding := range report.Findings {
+		fmt.Fprintf(w, "%s: %s", finding.Kind, finding.Message)
+		if finding.Witness != nil {
+			fmt.Fprintf(w, ", e.g. %s", parser.FormatValue(finding.Witness))
+		}
+		fmt.Fprintln(w)
+	}
+
+	skipped := make([]string, 0, len(report.Skipped))
+	for name := range report.Skipped {
+		skipped = append(skipped, name)
+	}
+	sort.Strings(skipped)
+	for _, name := range skipped {
+		fmt.Fprintf(w, "skipped: %s: %s\n", name, report.Skipped[name])
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func runEval(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("eval", "[-facts file] [-json] expression", stderr)
+	factsPath := fs.String("facts", "", "JSON file with the variables, - for stdin")
+	asJSON := fs.Bool("json", false, "print the result as JSON object")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	expr, ok := expression(fs)
+	if !ok {
+		return 2
+	}
+
+	facts, err := readFacts(*factsPath, stdin)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	result, err := parser.Evaluate(expr, facts, nil)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	if *asJSON {
+		writeJSON(stdout, map[string]interface{}{"result": result})
+	} else {
+		fmt.Fprintln(stdout, parser.FormatValue(result))
+	}
+	return 0
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func runExplain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("explain", "[-facts file] [-json] expression", stderr)
+	factsPath := fs.String("facts", "", "JSON file with the variables, - for stdin")
+	asJSON := fs.Bool("json", false, "print the explanation as JSON object")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	expr, ok := expression(fs)
+	if !ok {
+		return 2
+	}
+
+	facts, err := readFacts(*factsPath, stdin)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	explanation, err := parser.Explain(expr, facts, nil)
+	if explanation == nil {
+		// the expression could not be parsed
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	if *asJSON {
+		writeJSON(stdout, explanation)
+	} else {
+		fmt.Fprint(stdout, explanation)
+	}
+	if err != nil {
+		if !*asJSON {
+			fmt.Fprintf(stderr, "gorule: %v\n", err)
+		}
+		return 1
+	}
+	return 0
+}
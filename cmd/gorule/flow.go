@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func runFlow(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("flow", "[-facts file] [-json] flow-file", stderr)
+	factsPath := fs.String("facts", "-", "JSON file with the variables, - for stdin")
+	asJSON := fs.Bool("json", false, "print the path taken as JSON object")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	flow, err := gorule.NewFlowFromFile(fs.Arg(0), gorule.WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	facts, err := readFacts(*factsPath, stdin)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	result, err := flow.Run(facts, nil)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	if *asJSON {
+		writeJSON(stdout, result)
+		return 0
+	}
+	for _, stage := range result.Path {
+		matched := make([]string, 0, len(stage.Matched))
+		for _, name := range stage.Matched {
+			if res := stage.Results[name]; res != nil {
+				name += " => " + parser.FormatValue(res)
+			}
+			matched = append(matched, name)
+		}
+		fmt.Fprintf(stdout, "%s: %s\n", stage.Stage, strings.Join(matched, ", "))
+	}
+	return 0
+}
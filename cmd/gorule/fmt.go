@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("fmt", "[-s] [-check | -w] [rule-file...]", stderr)
+	simplify := fs.Bool("s", false, "simplify the expressions, e.g. fold constants")
+	check := fs.Bool("check", false, "only list the files which are not formatted")
+	write := fs.Bool("w", false, "write the result to the files instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *check && *write {
+		fs.Usage()
+		return 2
+	}
+
+	format := parser.Format
+	if *simplify {
+		format = parser.Simplify
+	}
+
+	if fs.NArg() == 0 {
+		return fmtExpression(stdin, stdout, stderr, format, *check)
+	}
+
+	code := 0
+	for _, path := range fs.Args() {
+		original, formatted, err := fmtFile(path, format)
+		if err != nil {
+			fmt.Fprintf(stderr, "gorule: %v\n", err)
+			code = 1
+			continue
+		}
+
+		switch {
+		case *check:
+			if !bytes.Equal(original, formatted) {
+				fmt.Fprintln(stdout, path)
+				code = 1
+			}
+		case *write:
+			if !bytes.Equal(original, formatted) {
+				if err := os.WriteFile(path, formatted, 0o644); err != nil {
+					fmt.Fprintf(stderr, "gorule: %v\n", err)
+					code = 1
+				}
+			}
+		default:
+			_, _ = stdout.Write(formatted)
+		}
+	}
+	return code
+}
+
+// fmtExpression formats a single expression read from stdin.
+func fmtExpression(stdin io.Reader, stdout, stderr io.Writer, format func(string) (string, error), check bool) int {
+	src, err := io.ReadAll(stdin)
+	if err != nil {
+		return fail(err, false, stdout, stderr)
+	}
+	expr := strings.TrimSpace(string(src))
+
+	formatted, err := format(expr)
+	if err != nil {
+		return fail(err, false, stdout, stderr)
+	}
+
+	if check {
+		if formatted != expr {
+			fmt.Fprintln(stdout, "<stdin>")
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintln(stdout, formatted)
+	return 0
+}
+
+// fmtFile formats the conditions and actions of the rule file and returns its original and formatted content.
+// The formatted file is indented with two spaces.
+func fmtFile(path string, format func(string) (string, error)) (original, formatted []byte, err error) {
+	original, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := gorule.DecodeRuleFile(bytes.NewReader(original))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range file.Rules {
+		def := &file.Rules[i]
+		if def.Condition, err = format(def.Condition); err != nil {
+			return nil, nil, fmt.Errorf("%s: rule %q: condition: %w", path, def.Name, err)
+		}
+		if def.Action == "" {
+			continue
+		}
+		if def.Action, err = format(def.Action); err != nil {
+			return nil, nil, fmt.Errorf("%s: rule %q: action: %w", path, def.Name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // keep operators like && readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(file); err != nil {
+		return nil, nil, err
+	}
+	return original, buf.Bytes(), nil
+}
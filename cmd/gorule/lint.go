@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// problem is an error or warning found in a rule file.
+type problem struct {
+	File     string `json:"file"`
+	Rule     string `json:"rule,omitempty"`
+	Field    string `json:"field,omitempty"` // "condition" or "action"
+	Pos      int    `json:"pos,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (p problem) String() string {
+	s := p.File
+	if p.Rule != "" {
+		s += fmt.Sprintf(": rule %q", p.Rule)
+	}
+	if p.Field != "" {
+		s += ": " + p.Field
+	}
+	s += fmt.Sprintf(": %s: %s", p.Severity, p.Message)
+	if p.Pos > 0 {
+		s += fmt.Sprintf(" at position %d", p.Pos)
+	}
+	return s
+}
+
+func runLint(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("lint", "[-facts file] [-json] rule-file...", stderr)
+	factsPath := fs.String("facts", "", "JSON file with sample variables whose types are checked against")
+	asJSON := fs.Bool("json", false, "print the problems as JSON array")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var facts map[string]interface{}
+	if *factsPath != "" {
+		var err error
+		if facts, err = readFacts(*factsPath, stdin); err != nil {
+			return fail(err, *asJSON, stdout, stderr)
+		}
+	}
+
+	problems := make([]problem, 0)
+	for _, path := range fs.Args() {
+		problems = append(problems, lintFile(path, facts)...)
+	}
+
+	if *asJSON {
+		writeJSON(stdout, problems)
+	} else {
+		for _, p := range problems {
+			fmt.Fprintln(stdout, p)
+		}
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func lintFile(path string, facts map[string]interface{}) []problem {
+	f, err := os.Open(path)
+	if err != nil {
+		return []problem{{File: path, Severity: "error", Message: err.Error()}}
+	}
+	defer f.Close()
+
+	file, err := gorule.DecodeRuleFile(f)
+	if err != nil {
+		return []problem{{File: path, Severity: "error", Message: err.Error()}}
+	}
+
+	var problems []problem
+	seen := map[string]bool{}
+	for _, def := range file.Rules {
+		if seen[def.Name] {
+			problems = append(problems, problem{File: path, Rule: def.Name, Severity: "error", Message: gorule.ErrRuleExists.Error()})
+		}
+		seen[def.Name] = true
+
+		warnings, err := parser.CheckCondition(def.Condition, facts)
+		problems = append(problems, checkProblems(path, def.Name, "condition", warnings, err)...)
+
+		if def.Action != "" {
+			warnings, err = parser.Check(def.Action, facts)
+			problems = append(problems, checkProblems(path, def.Name, "action", warnings, err)...)
+		}
+	}
+	return problems
+}
+
+func checkProblems(path, rule, field string, warnings []parser.Warning, err error) []problem {
+	if err != nil {
+		return []problem{{File: path, Rule: rule, Field: field, Severity: "error", Message: err.Error()}}
+	}
+
+	problems := make([]problem, 0, len(warnings))
+	for _, w := range warnings {
+		problems = append(problems, problem{File: path, Rule: rule, Field: field, Pos: w.Pos, Severity: "warning", Message: w.Message})
+	}
+	return problems
+}
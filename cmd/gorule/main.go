@@ -0,0 +1,137 @@
+// Command gorule evaluates, checks and matches rule expressions from the command line.
+//
+// Usage:
+//
+//	gorule eval [-facts file] [-json] expression
+//	gorule lint [-json] rule-file...
+//	gorule match -rules rule-file [-facts file] [-tags tag,...] [-shadow rule-file] [-json]
+//	gorule explain [-facts file] [-json] expression
+//	gorule repl [-facts file] [-history file]
+//	gorule fmt [-check | -w] [rule-file...]
+//	gorule test [-rules rule-file] [-json] [-v] [-cover format [-coverout file]] test-file...
+//	gorule analyze [-json] rule-file
+//	gorule table [-policy hit-policy] [-facts file | -validate] [-json] table-file
+//	gorule flow [-facts file] [-json] flow-file
+//	gorule serve -rules rule-file [-addr address] [-grpc address] [-max-body bytes] [-timeout duration]
+//
+// Facts are read as a JSON object from the given file, or from stdin if the file is "-".
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spikewong/gorule"
+)
+
+const usage = `usage: gorule <command> [arguments]
+
+commands:
+  eval      evaluate an expression against facts
+  lint      check rule files for syntax and type errors
+  match     print the rules of a rule file matching the facts
+  explain   show how each part of an expression was evaluated
+  repl      evaluate expressions interactively
+  fmt       format the expressions of rule files
+  test      run the test cases of rule files
+  analyze   find rules which never match or overlap with each other
+  table     evaluate or validate a decision table
+  flow      run a rule flow and print the stages along the path taken
+  serve     serve the rules of a rule file over HTTP and gRPC
+
+Run "gorule <command> -h" for the arguments of a command.
+`
+
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+var commands = map[string]command{
+	"eval":    runEval,
+	"lint":    runLint,
+	"match":   runMatch,
+	"explain": runExplain,
+	"repl":    runRepl,
+	"fmt":     runFmt,
+	"test":    runTest,
+	"analyze": runAnalyze,
+	"table":   runTable,
+	"flow":    runFlow,
+	"serve":   runServe,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command given by args and returns the exit code:
+// 0 on success, 1 if the command failed or found problems and 2 on invalid usage.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "gorule: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+
+	return cmd(args[1:], stdin, stdout, stderr)
+}
+
+func newFlagSet(name, arguments string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: gorule %s %s\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// readFacts reads the facts from the file, or from stdin if path is "-". Without a path, there are no facts.
+func readFacts(path string, stdin io.Reader) (map[string]interface{}, error) {
+	if path == "" {
+		return map[string]interface{}{}, nil
+	}
+	if path == "-" {
+		return gorule.DecodeFacts(stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return gorule.DecodeFacts(f)
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// fail reports the error, as a JSON object if asJSON is set, and returns the exit code 1.
+func fail(err error, asJSON bool, stdout, stderr io.Writer) int {
+	if asJSON {
+		writeJSON(stdout, map[string]string{"error": err.Error()})
+	} else {
+		fmt.Fprintf(stderr, "gorule: %v\n", err)
+	}
+	return 1
+}
+
+// expression joins the remaining arguments, so the expression does not need to be quoted as a whole.
+func expression(fs *flag.FlagSet) (string, bool) {
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return "", false
+	}
+	return strings.Join(fs.Args(), " "), true
+}
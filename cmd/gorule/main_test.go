@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runCommand(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun_Usage(t *testing.T) {
+	code, _, stderr := runCommand("")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "usage: gorule <command>")
+
+	code, _, stderr = runCommand("", "unknown")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "unknown"`)
+
+	code, _, stderr = runCommand("", "eval")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "usage: gorule eval")
+}
+
+func TestEval(t *testing.T) {
+	code, stdout, _ := runCommand("", "eval", "-facts", "testdata/vip.json", "vipLevel", "*", "2")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "20\n", stdout)
+
+	code, stdout, _ = runCommand(`{"name": "gorule", "ratio": 0.5}`, "eval", "-facts", "-", "-json", `{"n": name, "r": ratio}`)
+	assert.Equal(t, 0, code)
+	assert.JSONEq(t, `{"result": {"n": "gorule", "r": 0.5}}`, stdout)
+
+	code, _, stderr := runCommand("", "eval", "1 +")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "gorule: syntax error: unexpected $end\n", stderr)
+
+	code, stdout, _ = runCommand("", "eval", "-json", "unknown")
+	assert.Equal(t, 1, code)
+	assert.JSONEq(t, `{"error": "var error: variable \"unknown\" does not exist"}`, stdout)
+
+	code, _, stderr = runCommand("{", "eval", "-facts", "-", "1")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "cannot decode facts")
+}
+
+func TestLint(t *testing.T) {
+	code, stdout, _ := runCommand("", "lint", "testdata/discount.json")
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stdout)
+
+	code, stdout, _ = runCommand("", "lint", "testdata/invalid.json")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, `testdata/invalid.json: rule "syntax": condition: error: syntax error: unexpected $end
+testdata/invalid.json: rule "types": action: warning: type error: cannot subtract type string and number at position 1
+testdata/invalid.json: rule "types": error: rule name already exists
+testdata/invalid.json: rule "types": condition: warning: condition is always true at position 1
+`, stdout)
+
+	// the sample facts reveal the type of the condition
+	code, stdout, _ = runCommand("", "lint", "-facts", "testdata/vip.json", "-json", "testdata/invalid.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, `"message": "type error: condition must result in bool, but was number"`)
+
+	code, stdout, _ = runCommand("", "lint", "testdata/vip.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, `testdata/vip.json: error: invalid rule file`)
+}
+
+func TestMatch(t *testing.T) {
+	code, stdout, _ := runCommand(`{"vipLevel": 10, "balance": 100, "inBlacklist": false}`, "match", "-rules", "testdata/discount.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "rich\nvip  => 30\n", stdout)
+
+	code, stdout, _ = runCommand(`{"vipLevel": 10, "balance": 100, "inBlacklist": false}`, "match", "-rules", "testdata/discount.json", "-tags", "discount,segment:rich")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "rich\n", stdout)
+
+	code, stdout, _ = runCommand("", "match", "-rules", "testdata/discount.json", "-facts", "testdata/vip.json", "-json")
+	assert.Equal(t, 0, code)
+	assert.JSONEq(t, `[{"name": "rich", "result": null}, {"name": "vip", "result": 30}]`, stdout)
+
+	code, _, stderr := runCommand(`{}`, "match", "-rules", "testdata/discount.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "does not exist")
+
+	code, _, stderr = runCommand("", "match", "-rules", "testdata/invalid.json", "-facts", "testdata/vip.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "rule name already exists")
+
+	code, _, _ = runCommand("", "match")
+	assert.Equal(t, 2, code)
+}
+
+func TestMatch_Shadow(t *testing.T) {
+	code, stdout, stderr := runCommand(`{"vipLevel": 10, "balance": 100, "inBlacklist": false}`, "match", "-rules", "testdata/discount.json", "-shadow", "testdata/candidate.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "rich\nvip  => 30\n", stdout)
+	assert.JSONEq(t, `{
+		"facts": {"vipLevel": 10, "balance": 100, "inBlacklist": false},
+		"liveVersion": 1, "candidateVersion": 1,
+		"onlyLive": ["rich"], "onlyCandidate": ["loyal"],
+		"results": [{"rule": "vip", "live": 30, "candidate": 25}]
+	}`, stderr)
+
+	code, _, stderr = runCommand(`{"vipLevel": 1, "balance": 10, "inBlacklist": true}`, "match", "-rules", "testdata/discount.json", "-shadow", "testdata/candidate.json")
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stderr)
+}
+
+func TestExplain(t *testing.T) {
+	code, stdout, _ := runCommand("", "explain", "-facts", "testdata/vip.json", "vipLevel > 5 && !inBlacklist")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `vipLevel > 5 && !inBlacklist  => true
+├── vipLevel > 5  => true
+│   └── vipLevel  => 10
+└── !inBlacklist  => true
+    └── inBlacklist  => false
+`, stdout)
+
+	code, stdout, _ = runCommand("", "explain", "-json", "1 + x")
+	assert.Equal(t, 1, code)
+	assert.JSONEq(t, `{"expr": "1 + x", "pos": 1, "value": null, "error": "var error: variable \"x\" does not exist",
+		"children": [{"expr": "x", "pos": 5, "value": null, "error": "var error: variable \"x\" does not exist"}]}`, stdout)
+
+	code, _, stderr := runCommand("", "explain", "(")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "syntax error")
+}
+
+func TestTest(t *testing.T) {
+	code, stdout, _ := runCommand("", "test", "-v", "testdata/discount_test.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `PASS  vip gets 30 percent
+PASS  blacklisted vip
+PASS  missing facts
+ok    testdata/discount_test.json: 3 passed, 0 failed, 3/3 rules matched (100%)
+`, stdout)
+
+	code, stdout, _ = runCommand("", "test", "testdata/discount_test.json", "testdata/failing_test.json")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, `ok    testdata/discount_test.json: 3 passed, 0 failed, 3/3 rules matched (100%)
+FAIL  blacklisted vip
+      matched rules differ (- expected, + actual):
+        + blacklist
+        - vip
+      result of "blacklist": expected 1, but was 0
+      result of "vip": expected 15, but the rule did not match
+FAIL  testdata/failing_test.json: 1 passed, 1 failed, 1/3 rules matched (33%)
+      never matched: rich, vip
+`, stdout)
+
+	code, stdout, _ = runCommand("", "test", "-json", "testdata/failing_test.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, `"coverage": {
+      "blacklist": 1,
+      "rich": 0,
+      "vip": 0
+    }`)
+
+	code, stdout, _ = runCommand("", "test", "testdata/discount.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "ERROR testdata/discount.json: cannot decode test suite")
+
+	code, stdout, _ = runCommand("", "test", "-rules", "testdata/invalid.json", "testdata/discount_test.json")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "ERROR testdata/discount_test.json: testdata/invalid.json: rule name already exists: types\n", stdout)
+}
+
+func TestTest_Cover(t *testing.T) {
+	// without errors, as Match stops at the first failing rule
+	code, stdout, _ := runCommand("", "test", "-cover", "text", "testdata/failing_test.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, `never matched: rich, vip
+
+rule                           evaluations  matches  errors  sub-expressions         outcomes
+blacklist                                2        1       0       1/1 (100%)       2/2 (100%)
+rich                                     2        0       0       2/2 (100%)        1/2 (50%)
+vip                                      2        0       0       5/5 (100%)        7/8 (88%)
+
+rich:
+  never true:      balance >= 100
+
+vip:
+  never true:      vipLevel > 5 && !inBlacklist
+`)
+
+	path := filepath.Join(t.TempDir(), "coverage.html")
+	code, stdout, _ = runCommand("", "test", "-cover", "html", "-coverout", path, "testdata/discount_test.json")
+	assert.Equal(t, 0, code)
+	assert.NotContains(t, stdout, "<html>")
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<h2 id="vip">vip</h2>`)
+
+	code, _, stderr := runCommand("", "test", "-cover", "xml", "testdata/discount_test.json")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown coverage format "xml"`)
+}
+
+func TestFmt(t *testing.T) {
+	formatted := `{
+  "rules": [
+    {
+      "name": "vip",
+      "condition": "vipLevel > 5 && !inBlacklist",
+      "action": "balance * \"0.3\""
+    },
+    {
+      "name": "rich",
+      "condition": "balance >= 100"
+    }
+  ]
+}
+`
+	code, stdout, _ := runCommand("", "fmt", "testdata/unformatted.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, formatted, stdout)
+
+	code, stdout, _ = runCommand("", "fmt", "-check", "testdata/unformatted.json", "testdata/discount.json")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "testdata/unformatted.json\ntestdata/discount.json\n", stdout)
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	content, _ := os.ReadFile("testdata/unformatted.json")
+	assert.NoError(t, os.WriteFile(path, content, 0o644))
+
+	code, stdout, _ = runCommand("", "fmt", "-w", path)
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stdout)
+	content, _ = os.ReadFile(path)
+	assert.Equal(t, formatted, string(content))
+
+	code, stdout, _ = runCommand("", "fmt", "-check", path)
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stdout)
+
+	code, _, stderr := runCommand("", "fmt", "testdata/invalid.json")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "gorule: testdata/invalid.json: rule \"syntax\": condition: syntax error: unexpected $end\n", stderr)
+}
+
+func TestFmt_Expression(t *testing.T) {
+	code, stdout, _ := runCommand("a&&(b||c)\n", "fmt")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "a && (b || c)\n", stdout)
+
+	code, stdout, _ = runCommand("true && x > 1 + 1", "fmt", "-s")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "x > 2\n", stdout)
+
+	code, stdout, _ = runCommand("a&&b", "fmt", "-check")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "<stdin>\n", stdout)
+
+	code, _, _ = runCommand("a && b\n", "fmt", "-check")
+	assert.Equal(t, 0, code)
+
+	code, _, _ = runCommand("", "fmt", "-check", "-w")
+	assert.Equal(t, 2, code)
+}
+
+func TestAnalyze(t *testing.T) {
+	code, stdout, _ := runCommand("", "analyze", "testdata/overlapping.json")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, `unsatisfiable: rule never never matches, as its condition is contradictory
+subsumed: rule gold eu only matches facts rule gold matches as well, e.g. {"amount":201,"region":"eu","tier":"gold"}
+skipped: custom: condition cannot be analyzed: unsupported expression at position 1
+`, stdout)
+
+	code, stdout, _ = runCommand("", "analyze", "-json", "testdata/overlapping.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, `"kind": "subsumed"`)
+
+	code, _, _ = runCommand("", "analyze")
+	assert.Equal(t, 2, code)
+}
+
+func TestTable(t *testing.T) {
+	code, stdout, _ := runCommand(`{"tier": "gold", "amount": 150}`, "table", "testdata/discount.csv")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "gold  => {\"discount\":0.1}\n", stdout)
+
+	code, stdout, _ = runCommand(`{"age": 20, "member": true}`, "table", "-json", "testdata/points.json")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, `"points": 15`)
+
+	code, stdout, _ = runCommand(`{"age": 20, "member": true}`, "table", "testdata/points.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "adult, member  => {\"points\":15}\n", stdout)
+
+	code, _, stderr := runCommand(`{"tier": "gold"}`, "table", "testdata/discount.csv")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, `variable "amount" does not exist`)
+
+	code, stdout, _ = runCommand("", "table", "-validate", "testdata/discount.csv")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "gap: no row matches some inputs, e.g. {\"amount\":100,\"tier\":\"other\"}\n", stdout)
+
+	code, _, stderr = runCommand("", "table", "-policy", "any", "testdata/discount.csv")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, `unknown hit policy "any"`)
+
+	code, _, _ = runCommand("", "table")
+	assert.Equal(t, 2, code)
+}
+
+func TestFlow(t *testing.T) {
+	code, stdout, _ := runCommand(`{"age": 30, "inBlacklist": false, "vipLevel": 6, "amount": 1000}`, "flow", "testdata/flow.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "eligibility: adult\npricing: bulk => 100, vip => 300\nlimits: cap => 500\n", stdout)
+
+	code, stdout, _ = runCommand(`{"age": 16, "inBlacklist": false}`, "flow", "-json", "testdata/flow.json")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, `"stage": "eligibility"`)
+	assert.NotContains(t, stdout, `"stage": "pricing"`)
+
+	code, _, stderr := runCommand(`{"age": 30, "inBlacklist": false}`, "flow", "testdata/flow.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "stage pricing")
+
+	code, _, _ = runCommand("", "flow")
+	assert.Equal(t, 2, code)
+}
+
+func TestServe(t *testing.T) {
+	code, _, stderr := runCommand("", "serve")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "usage: gorule serve")
+
+	code, _, stderr = runCommand("", "serve", "-rules", "testdata/invalid.json")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "rule name already exists")
+
+	code, _, stderr = runCommand("", "serve", "-rules", "testdata/discount.json", "-addr", "invalid address")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "invalid address")
+
+	code, _, stderr = runCommand("", "serve", "-rules", "testdata/discount.json", "-grpc", "invalid address")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "invalid address")
+}
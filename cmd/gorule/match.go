@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// matchResult is a matched rule along with the result of its action.
+type matchResult struct {
+	Name   string      `json:"name"`
+	Result interface{} `json:"result"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func runMatch(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("match", "-rules rule-file [-facts file] [-tags tag,...] [-shadow rule-file] [-json]", stderr)
+	rulesPath := fs.String("rules", "", "JSON rule file")
+	factsPath := fs.String("facts", "-", "JSON file with the variables, - for stdin")
+	tags := fs.String("tags", "", "comma-separated tags the rules matched have to carry")
+	shadowPath := fs.String("shadow", "", "JSON rule file evaluated in shadow, whose differences are written to stderr as JSON lines")
+	asJSON := fs.Bool("json", false, "print the matched rules as JSON array")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *rulesPath == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := []gorule.Option{gorule.WithLogger(log.New(io.Discard, "", 0))}
+	if *shadowPath != "" {
+		candidate, err := gorule.NewEngineFromFile(*shadowPath, gorule.WithLogger(log.New(io.Discard, "", 0)))
+		if err != nil {
+			return fail(err, *asJSON, stdout, stderr)
+		}
+		// the actions of rule files are expressions without side effects
+		opts = append(opts, gorule.WithShadow(candidate, gorule.NewJSONShadowSink(stderr), gorule.CompareActionResults()))
+	}
+	engine, err := gorule.NewEngineFromFile(*rulesPath, opts...)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	facts, err := readFacts(*factsPath, stdin)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	var matchOpts []gorule.MatchOption
+	if *tags != "" {
+		matchOpts = append(matchOpts, gorule.OnlyTags(strings.Split(*tags, ",")...))
+	}
+	rules, err := engine.Match(facts, nil, matchOpts...)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name() < rules[j].Name() })
+
+	results := make([]matchResult, 0, len(rules))
+	failed := false
+	for _, rule := range rules {
+		res := matchResult{Name: rule.Name()}
+		if res.Result, err = rule.Execute(facts); err != nil {
+			res.Error = err.Error()
+			failed = true
+		}
+		results = append(results, res)
+	}
+
+	if *asJSON {
+		writeJSON(stdout, results)
+	} else {
+		for _, res := range results {
+			switch {
+			case res.Error != "":
+				fmt.Fprintf(stdout, "%s  ! %s\n", res.Name, res.Error)
+			case res.Result != nil:
+				fmt.Fprintf(stdout, "%s  => %s\n", res.Name, parser.FormatValue(res.Result))
+			default:
+				fmt.Fprintln(stdout, res.Name)
+			}
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+const replHelp = `Enter an expression to evaluate it. Incomplete expressions continue on the next line.
+
+commands:
+  :load file     add the variables of a JSON file to the session
+  :vars          list the variables of the session
+  :clear         remove all variables
+  :explain expr  show how each part of an expression is evaluated
+  :history       list the previous inputs
+  :help          show this help
+  :quit          leave the session
+`
+
+// repl is an interactive session evaluating expressions against a set of variables.
+type repl struct {
+	vars    map[string]interface{}
+	history []string
+	out     io.Writer
+
+	historyFile io.Writer // receives each input if not nil
+}
+
+func runRepl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repl", "[-facts file] [-history file]", stderr)
+	factsPath := fs.String("facts", "", "JSON file with the initial variables")
+	historyPath := fs.String("history", "", "file to keep the inputs in across sessions")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	r := &repl{vars: map[string]interface{}{}, out: stdout}
+	if *factsPath != "" {
+		if err := r.load(*factsPath); err != nil {
+			return fail(err, false, stdout, stderr)
+		}
+	}
+	if *historyPath != "" {
+		f, err := r.openHistory(*historyPath)
+		if err != nil {
+			return fail(err, false, stdout, stderr)
+		}
+		defer f.Close()
+		r.historyFile = f
+	}
+
+	r.run(stdin)
+	return 0
+}
+
+func (r *repl) run(stdin io.Reader) {
+	scanner := bufio.NewScanner(stdin)
+	var input string
+
+	for {
+		if input == "" {
+			fmt.Fprint(r.out, "> ")
+		} else {
+			fmt.Fprint(r.out, "... ")
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(r.out)
+			if input != "" {
+				r.eval(input)
+			}
+			return
+		}
+		line := scanner.Text()
+
+		switch {
+		case input == "" && strings.TrimSpace(line) == "":
+			continue
+		case input == "" && strings.HasPrefix(strings.TrimSpace(line), ":"):
+			r.remember(strings.TrimSpace(line))
+			if !r.command(strings.TrimSpace(line)) {
+				return
+			}
+			continue
+		case input != "" && strings.TrimSpace(line) == "":
+			// an empty line ends the input even if it is incomplete
+		default:
+			if input != "" {
+				input += "\n"
+			}
+			input += line
+			if incomplete(input) {
+				continue
+			}
+		}
+
+		r.remember(input)
+		r.eval(input)
+		input = ""
+	}
+}
+
+// incomplete reports whether the input ends before the expression is complete, e.g. after a binary operator.
+func incomplete(input string) bool {
+	_, err := parser.Check(input, nil)
+	var syntaxErr *parser.Error
+	return errors.As(err, &syntaxErr) && syntaxErr.Pos > len(input)
+}
+
+// command executes a command and returns false if the session ends.
+func (r *repl) command(line string) bool {
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	switch name {
+	case ":quit", ":q":
+		return false
+	case ":help":
+		fmt.Fprint(r.out, replHelp)
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(r.out, "usage: :load file")
+		} else if err := r.load(arg); err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+		}
+	case ":vars":
+		r.printVars()
+	case ":clear":
+		r.vars = map[string]interface{}{}
+	case ":explain":
+		if arg == "" {
+			fmt.Fprintln(r.out, "usage: :explain expr")
+		} else {
+			r.explain(arg)
+		}
+	case ":history":
+		for i, entry := range r.history[:len(r.history)-1] {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, strings.ReplaceAll(entry, "\n", "\n      "))
+		}
+	default:
+		fmt.Fprintf(r.out, "unknown command %q, see :help\n", name)
+	}
+	return true
+}
+
+func (r *repl) eval(input string) {
+	result, err := parser.Evaluate(input, r.vars, nil)
+	if err != nil {
+		r.printError(input, err)
+		return
+	}
+	fmt.Fprintf(r.out, "%s : %s\n", parser.FormatValue(result), parser.TypeOf(result))
+}
+
+func (r *repl) explain(input string) {
+	explanation, err := parser.Explain(input, r.vars, nil)
+	if explanation != nil {
+		fmt.Fprint(r.out, explanation)
+	}
+	if err != nil {
+		r.printError(input, err)
+	}
+}
+
+func (r *repl) load(path string) error {
+	facts, err := readFacts(path, nil)
+	if err != nil {
+		return err
+	}
+	for name, val := range facts {
+		r.vars[name] = val
+	}
+	fmt.Fprintf(r.out, "loaded %d variables from %s\n", len(facts), path)
+	return nil
+}
+
+func (r *repl) printVars() {
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		val := r.vars[name]
+		fmt.Fprintf(r.out, "%s = %s : %s\n", name, parser.FormatValue(val), parser.TypeOf(val))
+	}
+}
+
+// printError prints the error, preceded by the line of the input it refers to with carets below the offending part.
+func (r *repl) printError(input string, err error) {
+	pos, length := r.locate(input, err)
+	if pos > 0 {
+		lineStart := strings.LastIndex(input[:pos-1], "\n") + 1
+		lineEnd := strings.IndexByte(input[lineStart:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(input)
+		} else {
+			lineEnd += lineStart
+		}
+		line := input[lineStart:lineEnd]
+
+		// keep tabs, so the carets line up with the input
+		indent := strings.Map(func(c rune) rune {
+			if c == '\t' {
+				return c
+			}
+			return ' '
+		}, input[lineStart:pos-1])
+		if width := utf8.RuneCountInString(line) - utf8.RuneCountInString(indent); length > width {
+			length = width
+		}
+		if length < 1 {
+			length = 1
+		}
+
+		fmt.Fprintln(r.out, line)
+		fmt.Fprintln(r.out, indent+strings.Repeat("^", length))
+	}
+	fmt.Fprintf(r.out, "error: %v\n", err)
+}
+
+// locate returns the position and length of the part of the input causing the error, or 0 if it is unknown.
+func (r *repl) locate(input string, err error) (pos, length int) {
+	var syntaxErr *parser.Error
+	if errors.As(err, &syntaxErr) {
+		if syntaxErr.Pos > len(input) {
+			return len(input) + 1, 1
+		}
+		return syntaxErr.Pos, 1
+	}
+
+	// The innermost sub-expression which failed is the cause of the error.
+	explanation, _ := parser.Explain(input, r.vars, nil)
+	if explanation == nil || explanation.Error == "" {
+		return 0, 0
+	}
+	for {
+		var failed *parser.Explanation
+		for _, child := range explanation.Children {
+			if child.Error != "" {
+				failed = child
+			}
+		}
+		if failed == nil {
+			return explanation.Pos, utf8.RuneCountInString(explanation.Expr)
+		}
+		explanation = failed
+	}
+}
+
+func (r *repl) remember(entry string) {
+	r.history = append(r.history, entry)
+	if r.historyFile != nil {
+		fmt.Fprintln(r.historyFile, strings.ReplaceAll(entry, "\n", " "))
+	}
+}
+
+// openHistory reads the inputs of previous sessions and opens the file to append the new ones.
+func (r *repl) openHistory(path string) (*os.File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			r.history = append(r.history, line)
+		}
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepl(t *testing.T) {
+	input := `:load testdata/vip.json
+:vars
+vipLevel * 2
+"a" + str
+`
+	code, stdout, _ := runCommand(input, "repl")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `> loaded 3 variables from testdata/vip.json
+> balance = 100 : number
+inBlacklist = false : bool
+vipLevel = 10 : number
+> 20 : number
+> "a" + str
+      ^^^
+error: var error: variable "str" does not exist
+> 
+`, stdout)
+}
+
+func TestRepl_MultiLine(t *testing.T) {
+	input := `vipLevel > 5 &&
+  balance >= 100
+
+[1,
+
+2
+`
+	code, stdout, _ := runCommand(input, "repl", "-facts", "testdata/vip.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `loaded 3 variables from testdata/vip.json
+> ... true : bool
+> > ... [1,
+   ^
+error: syntax error: unexpected $end
+> 2 : number
+> 
+`, stdout)
+}
+
+func TestRepl_Errors(t *testing.T) {
+	input := "1 + )\n" +
+		"vipLevel +\n  (\"a\" - 1)\n" +
+		"\t[1, 2] < 3\n" +
+		":explain 1 + x\n" +
+		":unknown\n" +
+		":quit\n" +
+		"1\n"
+	code, stdout, _ := runCommand(input, "repl", "-facts", "testdata/vip.json")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `loaded 3 variables from testdata/vip.json
+> 1 + )
+    ^
+error: syntax error: unexpected ')'
+> ...   ("a" - 1)
+  ^^^^^^^^^
+error: type error: cannot subtract type string and number
+> 	[1, 2] < 3
+	^^^^^^^^^^
+error: type error: cannot compare type array and number
+> 1 + x  ! var error: variable "x" does not exist
+└── x  ! var error: variable "x" does not exist
+1 + x
+    ^
+error: var error: variable "x" does not exist
+> unknown command ":unknown", see :help
+> `, stdout)
+}
+
+func TestRepl_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	assert.NoError(t, os.WriteFile(path, []byte("1 + 1\n"), 0o600))
+
+	code, stdout, _ := runCommand("2 *\n3\n:history\n", "repl", "-history", path)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `> ... 6 : number
+>    1  1 + 1
+   2  2 *
+      3
+> 
+`, stdout)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "1 + 1\n2 * 3\n:history\n", string(content))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/ruletest"
+)
+
+// suiteReport is the outcome of a test suite file.
+type suiteReport struct {
+	File string `json:"file"`
+	*gorule.TestReport
+	Error string `json:"error,omitempty"`
+}
+
+func runTest(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("test", "[-rules rule-file] [-json] [-v] [-cover format [-coverout file]] test-file...", stderr)
+	rulesPath := fs.String("rules", "", "JSON rule file, instead of the one referenced by each test file")
+	asJSON := fs.Bool("json", false, "print the results as JSON array")
+	verbose := fs.Bool("v", false, "also list the test cases which passed")
+	coverFormat := fs.String("cover", "", "report the coverage of the rules as text, json or html")
+	coverPath := fs.String("coverout", "", "file to write the coverage report to instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || (*coverFormat == "" && *coverPath != "") {
+		fs.Usage()
+		return 2
+	}
+
+	coverage := gorule.NewCoverage()
+	var writeCoverage func(io.Writer) error
+	switch *coverFormat {
+	case "":
+	case "text":
+		writeCoverage = coverage.WriteText
+	case "json":
+		writeCoverage = coverage.WriteJSON
+	case "html":
+		writeCoverage = coverage.WriteHTML
+	default:
+		fmt.Fprintf(stderr, "gorule: unknown coverage format %q\n", *coverFormat)
+		return 2
+	}
+
+	reports := make([]suiteReport, 0, fs.NArg())
+	passed := true
+	for _, path := range fs.Args() {
+		report := runSuite(path, *rulesPath, coverage)
+		if report.Error != "" || !report.Passed() {
+			passed = false
+		}
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		writeJSON(stdout, reports)
+	} else {
+		for _, report := range reports {
+			printSuiteReport(stdout, report, *verbose)
+		}
+	}
+
+	if writeCoverage != nil {
+		if err := writeCoverageReport(*coverPath, stdout, writeCoverage); err != nil {
+			return fail(err, false, stdout, stderr)
+		}
+	}
+	if !passed {
+		return 1
+	}
+	return 0
+}
+
+func writeCoverageReport(path string, stdout io.Writer, write func(io.Writer) error) error {
+	if path == "" {
+		fmt.Fprintln(stdout)
+		return write(stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runSuite(path, rulesPath string, coverage *gorule.Coverage) suiteReport {
+	report := suiteReport{File: path, TestReport: &gorule.TestReport{}}
+
+	suite, err := ruletest.LoadSuite(path) // the error refers to path already
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	if rulesPath == "" {
+		if suite.Rules == "" {
+			report.Error = path + ": the test file does not reference a rule file, use -rules"
+			return report
+		}
+		rulesPath = filepath.Join(filepath.Dir(path), suite.Rules)
+	}
+	engine, err := gorule.NewEngineFromFile(rulesPath,
+		gorule.WithLogger(log.New(io.Discard, "", 0)), gorule.WithCoverage(coverage))
+	if err != nil {
+		report.Error = fmt.Sprintf("%s: %v", path, err)
+		return report
+	}
+
+	report.TestReport = engine.RunTests(suite, nil)
+	return report
+}
+
+func printSuiteReport(w io.Writer, report suiteReport, verbose bool) {
+	if report.Error != "" {
+		fmt.Fprintf(w, "ERROR %s\n", report.Error)
+		return
+	}
+
+	failed := 0
+	for _, res := range report.Results {
+		if res.Passed() {
+			if verbose {
+				fmt.Fprintf(w, "PASS  %s\n", res.Name)
+			}
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL  %s\n", res.Name)
+		for _, failure := range res.Failures {
+			fmt.Fprintf(w, "      %s\n", strings.ReplaceAll(failure, "\n", "\n        "))
+		}
+	}
+
+	status := "ok"
+	if failed > 0 {
+		status = "FAIL"
+	}
+	fmt.Fprintf(w, "%-4s  %s: %d passed, %d failed, %d/%d rules matched (%.0f%%)\n", status, report.File,
+		len(report.Results)-failed, failed,
+		len(report.Coverage)-len(report.Uncovered()), len(report.Coverage), report.CoverageRatio()*100)
+	if uncovered := report.Uncovered(); len(uncovered) > 0 {
+		fmt.Fprintf(w, "      never matched: %s\n", strings.Join(uncovered, ", "))
+	}
+}
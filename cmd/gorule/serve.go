@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/rulegrpc"
+	"github.com/spikewong/gorule/rulegrpc/rulepb"
+	"github.com/spikewong/gorule/rulehttp"
+)
+
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("serve", "-rules rule-file [-addr address] [-grpc address] [-max-body bytes] [-timeout duration]", stderr)
+	rulesPath := fs.String("rules", "", "JSON rule file, reloaded by POST /v1/reload")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	grpcAddr := fs.String("grpc", "", "address to serve gRPC on as well, e.g. :9090")
+	maxBody := fs.Int64("max-body", rulehttp.DefaultMaxBodySize, "size limit of requests in bytes")
+	timeout := fs.Duration("timeout", rulehttp.DefaultTimeout, "time limit of requests")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *rulesPath == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	logger := log.New(stderr, "", log.LstdFlags)
+	metrics := gorule.NewPrometheusMetrics()
+	engine, err := gorule.NewEngineFromFile(*rulesPath, gorule.WithLogger(logger), gorule.WithMetrics(metrics))
+	if err != nil {
+		return fail(err, false, stdout, stderr)
+	}
+	reload := func(ctx context.Context) (int, error) {
+		f, err := os.Open(*rulesPath)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+
+		file, err := gorule.DecodeRuleFile(f)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", *rulesPath, err)
+		}
+		// the experiments are reloaded as well, as the variant rules of the file are rejected without them
+		return engine.ReloadFile(file)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", rulehttp.NewHandler(engine, rulehttp.WithMaxBodySize(*maxBody), rulehttp.WithTimeout(*timeout), rulehttp.WithReload(reload)))
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          logger,
+	}
+
+	var grpcServer *grpc.Server
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return fail(err, false, stdout, stderr)
+		}
+		grpcServer = grpc.NewServer()
+		defer grpcServer.Stop()
+		rulepb.RegisterRuleServiceServer(grpcServer, rulegrpc.NewServer(engine))
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				logger.Printf("gRPC: %v", err)
+			}
+		}()
+		logger.Printf("serving %s over gRPC on %s", *rulesPath, *grpcAddr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+	}()
+
+	logger.Printf("serving %s on %s", *rulesPath, *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fail(err, false, stdout, stderr)
+	}
+	return 0
+}
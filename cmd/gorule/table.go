@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func runTable(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := newFlagSet("table", "[-policy hit-policy] [-facts file | -validate] [-json] table-file", stderr)
+	policy := fs.String("policy", string(gorule.HitUnique), "hit policy of CSV tables, e.g. first or \"collect sum\"")
+	factsPath := fs.String("facts", "-", "JSON file with the inputs, - for stdin")
+	validate := fs.Bool("validate", false, "report gaps and overlaps between the rows instead of evaluating the table")
+	asJSON := fs.Bool("json", false, "print the result as JSON object")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	table, err := loadTable(fs.Arg(0), gorule.HitPolicy(*policy))
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	if *validate {
+		report := table.Validate()
+		if *asJSON {
+			writeJSON(stdout, report)
+		} else {
+			writeReport(stdout, report)
+		}
+		if len(report.Findings) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	facts, err := readFacts(*factsPath, stdin)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+	decision, err := table.Evaluate(facts, nil)
+	if err != nil {
+		return fail(err, *asJSON, stdout, stderr)
+	}
+
+	if *asJSON {
+		writeJSON(stdout, decision)
+		return 0
+	}
+	if len(decision.Outputs) == 1 && len(decision.Rows) > 1 { // aggregated
+		fmt.Fprintf(stdout, "%s  => %s\n", strings.Join(decision.Rows, ", "), parser.FormatValue(decision.Output()))
+		return 0
+	}
+	for i, outputs := range decision.Outputs {
+		fmt.Fprintf(stdout, "%s  => %s\n", decision.Rows[i], parser.FormatValue(outputs))
+	}
+	return 0
+}
+
+// loadTable reads a decision table from a JSON file, or from a CSV file with the hit policy given,
+// which is named after the file.
+func loadTable(path string, policy gorule.HitPolicy) (*gorule.DecisionTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var table *gorule.DecisionTable
+	if ext := filepath.Ext(path); strings.EqualFold(ext, ".csv") {
+		table, err = gorule.DecodeDecisionTableCSV(f, strings.TrimSuffix(filepath.Base(path), ext), policy)
+	} else {
+		table, err = gorule.DecodeDecisionTable(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, nil
+}
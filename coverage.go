@@ -0,0 +1,309 @@
+package gorule
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// Coverage records how the rules of an engine were evaluated across calls of Match,
+// down to the sub-expressions of their conditions. It is safe for concurrent use.
+type Coverage struct {
+	mu    sync.Mutex
+	rules map[string]*RuleCoverage
+}
+
+// RuleCoverage holds the counts of a rule. Nodes is nil if the condition cannot be parsed.
+type RuleCoverage struct {
+	Name        string         `json:"name"`
+	Condition   string         `json:"condition"`
+	Evaluations int            `json:"evaluations"`
+	Matches     int            `json:"matches"`
+	Errors      int            `json:"errors"`
+	Nodes       []NodeCoverage `json:"nodes,omitempty"` // sub-expressions of the condition, outer ones before inner ones
+	Stats       CoverageStats  `json:"stats"`
+
+	expr *parser.Coverage
+}
+
+// NodeCoverage holds the counts of a sub-expression of a condition, located by the positions of its first character
+// and of the character following it, both counting from 1. Literals are omitted unless they make up the whole
+// condition. Conditions are the whole condition, the operands of `&&`, `||` and `!` and the conditions of `?:`,
+// which are fully covered once they resulted in both true and false.
+//
+// `&&`, `||` and `?:` evaluate all their operands, so every sub-expression is evaluated whenever the condition is.
+// The counts therefore tell which outcomes each condition had, but not which branch of a `?:` was taken
+// or which operands short-circuiting would have skipped.
+type NodeCoverage struct {
+	Expr      string `json:"expr"`
+	Pos       int    `json:"pos"`
+	End       int    `json:"end"`
+	Condition bool   `json:"condition"`
+	Hits      int    `json:"hits"`
+	True      int    `json:"true"`
+	False     int    `json:"false"`
+	Errors    int    `json:"errors"`
+}
+
+// Covered reports whether the sub-expression was evaluated and, for conditions, resulted in both true and false.
+func (nc NodeCoverage) Covered() bool {
+	if nc.Condition {
+		return nc.True > 0 && nc.False > 0
+	}
+	return nc.Hits > 0
+}
+
+// CoverageStats summarizes the counts of the sub-expressions of a condition.
+type CoverageStats struct {
+	Nodes       int `json:"nodes"`       // number of sub-expressions
+	NodesHit    int `json:"nodesHit"`    // number of sub-expressions evaluated at least once
+	Outcomes    int `json:"outcomes"`    // number of possible outcomes of conditions, i.e. two per condition
+	OutcomesHit int `json:"outcomesHit"` // number of outcomes of conditions seen at least once
+}
+
+// NewCoverage creates an empty coverage to be passed to WithCoverage.
+func NewCoverage() *Coverage {
+	return &Coverage{rules: make(map[string]*RuleCoverage)}
+}
+
+// WithCoverage records the coverage of the rules of engine.
+func WithCoverage(c *Coverage) Option {
+	return func(e *Engine) {
+		e.coverage = c
+	}
+}
+
+// add registers the rule, so it is reported even if it is never evaluated.
+func (c *Coverage) add(r *Rule) *RuleCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rc, ok := c.rules[r.Name()]
+	if !ok || rc.Condition != r.condition {
+		rc = &RuleCoverage{Name: r.Name(), Condition: r.condition}
+		rc.expr, _ = parser.NewCoverage(r.condition)
+		c.rules[r.Name()] = rc
+	}
+	return rc
+}
+
+// evaluate evaluates the condition of the rule like parser.Evaluate and records it.
+func (c *Coverage) evaluate(
+	r *Rule,
+	vars map[string]interface{},
+	functions map[string]parser.ExpressionFunction,
+) (interface{}, error) {
+	rc := c.add(r)
+
+	var res interface{}
+	var err error
+	if rc.expr != nil {
+		res, err = rc.expr.Evaluate(vars, functions)
+	} else {
+		res, err = parser.Evaluate(r.condition, vars, functions)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rc.Evaluations++
+	if err != nil {
+		rc.Errors++
+	} else if matched, _ := res.(bool); matched {
+		rc.Matches++
+	}
+	return res, err
+}
+
+// Rules returns the counts of the rules ordered by name.
+func (c *Coverage) Rules() []RuleCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rules := make([]RuleCoverage, 0, len(c.rules))
+	for _, rc := range c.rules {
+		rule := *rc
+		if rc.expr != nil {
+			rule.Nodes, rule.Stats = coverageNodes(rc.expr)
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+
+	return rules
+}
+
+// Reset sets all counts to zero.
+func (c *Coverage) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, rc := range c.rules {
+		rc.Evaluations, rc.Matches, rc.Errors = 0, 0, 0
+		if rc.expr != nil {
+			rc.expr.Reset()
+		}
+	}
+}
+
+// WriteText writes a table with the counts of each rule, followed by the parts of the conditions not fully covered.
+func (c *Coverage) WriteText(w io.Writer) error {
+	rules := c.Rules()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-30s %11s %8s %7s %16s %16s\n", "rule", "evaluations", "matches", "errors", "sub-expressions", "outcomes")
+	for _, rc := range rules {
+		fmt.Fprintf(&sb, "%-30s %11d %8d %7d %16s %16s\n", rc.Name, rc.Evaluations, rc.Matches, rc.Errors,
+			ratio(rc.Stats.NodesHit, rc.Stats.Nodes), ratio(rc.Stats.OutcomesHit, rc.Stats.Outcomes))
+	}
+
+	for _, rc := range rules {
+		var missing []string
+		for _, nc := range rc.Nodes {
+			switch {
+			case nc.Hits == 0:
+				missing = append(missing, "never evaluated: "+nc.Expr)
+			case nc.Condition && nc.True == 0:
+				missing = append(missing, "never true:      "+nc.Expr)
+			case nc.Condition && nc.False == 0:
+				missing = append(missing, "never false:     "+nc.Expr)
+			}
+		}
+		if len(missing) > 0 {
+			fmt.Fprintf(&sb, "\n%s:\n  %s\n", rc.Name, strings.Join(missing, "\n  "))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// WriteJSON writes the counts of each rule and the sub-expressions of its condition as JSON array.
+func (c *Coverage) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c.Rules())
+}
+
+// WriteHTML writes a page showing the conditions of the rules with their sub-expressions highlighted:
+// green if fully covered, yellow for conditions with a single outcome and red if never evaluated.
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	type ruleData struct {
+		RuleCoverage
+		Highlight template.HTML
+	}
+
+	rules := make([]ruleData, 0)
+	for _, rc := range c.Rules() {
+		data := ruleData{RuleCoverage: rc}
+		if rc.Nodes != nil {
+			data.Highlight = template.HTML(highlight(rc.Condition, rc.Nodes))
+		} else {
+			data.Highlight = template.HTML(html.EscapeString(rc.Condition))
+		}
+		rules = append(rules, data)
+	}
+
+	return coverageTemplate.Execute(w, rules)
+}
+
+// coverageNodes converts the counts of the sub-expressions of a condition.
+func coverageNodes(expr *parser.Coverage) ([]NodeCoverage, CoverageStats) {
+	stats := expr.Stats()
+	nodes := make([]NodeCoverage, 0)
+	for _, nc := range expr.Nodes() {
+		nodes = append(nodes, NodeCoverage(nc))
+	}
+	return nodes, CoverageStats(stats)
+}
+
+func ratio(hit, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%.0f%%)", hit, total, float64(hit)*100/float64(total))
+}
+
+// highlight wraps the sub-expressions of expr in nested span elements. nodes are ordered outer before inner.
+func highlight(expr string, nodes []NodeCoverage) string {
+	var sb strings.Builder
+	var open []NodeCoverage // nodes whose span element is not closed yet
+	pos := 1
+
+	closeUntil := func(end int) {
+		for len(open) > 0 && open[len(open)-1].End <= end {
+			top := open[len(open)-1]
+			sb.WriteString(html.EscapeString(expr[pos-1 : top.End-1]))
+			sb.WriteString("</span>")
+			pos = top.End
+			open = open[:len(open)-1]
+		}
+	}
+
+	for _, nc := range nodes {
+		closeUntil(nc.Pos)
+		sb.WriteString(html.EscapeString(expr[pos-1 : nc.Pos-1]))
+		pos = nc.Pos
+
+		class := "covered"
+		switch {
+		case nc.Hits == 0:
+			class = "uncovered"
+		case !nc.Covered():
+			class = "partial"
+		}
+		title := fmt.Sprintf("evaluated %d times", nc.Hits)
+		if nc.Condition {
+			title += fmt.Sprintf(", true %d times, false %d times", nc.True, nc.False)
+		}
+		if nc.Errors > 0 {
+			title += fmt.Sprintf(", failed %d times", nc.Errors)
+		}
+		fmt.Fprintf(&sb, `<span class="%s" title="%s">`, class, title)
+		open = append(open, nc)
+	}
+	closeUntil(len(expr) + 1)
+	sb.WriteString(html.EscapeString(expr[pos-1:]))
+
+	return sb.String()
+}
+
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Rule coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+pre { font-size: 1.1em; line-height: 1.8; white-space: pre-wrap; }
+span { padding: 1px 0; border-bottom: 2px solid transparent; }
+.covered { background: rgba(60, 180, 75, 0.15); border-bottom-color: rgb(60, 180, 75); }
+.partial { background: rgba(255, 200, 0, 0.25); border-bottom-color: rgb(230, 170, 0); }
+.uncovered { background: rgba(230, 25, 75, 0.2); border-bottom-color: rgb(230, 25, 75); }
+</style>
+</head>
+<body>
+<h1>Rule coverage</h1>
+<table>
+<tr><th>rule</th><th>evaluations</th><th>matches</th><th>errors</th><th>sub-expressions</th><th>outcomes</th></tr>
+{{- range .}}
+<tr><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.Evaluations}}</td><td>{{.Matches}}</td><td>{{.Errors}}</td>
+<td>{{.Stats.NodesHit}}/{{.Stats.Nodes}}</td><td>{{.Stats.OutcomesHit}}/{{.Stats.Outcomes}}</td></tr>
+{{- end}}
+</table>
+{{- range .}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<pre>{{.Highlight}}</pre>
+{{- end}}
+</body>
+</html>
+`))
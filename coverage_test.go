@@ -0,0 +1,124 @@
+package gorule
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func newCoverageEngine(t *testing.T, coverage *Coverage) *Engine {
+	engine := NewEngine(
+		WithLogger(log.New(io.Discard, "", log.LstdFlags)),
+		WithConfig(&Config{SkipBadRuleDuringMatch: true}),
+		WithCoverage(coverage),
+	)
+	for _, r := range []*Rule{
+		NewRule("adult", "age >= 18 && (vip || points > 100)", nil),
+		NewRule("senior", "age >= 65", nil),
+		NewRule("broken", "age >", nil),
+	} {
+		if err := engine.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return engine
+}
+
+func TestCoverage_Match(t *testing.T) {
+	coverage := NewCoverage()
+	engine := newCoverageEngine(t, coverage)
+
+	for _, vars := range []map[string]interface{}{
+		{"age": 20, "vip": true, "points": 0},
+		{"age": 16, "vip": false, "points": 200},
+	} {
+		if _, err := engine.Match(vars, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules := coverage.Rules()
+	if len(rules) != 3 {
+		t.Fatalf("Rules() = %d rules, want 3", len(rules))
+	}
+
+	adult := rules[0]
+	if adult.Name != "adult" || adult.Evaluations != 2 || adult.Matches != 1 || adult.Errors != 0 {
+		t.Errorf("adult = %+v", adult)
+	}
+	if stats := adult.Stats; stats.NodesHit != 7 || stats.Nodes != 7 || stats.OutcomesHit != 9 || stats.Outcomes != 10 {
+		t.Errorf("adult stats = %+v", stats)
+	}
+
+	broken := rules[1]
+	if broken.Name != "broken" || broken.Evaluations != 2 || broken.Errors != 2 || broken.Nodes != nil {
+		t.Errorf("broken = %+v", broken)
+	}
+
+	var text bytes.Buffer
+	if err := coverage.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	want := `rule                           evaluations  matches  errors  sub-expressions         outcomes
+adult                                    2        1       0       7/7 (100%)       9/10 (90%)
+broken                                   2        0       2                -                -
+senior                                   2        0       0       2/2 (100%)        1/2 (50%)
+
+adult:
+  never false:     (vip || points > 100)
+
+senior:
+  never true:      age >= 65
+`
+	if text.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var jsonOut bytes.Buffer
+	if err := coverage.WriteJSON(&jsonOut); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(jsonOut.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 3 || decoded[0]["stats"].(map[string]interface{})["outcomesHit"] != 9.0 {
+		t.Errorf("WriteJSON() = %s", jsonOut.String())
+	}
+
+	var htmlOut bytes.Buffer
+	if err := coverage.WriteHTML(&htmlOut); err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{
+		`<span class="partial" title="evaluated 2 times, true 0 times, false 2 times"><span class="covered" title="evaluated 2 times">age</span> &gt;= 65</span>`,
+		`<pre>age &gt;</pre>`,
+		`&amp;&amp; <span class="partial" title="evaluated 2 times, true 2 times, false 0 times">(<span`,
+	} {
+		if !strings.Contains(htmlOut.String(), part) {
+			t.Errorf("WriteHTML() does not contain %s:\n%s", part, htmlOut.String())
+		}
+	}
+
+	coverage.Reset()
+	if rules := coverage.Rules(); rules[0].Evaluations != 0 || rules[0].Stats.NodesHit != 0 {
+		t.Errorf("Reset() kept counts: %+v", rules[0])
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight(`a < 1 && "<b>"`, []NodeCoverage{
+		{Expr: `a < 1 && "<b>"`, Pos: 1, End: 15, Condition: true, Hits: 1, True: 1, False: 1},
+		{Expr: `a < 1`, Pos: 1, End: 6, Condition: true, Hits: 1, True: 1},
+		{Expr: `a`, Pos: 1, End: 2},
+	})
+	want := `<span class="covered" title="evaluated 1 times, true 1 times, false 1 times">` +
+		`<span class="partial" title="evaluated 1 times, true 1 times, false 0 times">` +
+		`<span class="uncovered" title="evaluated 0 times">a</span> &lt; 1</span> &amp;&amp; &#34;&lt;b&gt;&#34;</span>`
+	if got != want {
+		t.Errorf("highlight() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,499 @@
+package gorule
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+var (
+	ErrInvalidDecisionTable = errors.New("invalid decision table")
+	ErrHitPolicyViolation   = errors.New("hit policy violated")
+)
+
+// HitPolicy determines the result of a decision table if several rows match.
+type HitPolicy string
+
+const (
+	// HitUnique requires that at most one row matches.
+	HitUnique HitPolicy = "unique"
+	// HitFirst returns the outputs of the first row matching.
+	HitFirst HitPolicy = "first"
+	// HitPriority returns the outputs of the row matching with the highest priority, the first one on ties.
+	HitPriority HitPolicy = "priority"
+	// HitCollect returns the outputs of all rows matching, in the order of the rows.
+	HitCollect HitPolicy = "collect"
+	// HitCollectSum, HitCollectMin and HitCollectMax aggregate each output of all rows matching,
+	// which have to be numbers.
+	HitCollectSum HitPolicy = "collect sum"
+	HitCollectMin HitPolicy = "collect min"
+	HitCollectMax HitPolicy = "collect max"
+)
+
+func (p HitPolicy) valid() bool {
+	switch p {
+	case HitUnique, HitFirst, HitPriority, HitCollect, HitCollectSum, HitCollectMin, HitCollectMax:
+		return true
+	}
+	return false
+}
+
+// DecisionTable maps combinations of inputs to outputs, e.g. tier × region × channel → discount.
+// Each row is compiled into a condition evaluated like the condition of a rule.
+//
+// Inputs are expressions, usually variables, and each cell of a row is a test of the input of its column:
+//
+//	cell             tests
+//	- or empty       any value
+//	>= 100           comparison with <, <=, >, >=, == or !=
+//	in [1, 2]        in, not in or between followed by its right operand
+//	18..65           range or array the input has to be in
+//	gold             a single word is a string, equal to "gold"
+//	"gold", 5, true  any other expression the input has to be equal to
+type DecisionTable struct {
+	Name      string        `json:"name"`
+	HitPolicy HitPolicy     `json:"hitPolicy"`
+	Inputs    []string      `json:"inputs"`
+	Outputs   []string      `json:"outputs"`
+	Rows      []DecisionRow `json:"rows"`
+
+	conditions []*parser.Program
+}
+
+// DecisionRow is a row of a decision table, with a cell for each input and a value for each output.
+// Name defaults to "row 1", "row 2" and so on. Priority is only used by HitPriority.
+type DecisionRow struct {
+	Name     string        `json:"name,omitempty"`
+	When     []string      `json:"when"`
+	Then     []interface{} `json:"then"`
+	Priority int           `json:"priority,omitempty"`
+}
+
+// Decision is the result of evaluating a decision table: the names of the rows matching and the outputs,
+// mapped by output name. Unless the hit policy is HitCollect, there is at most one set of outputs.
+type Decision struct {
+	Rows    []string                 `json:"rows"`
+	Outputs []map[string]interface{} `json:"outputs"`
+}
+
+// Output returns the first set of outputs, or nil if no row matched.
+func (d *Decision) Output() map[string]interface{} {
+	if len(d.Outputs) == 0 {
+		return nil
+	}
+	return d.Outputs[0]
+}
+
+// DecodeDecisionTable reads a decision table from JSON and compiles it, e.g.
+//
+//	{"name": "discount", "hitPolicy": "first", "inputs": ["tier", "amount"], "outputs": ["discount"],
+//	 "rows": [{"when": ["gold", ">= 100"], "then": [0.1]}, {"when": ["-", "-"], "then": [0]}]}
+func DecodeDecisionTable(r io.Reader) (*DecisionTable, error) {
+	var t DecisionTable
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDecisionTable, err)
+	}
+	for i := range t.Rows {
+		for j, val := range t.Rows[i].Then {
+			t.Rows[i].Then[j] = normalizeNumbers(val)
+		}
+	}
+
+	if err := t.Compile(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DecodeDecisionTableCSV reads a decision table from CSV and compiles it. The header holds the inputs,
+// followed by the outputs prefixed with "=>". The optional columns "#name" and "#priority" hold the names
+// and priorities of the rows. Output cells are literals, where a single word is a string, e.g.
+//
+//	tier,amount,=> discount
+//	gold,>= 100,0.1
+//	-,-,0
+func DecodeDecisionTableCSV(r io.Reader, name string, policy HitPolicy) (*DecisionTable, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDecisionTable, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidDecisionTable)
+	}
+
+	t := &DecisionTable{Name: name, HitPolicy: policy}
+	nameCol, priorityCol := -1, -1
+	var inputCols, outputCols []int
+	for i, column := range records[0] {
+		column = strings.TrimSpace(column)
+		switch {
+		case column == "#name":
+			nameCol = i
+		case column == "#priority":
+			priorityCol = i
+		case strings.HasPrefix(column, "=>"):
+			t.Outputs = append(t.Outputs, strings.TrimSpace(strings.TrimPrefix(column, "=>")))
+			outputCols = append(outputCols, i)
+		default:
+			t.Inputs = append(t.Inputs, column)
+			inputCols = append(inputCols, i)
+		}
+	}
+
+	for i, record := range records[1:] {
+		var row DecisionRow
+		if nameCol >= 0 {
+			row.Name = strings.TrimSpace(record[nameCol])
+		}
+		if priorityCol >= 0 {
+			if _, err := fmt.Sscan(record[priorityCol], &row.Priority); err != nil {
+				return nil, fmt.Errorf("%w: line %d: invalid priority %q", ErrInvalidDecisionTable, i+2, record[priorityCol])
+			}
+		}
+		for _, col := range inputCols {
+			row.When = append(row.When, record[col])
+		}
+		for j, col := range outputCols {
+			val, err := parseOutput(record[col])
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: output %s: %v", ErrInvalidDecisionTable, i+2, t.Outputs[j], err)
+			}
+			row.Then = append(row.Then, val)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	if err := t.Compile(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+var word = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isWord reports whether the cell is a single word other than a keyword, which is read as string.
+func isWord(cell string) bool {
+	return word.MatchString(cell) && cell != "true" && cell != "false" && cell != "nil"
+}
+
+func parseOutput(cell string) (interface{}, error) {
+	cell = strings.TrimSpace(cell)
+	switch {
+	case cell == "":
+		return nil, nil
+	case isWord(cell):
+		return cell, nil
+	}
+	return parser.Evaluate(cell, nil, nil)
+}
+
+// Compile validates the table and compiles the conditions of its rows.
+// It has to be called for tables which are not decoded, before they are evaluated.
+func (t *DecisionTable) Compile() error {
+	if t.HitPolicy == "" {
+		t.HitPolicy = HitUnique
+	}
+	if !t.HitPolicy.valid() {
+		return fmt.Errorf("%w: unknown hit policy %q", ErrInvalidDecisionTable, t.HitPolicy)
+	}
+	if len(t.Inputs) == 0 || len(t.Outputs) == 0 {
+		return fmt.Errorf("%w: table needs inputs and outputs", ErrInvalidDecisionTable)
+	}
+
+	t.conditions = make([]*parser.Program, 0, len(t.Rows))
+	for i := range t.Rows {
+		row := &t.Rows[i]
+		if row.Name == "" {
+			row.Name = fmt.Sprintf("row %d", i+1)
+		}
+		if len(row.When) != len(t.Inputs) || len(row.Then) != len(t.Outputs) {
+			return fmt.Errorf("%w: %s has %d tests and %d outputs, want %d and %d",
+				ErrInvalidDecisionTable, row.Name, len(row.When), len(row.Then), len(t.Inputs), len(t.Outputs))
+		}
+
+		var tests []string
+		for j, cell := range row.When {
+			if test := inputTest(t.Inputs[j], cell); test != "" {
+				tests = append(tests, "("+test+")")
+			}
+		}
+		condition := "true"
+		if len(tests) > 0 {
+			condition = strings.Join(tests, " && ")
+		}
+
+		formatted, err := parser.Format(condition)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidDecisionTable, row.Name, err)
+		}
+		program, err := parser.Compile(formatted)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidDecisionTable, row.Name, err)
+		}
+		t.conditions = append(t.conditions, program)
+	}
+	return nil
+}
+
+var comparisonPrefix = regexp.MustCompile(`^(<=|>=|==|!=|<|>|in\s|not\s+in\s|between\s)`)
+
+// inputTest returns the condition testing the input against a cell, or "" if any value is allowed.
+func inputTest(input, cell string) string {
+	cell = strings.TrimSpace(cell)
+	input = "(" + input + ")"
+	switch {
+	case cell == "" || cell == "-":
+		return ""
+	case comparisonPrefix.MatchString(cell):
+		return input + " " + cell
+	case strings.HasPrefix(cell, "[") || (strings.Contains(cell, "..") && !strings.HasPrefix(cell, `"`)):
+		return input + " in " + cell
+	case isWord(cell):
+		return input + " == " + fmt.Sprintf("%q", cell)
+	}
+	return input + " == (" + cell + ")"
+}
+
+// checkCompiled returns an error wrapping ErrInvalidDecisionTable if the table is not compiled, see Compile.
+func (t *DecisionTable) checkCompiled() error {
+	if len(t.conditions) != len(t.Rows) {
+		return fmt.Errorf("%w: %s is not compiled", ErrInvalidDecisionTable, t.Name)
+	}
+	return nil
+}
+
+// Condition returns the condition compiled from the row at index i, or an error if the table is not compiled.
+func (t *DecisionTable) Condition(i int) (string, error) {
+	if err := t.checkCompiled(); err != nil {
+		return "", err
+	}
+	return t.conditions[i].Source(), nil
+}
+
+// Evaluate evaluates the conditions of all rows and returns the outputs according to the hit policy.
+func (t *DecisionTable) Evaluate(vars map[string]interface{}, functions map[string]parser.ExpressionFunction) (*Decision, error) {
+	if err := t.checkCompiled(); err != nil {
+		return nil, err
+	}
+
+	var matched []int
+	for i, program := range t.conditions {
+		res, err := program.Evaluate(vars, functions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Rows[i].Name, err)
+		}
+		b, ok := res.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", t.Rows[i].Name, ErrNonBooleanResult)
+		}
+		if b {
+			matched = append(matched, i)
+		}
+	}
+
+	switch t.HitPolicy {
+	case HitUnique:
+		if len(matched) > 1 {
+			return nil, fmt.Errorf("%w: %s match", ErrHitPolicyViolation, strings.Join(t.rowNames(matched), ", "))
+		}
+	case HitFirst:
+		if len(matched) > 1 {
+			matched = matched[:1]
+		}
+	case HitPriority:
+		if len(matched) > 1 {
+			best := matched[0]
+			for _, i := range matched[1:] {
+				if t.Rows[i].Priority > t.Rows[best].Priority {
+					best = i
+				}
+			}
+			matched = []int{best}
+		}
+	}
+
+	decision := &Decision{Rows: t.rowNames(matched), Outputs: make([]map[string]interface{}, 0, len(matched))}
+	for _, i := range matched {
+		decision.Outputs = append(decision.Outputs, t.outputs(i))
+	}
+
+	if aggregate := strings.TrimPrefix(string(t.HitPolicy), string(HitCollect)+" "); aggregate != string(t.HitPolicy) && len(matched) > 0 {
+		aggregated := make(map[string]interface{}, len(t.Outputs))
+		for _, output := range t.Outputs {
+			values := make([]interface{}, 0, len(matched))
+			for _, outputs := range decision.Outputs {
+				values = append(values, outputs[output])
+			}
+			val, err := aggregateValues(aggregate, values)
+			if err != nil {
+				return nil, fmt.Errorf("%s: output %s: %w", t.Name, output, err)
+			}
+			aggregated[output] = val
+		}
+		decision.Outputs = []map[string]interface{}{aggregated}
+	}
+
+	return decision, nil
+}
+
+func (t *DecisionTable) rowNames(rows []int) []string {
+	names := make([]string, 0, len(rows))
+	for _, i := range rows {
+		names = append(names, t.Rows[i].Name)
+	}
+	return names
+}
+
+func (t *DecisionTable) outputs(row int) map[string]interface{} {
+	outputs := make(map[string]interface{}, len(t.Outputs))
+	for j, name := range t.Outputs {
+		outputs[name] = t.Rows[row].Then[j]
+	}
+	return outputs
+}
+
+// aggregateValues sums up the numbers or returns the smallest or largest one.
+// The sum of integers is an integer, otherwise a float64.
+func aggregateValues(aggregate string, values []interface{}) (interface{}, error) {
+	var result interface{}
+	var sum float64
+	allInts := true
+	for _, val := range values {
+		var f float64
+		switch v := val.(type) {
+		case int:
+			f = float64(v)
+		case float64:
+			f = v
+			allInts = false
+		default:
+			return nil, fmt.Errorf("type error: cannot aggregate type %s", parser.TypeOf(val))
+		}
+
+		sum += f
+		switch {
+		case result == nil:
+			result = val
+		case aggregate == "min" && f < toFloat(result):
+			result = val
+		case aggregate == "max" && f > toFloat(result):
+			result = val
+		}
+	}
+
+	if aggregate != "sum" {
+		return result, nil
+	}
+	if allInts && math.Abs(sum) < 1<<53 {
+		return int(sum), nil
+	}
+	return sum, nil
+}
+
+func toFloat(val interface{}) float64 {
+	if i, ok := val.(int); ok {
+		return float64(i)
+	}
+	return val.(float64)
+}
+
+// Rules returns a rule for each row, named after the table and the row, e.g. "discount/row 1".
+// The action of a rule returns the outputs of its row, mapped by output name.
+// Return error if the table is not compiled.
+func (t *DecisionTable) Rules() ([]*Rule, error) {
+	if err := t.checkCompiled(); err != nil {
+		return nil, err
+	}
+
+	rules := make([]*Rule, 0, len(t.Rows))
+	for i := range t.Rows {
+		outputs := t.outputs(i)
+		rules = append(rules, NewRule(t.Name+"/"+t.Rows[i].Name, t.conditions[i].Source(), func(interface{}) (interface{}, error) {
+			return outputs, nil
+		}))
+	}
+	return rules, nil
+}
+
+// Validate reports rows which never match, combinations of inputs no row matches, as FindingGap,
+// and, for HitUnique, rows matching the same inputs, as FindingOverlap. Other hit policies resolve overlaps.
+// Gaps are only searched if all rows can be analyzed, see Engine.Analyze; rows which cannot are
+// listed in Skipped, like the table itself if it is not compiled.
+func (t *DecisionTable) Validate() AnalysisReport {
+	report := AnalysisReport{Findings: make([]Finding, 0), Skipped: map[string]string{}}
+	if err := t.checkCompiled(); err != nil {
+		report.Skipped[t.Name] = err.Error()
+		return report
+	}
+
+	analyzer := parser.NewAnalyzer()
+	type analyzedRow struct {
+		name      string
+		condition *parser.AnalyzedCondition
+	}
+	var rows []analyzedRow
+	for i, row := range t.Rows {
+		c, err := analyzer.Add(t.conditions[i].Source())
+		if err != nil {
+			report.Skipped[row.Name] = err.Error()
+			continue
+		}
+		if _, ok := c.Satisfiable(); !ok {
+			report.Findings = append(report.Findings, Finding{
+				Kind:    FindingUnsatisfiable,
+				Rules:   []string{row.Name},
+				Message: fmt.Sprintf("%s never matches, as its tests are contradictory", row.Name),
+			})
+			continue
+		}
+		rows = append(rows, analyzedRow{name: row.Name, condition: c})
+	}
+
+	if t.HitPolicy == HitUnique {
+		for i, a := range rows {
+			for _, b := range rows[i+1:] {
+				if witness, ok := a.condition.Overlaps(b.condition); ok {
+					report.Findings = append(report.Findings, Finding{
+						Kind:    FindingOverlap,
+						Rules:   []string{a.name, b.name},
+						Message: fmt.Sprintf("%s and %s match the same inputs", a.name, b.name),
+						Witness: witness,
+					})
+				}
+			}
+		}
+	}
+
+	if len(report.Skipped) == 0 {
+		// the inputs no row matches satisfy the negation of all rows
+		negated := make([]string, 0, len(t.Rows)+1)
+		negated = append(negated, "true")
+		for i := range t.Rows {
+			negated = append(negated, "!("+t.conditions[i].Source()+")")
+		}
+		gaps, err := analyzer.Add(strings.Join(negated, " && "))
+		if err != nil {
+			report.Skipped["gaps"] = err.Error()
+		} else if witness, ok := gaps.Satisfiable(); ok {
+			report.Findings = append(report.Findings, Finding{
+				Kind:    FindingGap,
+				Message: "no row matches some inputs",
+				Witness: witness,
+			})
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,279 @@
+package gorule
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const discountTableCSV = `#name,tier,amount,region,=> discount,=> label
+gold eu,gold,>= 100,"in [""eu"", ""uk""]",0.2,gold
+gold,gold,>= 100,-,0.1,gold
+silver,silver,100..<500,-,5,"""silver"""
+small,-,< 100,-,0,none
+`
+
+func TestDecodeDecisionTableCSV(t *testing.T) {
+	table, err := DecodeDecisionTableCSV(strings.NewReader(discountTableCSV), "discount", HitFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"tier", "amount", "region"}; !reflect.DeepEqual(table.Inputs, want) {
+		t.Errorf("Inputs = %v, want %v", table.Inputs, want)
+	}
+	if want := []string{"discount", "label"}; !reflect.DeepEqual(table.Outputs, want) {
+		t.Errorf("Outputs = %v, want %v", table.Outputs, want)
+	}
+	conditions := []string{
+		`tier == "gold" && amount >= 100 && region in ["eu", "uk"]`,
+		`tier == "gold" && amount >= 100`,
+		`tier == "silver" && amount in 100..<500`,
+		`amount < 100`,
+	}
+	for i, want := range conditions {
+		if got, err := table.Condition(i); err != nil || got != want {
+			t.Errorf("Condition(%d) = %s, want %s", i, got, want)
+		}
+	}
+	if want := []interface{}{5, "silver"}; !reflect.DeepEqual(table.Rows[2].Then, want) {
+		t.Errorf("Then = %v, want %v", table.Rows[2].Then, want)
+	}
+}
+
+func TestDecisionTable_Evaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   HitPolicy
+		vars     map[string]interface{}
+		wantRows []string
+		want     []map[string]interface{}
+		wantErr  error
+	}{
+		{
+			name:     "first",
+			policy:   HitFirst,
+			vars:     map[string]interface{}{"tier": "gold", "amount": 150, "region": "eu"},
+			wantRows: []string{"gold eu"},
+			want:     []map[string]interface{}{{"discount": 0.2, "label": "gold"}},
+		},
+		{
+			name:     "no match",
+			policy:   HitFirst,
+			vars:     map[string]interface{}{"tier": "bronze", "amount": 150, "region": "eu"},
+			wantRows: []string{},
+			want:     []map[string]interface{}{},
+		},
+		{
+			name:    "unique violated",
+			policy:  HitUnique,
+			vars:    map[string]interface{}{"tier": "gold", "amount": 150, "region": "eu"},
+			wantErr: ErrHitPolicyViolation,
+		},
+		{
+			name:     "unique",
+			policy:   HitUnique,
+			vars:     map[string]interface{}{"tier": "gold", "amount": 150, "region": "us"},
+			wantRows: []string{"gold"},
+			want:     []map[string]interface{}{{"discount": 0.1, "label": "gold"}},
+		},
+		{
+			name:     "collect",
+			policy:   HitCollect,
+			vars:     map[string]interface{}{"tier": "gold", "amount": 150, "region": "uk"},
+			wantRows: []string{"gold eu", "gold"},
+			want:     []map[string]interface{}{{"discount": 0.2, "label": "gold"}, {"discount": 0.1, "label": "gold"}},
+		},
+		{
+			name:    "collect sum of strings",
+			policy:  HitCollectSum,
+			vars:    map[string]interface{}{"tier": "gold", "amount": 150, "region": "uk"},
+			wantErr: errors.New("type error"),
+		},
+		{
+			name:    "missing variable",
+			policy:  HitFirst,
+			vars:    map[string]interface{}{"tier": "gold"},
+			wantErr: errors.New("var error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := DecodeDecisionTableCSV(strings.NewReader(discountTableCSV), "discount", tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := table.Evaluate(tt.vars, nil)
+			if tt.wantErr != nil {
+				if err == nil || (!errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error())) {
+					t.Errorf("Evaluate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Rows, tt.wantRows) || !reflect.DeepEqual(got.Outputs, tt.want) {
+				t.Errorf("Evaluate() = %v %v, want %v %v", got.Rows, got.Outputs, tt.wantRows, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecisionTable_Aggregation(t *testing.T) {
+	tableJSON := `{
+		"name": "points",
+		"hitPolicy": "%s",
+		"inputs": ["age", "member"],
+		"outputs": ["points"],
+		"rows": [
+			{"when": [">= 18", "-"], "then": [10]},
+			{"when": ["-", "true"], "then": [5], "priority": 2},
+			{"when": ["between 60 and 120", "-"], "then": [2.5], "priority": 1}
+		]
+	}`
+	vars := map[string]interface{}{"age": 65, "member": true}
+
+	tests := []struct {
+		policy HitPolicy
+		want   interface{}
+	}{
+		{HitCollectSum, 17.5},
+		{HitCollectMin, 2.5},
+		{HitCollectMax, 10},
+		{HitPriority, 5},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			table, err := DecodeDecisionTable(strings.NewReader(strings.Replace(tableJSON, "%s", string(tt.policy), 1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := table.Evaluate(vars, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Output()["points"] != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", got.Output()["points"], tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeDecisionTable_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+	}{
+		{"unknown hit policy", `{"hitPolicy": "any", "inputs": ["a"], "outputs": ["b"], "rows": []}`},
+		{"no outputs", `{"inputs": ["a"], "rows": []}`},
+		{"missing cell", `{"inputs": ["a", "b"], "outputs": ["c"], "rows": [{"when": ["1"], "then": [1]}]}`},
+		{"invalid test", `{"inputs": ["a"], "outputs": ["c"], "rows": [{"when": [">= "], "then": [1]}]}`},
+		{"unknown field", `{"inputs": ["a"], "outputs": ["c"], "rows": [], "policy": "first"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeDecisionTable(strings.NewReader(tt.table)); !errors.Is(err, ErrInvalidDecisionTable) {
+				t.Errorf("DecodeDecisionTable() error = %v, want %v", err, ErrInvalidDecisionTable)
+			}
+		})
+	}
+}
+
+func TestDecisionTable_Validate(t *testing.T) {
+	table, err := DecodeDecisionTableCSV(strings.NewReader(discountTableCSV+"never,-,> 10 && < 5,-,0,none\n"), "discount", HitUnique)
+	if err == nil {
+		t.Fatal("DecodeDecisionTableCSV() accepted a cell with &&")
+	}
+
+	table, err = DecodeDecisionTableCSV(strings.NewReader(discountTableCSV+"never,gold,between 10 and 5,-,0,none\n"), "discount", HitUnique)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := table.Validate()
+	want := []struct {
+		kind FindingKind
+		rows []string
+	}{
+		{FindingUnsatisfiable, []string{"never"}},
+		{FindingOverlap, []string{"gold eu", "gold"}},
+		{FindingGap, nil},
+	}
+	if len(report.Findings) != len(want) || len(report.Skipped) != 0 {
+		t.Fatalf("Validate() = %+v", report)
+	}
+	for i, f := range report.Findings {
+		if f.Kind != want[i].kind || !reflect.DeepEqual(f.Rules, want[i].rows) {
+			t.Errorf("Validate() finding %d = %s %v, want %s %v", i, f.Kind, f.Rules, want[i].kind, want[i].rows)
+		}
+	}
+
+	// the gap is matched by no row
+	decision, err := table.Evaluate(report.Findings[2].Witness, nil)
+	if err != nil || len(decision.Rows) != 0 {
+		t.Errorf("gap %v matches %v, %v", report.Findings[2].Witness, decision, err)
+	}
+
+	// a row matching everything closes all gaps
+	table, _ = DecodeDecisionTableCSV(strings.NewReader(discountTableCSV+"other,-,-,-,0,none\n"), "discount", HitFirst)
+	if report := table.Validate(); len(report.Findings) != 0 {
+		t.Errorf("Validate() = %+v, want no findings", report.Findings)
+	}
+}
+
+func TestDecisionTable_Rules(t *testing.T) {
+	table, err := DecodeDecisionTableCSV(strings.NewReader(discountTableCSV), "discount", HitCollect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tableRules, err := table.Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewEngine()
+	for _, r := range tableRules {
+		if err := engine.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rules, err := engine.Match(map[string]interface{}{"tier": "silver", "amount": 200, "region": "eu"}, nil)
+	if err != nil || len(rules) != 1 || rules[0].Name() != "discount/silver" {
+		t.Fatalf("Match() = %v, %v", rules, err)
+	}
+	got, _ := rules[0].Execute(nil)
+	if want := map[string]interface{}{"discount": 5, "label": "silver"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Execute() = %v, want %v", got, want)
+	}
+}
+
+func TestDecisionTable_NotCompiled(t *testing.T) {
+	table := &DecisionTable{
+		Name:    "discount",
+		Inputs:  []string{"tier"},
+		Outputs: []string{"discount"},
+		Rows:    []DecisionRow{{When: []string{"gold"}, Then: []interface{}{10}}},
+	}
+
+	if _, err := table.Rules(); !errors.Is(err, ErrInvalidDecisionTable) {
+		t.Errorf("Rules() error = %v, want %v", err, ErrInvalidDecisionTable)
+	}
+	if _, err := table.Condition(0); !errors.Is(err, ErrInvalidDecisionTable) {
+		t.Errorf("Condition() error = %v, want %v", err, ErrInvalidDecisionTable)
+	}
+	if _, err := table.Evaluate(map[string]interface{}{"tier": "gold"}, nil); !errors.Is(err, ErrInvalidDecisionTable) {
+		t.Errorf("Evaluate() error = %v, want %v", err, ErrInvalidDecisionTable)
+	}
+	if report := table.Validate(); len(report.Skipped) != 1 || len(report.Findings) != 0 {
+		t.Errorf("Validate() = %+v, want the table skipped", report)
+	}
+
+	if err := table.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := table.Condition(0); err != nil || got != `tier == "gold"` {
+		t.Errorf("Condition() = %s, %v after Compile", got, err)
+	}
+}
@@ -1,11 +1,13 @@
 package gorule
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 
@@ -14,6 +16,7 @@ import (
 
 var (
 	ErrRuleExists       = errors.New("rule name already exists")
+	ErrRuleNotFound     = errors.New("rule not found")
 	ErrNonBooleanResult = errors.New("encountered non boolean result during eval rule")
 )
 
@@ -24,9 +27,24 @@ type Config struct {
 type Engine struct {
 	mu sync.Mutex
 
-	rules  map[string]*Rule
-	config *Config
-	logger *log.Logger
+	rules    map[string]*Rule
+	config   *Config
+	logger   *log.Logger
+	coverage *Coverage
+	clock    func() time.Time // time.Now if nil
+
+	version     int               // the version of rules, 0 until the rule set is changed
+	history     []*RuleSetVersion // ordered by number
+	maxVersions int               // number of versions kept in history, none if 0
+
+	shadow             *shadow
+	experiments        map[string]*Experiment
+	initialExperiments []Experiment // set by WithExperiments
+
+	store    RuleStore
+	storeCtx context.Context
+
+	metrics Metrics
 }
 
 type Option func(*Engine)
@@ -44,6 +62,14 @@ func NewEngine(opts ...Option) *Engine {
 	for _, opt := range opts {
 		opt(engine)
 	}
+	for _, x := range engine.initialExperiments {
+		if err := engine.AddExperiment(x); err != nil {
+			engine.logger.Printf("Error: cannot add experiment: %v", err)
+		}
+	}
+	if engine.store != nil {
+		engine.startSync()
+	}
 
 	return engine
 }
@@ -62,36 +88,196 @@ func WithLogger(logger *log.Logger) Option {
 	}
 }
 
-// AddRule adds rule into engine, return error if rule name exists.
+// WithClock sets the clock by which Match decides whether rules are within their validity window.
+func WithClock(clock func() time.Time) Option {
+	return func(e *Engine) {
+		e.clock = clock
+	}
+}
+
+func (e *Engine) now() time.Time {
+	if e.clock == nil {
+		return time.Now()
+	}
+	return e.clock()
+}
+
+// AddRule adds rule into engine, return error if rule name exists. Adding a rule creates a new version of the rule set.
+// The condition is simplified once, see parser.Compile, and warnings about it, e.g. that it is always true, are logged.
 func (e *Engine) AddRule(rule *Rule) error {
+	_, err := e.update(func(u *RuleSetUpdate) error {
+		return u.AddRule(rule)
+	}, true)
+	return err
+}
+
+// RemoveRule removes the rule named name, creating a new version of the rule set.
+// Return error if the engine has no such rule.
+func (e *Engine) RemoveRule(name string) error {
+	_, err := e.update(func(u *RuleSetUpdate) error {
+		return u.RemoveRule(name)
+	}, true)
+	return err
+}
+
+// EnableRule enables the rule named name, return error if the engine has no such rule.
+func (e *Engine) EnableRule(name string) error {
+	return e.setEnabled(name, true)
+}
+
+// DisableRule disables the rule named name without removing it, so Match skips it until it is enabled again.
+// Return error if the engine has no such rule.
+func (e *Engine) DisableRule(name string) error {
+	return e.setEnabled(name, false)
+}
+
+func (e *Engine) setEnabled(name string, enabled bool) error {
+	_, err := e.update(func(u *RuleSetUpdate) error {
+		rule, ok := u.rules[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+		}
+		if rule.Enabled() != enabled {
+			// the rule is replaced rather than changed, as a running Match or an older version might refer to it
+			toggled := *rule
+			toggled.disabled = !enabled
+			u.rules[name] = &toggled
+			if enabled {
+				u.changes = append(u.changes, "enable "+name)
+			} else {
+				u.changes = append(u.changes, "disable "+name)
+			}
+		}
+		return nil
+	}, true)
+	return err
+}
+
+// compile compiles the condition of rule and logs warnings about it.
+func (e *Engine) compile(rule *Rule) {
+	if rule.program != nil {
+		return
+	}
+	if program, err := parser.Compile(rule.condition); err == nil {
+		rule.program = program
+		warnings, _ := rule.Check()
+		for _, w := range warnings {
+			e.logger.Printf("Warning: rule %s: %s", rule.Name(), w)
+		}
+	}
+}
+
+// Rules returns the rules of the engine ordered by name.
+func (e *Engine) Rules() []*Rule {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	for name, _ := range e.rules {
-		if name == rule.Name() {
-			return fmt.Errorf("%w: %s", ErrRuleExists, name)
+	return sortedRules(e.rules)
+}
+
+// MatchOption scopes Match to some of the rules of the engine.
+type MatchOption func(*matchOptions)
+
+type matchOptions struct {
+	filters []func(*Rule) bool
+}
+
+// OnlyTags scopes Match to the rules carrying all of the tags, e.g. OnlyTags("region:eu").
+func OnlyTags(tags ...string) MatchOption {
+	return OnlyRules(func(r *Rule) bool { return r.HasTags(tags...) })
+}
+
+// OnlyRules scopes Match to the rules for which filter returns true.
+func OnlyRules(filter func(*Rule) bool) MatchOption {
+	return func(o *matchOptions) {
+		o.filters = append(o.filters, filter)
+	}
+}
+
+func (o *matchOptions) includes(r *Rule) bool {
+	for _, filter := range o.filters {
+		if !filter(r) {
+			return false
 		}
 	}
+	return true
+}
 
-	e.rules[rule.Name()] = rule
+// Match iterates through all the rules of the engine, or the ones opts scope it to, and will return the matching rules.
+// Rules which are disabled, outside their validity window or not rolled out to the facts are skipped.
+func (e *Engine) Match(vars map[string]interface{}, functions map[string]parser.ExpressionFunction, opts ...MatchOption) ([]Rule, error) {
+	res, err := e.Run(vars, functions, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.Rules, nil
+}
 
-	return nil
+// MatchResult holds the rules matched by Engine.Run, the version of the rule set they were matched against
+// and the buckets the facts were assigned to by experiments and rollouts, see AddExperiment and WithRollout.
+type MatchResult struct {
+	Version     int
+	Rules       []Rule
+	Assignments []Assignment
 }
 
-// Match iterates through all the rules of the engine and will return the matching rules.
-func (e *Engine) Match(vars map[string]interface{}, functions map[string]parser.ExpressionFunction) ([]Rule, error) {
+// Run works like Match and reports the version of the rule set which produced the result.
+// All rules are matched against the same version, even if the rule set is changed meanwhile.
+// If a candidate is evaluated in shadow, see WithShadow, it is matched after the rules of the engine.
+func (e *Engine) Run(vars map[string]interface{}, functions map[string]parser.ExpressionFunction, opts ...MatchOption) (*MatchResult, error) {
+	start := time.Now()
 	matchedRules := make([]Rule, 0)
 
+	options := &matchOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	e.mu.Lock()
+	now := e.now()
+	version := e.version
+	shadow := e.shadow
+	metrics := e.metrics
+	assigner := newAssigner(vars, e.experiments)
+	active := make([]*Rule, 0, len(e.rules))
 	for _, r := range e.rules {
-		res, err := parser.Evaluate(r.condition, vars, functions)
+		if r.ActiveAt(now) {
+			active = append(active, r)
+		}
+	}
+	e.mu.Unlock()
+
+	// observe reports the duration of the match to metrics, if any, and returns err
+	observe := func(err error) error {
+		if metrics != nil {
+			metrics.ObserveMatch(time.Since(start), err)
+		}
+		return err
+	}
+
+	for _, r := range active {
+		if !options.includes(r) || !assigner.includes(r) {
+			continue
+		}
+		evaluated := time.Now()
+		res, err := e.evaluate(r, vars, functions)
 		matched, ok := res.(bool)
+		if metrics != nil {
+			category := ""
+			if err != nil {
+				category = errorCategory(err)
+			} else if !ok {
+				category = ErrorNonBoolean
+			}
+			metrics.ObserveRule(r.Name(), time.Since(evaluated), matched, category)
+		}
 		if !e.config.SkipBadRuleDuringMatch {
 			if err != nil {
 				e.logger.Printf("Error: rule %s returned unexpected error during match: %v", r.Name(), err)
-				return nil, fmt.Errorf("unexpected error occured during match: %w", err)
+				return nil, observe(fmt.Errorf("unexpected error occured during match: %w", err))
 			} else if !ok {
 				e.logger.Printf("Error: rule %s returned non-boolean value with vars %v", r.Name(), spew.Sdump(vars))
-				return nil, fmt.Errorf("%s: %w", r.Name(), ErrNonBooleanResult)
+				return nil, observe(fmt.Errorf("%s: %w", r.Name(), ErrNonBooleanResult))
 			}
 		}
 
@@ -100,5 +286,20 @@ func (e *Engine) Match(vars map[string]interface{}, functions map[string]parser.
 		}
 	}
 
-	return matchedRules, nil
+	res := &MatchResult{Version: version, Rules: matchedRules, Assignments: assigner.result()}
+	observe(nil)
+	if shadow != nil {
+		shadow.compare(res, vars, functions, opts)
+	}
+	return res, nil
+}
+
+func (e *Engine) evaluate(r *Rule, vars map[string]interface{}, functions map[string]parser.ExpressionFunction) (interface{}, error) {
+	if e.coverage != nil {
+		return e.coverage.evaluate(r, vars, functions)
+	}
+	if r.program != nil {
+		return r.program.Evaluate(vars, functions)
+	}
+	return parser.Evaluate(r.condition, vars, functions)
 }
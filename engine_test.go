@@ -1,14 +1,17 @@
 package gorule
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"log"
 	"os"
 	"reflect"
 	"regexp"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/spikewong/gorule/internal/parser"
 )
@@ -315,3 +318,131 @@ func TestEngine_MatchWithFunctions(t *testing.T) {
 		})
 	}
 }
+
+func TestEngine_AddRuleLogsWarnings(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEngine(WithLogger(log.New(&buf, "", 0)))
+
+	if err := e.AddRule(NewRule("always", "true || x > 1", nil)); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+	if err := e.AddRule(NewRule("sometimes", "true && x > 1 + 1", nil)); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+
+	want := "Warning: rule always: condition is always true at position 1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("AddRule() logged %q, want %q", got, want)
+	}
+
+	rules, err := e.Match(map[string]interface{}{"x": 2}, nil)
+	if err != nil {
+		t.Fatalf("Match() error = %v", err)
+	}
+	if len(rules) != 1 || rules[0].Name() != "always" {
+		t.Errorf("Match() got = %v, want rule always", rules)
+	}
+}
+
+func TestEngine_MatchScoped(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	for _, r := range []*Rule{
+		NewRule("eu vip", "vipLevel > 5", nil, WithTags("region:eu", "vip")),
+		NewRule("us vip", "vipLevel > 5", nil, WithTags("region:us", "vip")),
+		NewRule("eu all", "vipLevel >= 0", nil, WithTags("region:eu"), WithOwner("growth")),
+		NewRule("broken", "unknown > 1", nil),
+	} {
+		if err := e.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		opts    []MatchOption
+		want    []string
+		wantErr bool
+	}{
+		{name: "all rules", wantErr: true},
+		{name: "one tag", opts: []MatchOption{OnlyTags("region:eu")}, want: []string{"eu all", "eu vip"}},
+		{name: "all tags", opts: []MatchOption{OnlyTags("region:eu", "vip")}, want: []string{"eu vip"}},
+		{name: "unknown tag", opts: []MatchOption{OnlyTags("region:apac")}, want: []string{}},
+		{
+			name: "filters combined",
+			opts: []MatchOption{OnlyTags("region:eu"), OnlyRules(func(r *Rule) bool { return r.Owner() == "growth" })},
+			want: []string{"eu all"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := e.Match(map[string]interface{}{"vipLevel": 6}, nil, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Match() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got := make([]string, 0, len(rules))
+			for _, r := range rules {
+				got = append(got, r.Name())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_MatchActiveRules(t *testing.T) {
+	now := time.Date(2024, 12, 24, 12, 0, 0, 0, time.UTC)
+	christmas := time.Date(2024, 12, 24, 0, 0, 0, 0, time.UTC)
+
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithClock(func() time.Time { return now }))
+	for _, r := range []*Rule{
+		NewRule("always", "true", nil),
+		NewRule("disabled", "true", nil, WithEnabled(false)),
+		NewRule("christmas", "true", nil, WithValidFrom(christmas), WithValidUntil(christmas.AddDate(0, 0, 2))),
+		NewRule("new year", "true", nil, WithValidFrom(christmas.AddDate(0, 0, 8))),
+		NewRule("expired", "true", nil, WithValidUntil(christmas)),
+	} {
+		if err := e.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	match := func() []string {
+		rules, err := e.Match(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(rules))
+		for _, r := range rules {
+			names = append(names, r.Name())
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if got, want := match(), []string{"always", "christmas"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Match() = %v, want %v", got, want)
+	}
+
+	now = christmas.AddDate(0, 0, 8)
+	if got, want := match(), []string{"always", "new year"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Match() = %v, want %v", got, want)
+	}
+
+	if err := e.DisableRule("always"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.EnableRule("disabled"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := match(), []string{"disabled", "new year"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Match() after toggling = %v, want %v", got, want)
+	}
+	if err := e.DisableRule("unknown"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("DisableRule() error = %v, want %v", err, ErrRuleNotFound)
+	}
+}
@@ -0,0 +1,129 @@
+package gorule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirStore is a RuleStore keeping each rule as JSON file in a directory, named like the rule with the extension .json,
+// e.g. "vip.json" holding {"name": "vip", "condition": "vipLevel > 5"}. Characters not allowed in file names are escaped.
+type DirStore struct {
+	dir          string
+	pollInterval time.Duration
+}
+
+// NewDirStore creates a store keeping the rules in dir, which is created if it does not exist.
+// Watch looks for changes every pollInterval, which has to be positive.
+func NewDirStore(dir string, pollInterval time.Duration) (*DirStore, error) {
+	if pollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %v", pollInterval)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir, pollInterval: pollInterval}, nil
+}
+
+func (s *DirStore) path(name string) string {
+	return filepath.Join(s.dir, url.PathEscape(name)+".json")
+}
+
+// List returns the definitions of all rules ordered by name.
+func (s *DirStore) List(ctx context.Context) ([]RuleDefinition, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	defs := make([]RuleDefinition, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		def, err := s.read(filepath.Join(s.dir, entry.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			// deleted meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs, nil
+}
+
+// Get returns the definition of the rule named name.
+func (s *DirStore) Get(ctx context.Context, name string) (RuleDefinition, error) {
+	def, err := s.read(s.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return RuleDefinition{}, fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	return def, err
+}
+
+func (s *DirStore) read(path string) (RuleDefinition, error) {
+	var def RuleDefinition
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return def, err
+	}
+	if err := json.Unmarshal(content, &def); err != nil {
+		return def, fmt.Errorf("%s: %w: %v", path, ErrInvalidRuleFile, err)
+	}
+	if err := def.Validate(); err != nil {
+		return def, fmt.Errorf("%s: %w", path, err)
+	}
+	return def, nil
+}
+
+// Put adds the definition, or replaces the one of the same name. The file is replaced atomically,
+// so List never reads a partially written rule.
+func (s *DirStore) Put(ctx context.Context, def RuleDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".rule-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(def.Name))
+}
+
+// Delete removes the rule named name.
+func (s *DirStore) Delete(ctx context.Context, name string) error {
+	err := os.Remove(s.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	return err
+}
+
+// Watch returns a channel receiving the changes of the rules, including the ones made by editing the files,
+// until ctx is done. The directory is listed every poll interval.
+func (s *DirStore) Watch(ctx context.Context) (<-chan StoreEvent, error) {
+	return pollStore(ctx, s.pollInterval, s.List)
+}
@@ -0,0 +1,273 @@
+package gorule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+var (
+	ErrStageExists    = errors.New("stage name already exists")
+	ErrUnknownStage   = errors.New("unknown stage")
+	ErrFlowCycle      = errors.New("flow edge creates a cycle")
+	ErrInvalidFlow    = errors.New("invalid flow file")
+	ErrNonBooleanEdge = errors.New("encountered non boolean result during eval edge")
+)
+
+// Flow groups rules into named stages, e.g. eligibility → pricing → limits, connected by edges
+// conditioned on the outcome of a stage. Running a flow walks from the start stage along the edges,
+// which form a directed acyclic graph, and returns the path taken.
+type Flow struct {
+	start  string
+	stages map[string]*Engine
+	edges  map[string][]*flowEdge
+}
+
+type flowEdge struct {
+	to        string
+	condition string
+	program   *parser.Program // nil if the edge is always taken
+}
+
+// StageResult is the outcome of a stage: the rules matched, ordered by name, and the results of their actions,
+// mapped by rule name.
+type StageResult struct {
+	Stage   string                 `json:"stage"`
+	Matched []string               `json:"matched"`
+	Results map[string]interface{} `json:"results"`
+}
+
+// FlowResult holds the outcomes of the stages along the path taken, starting with the start stage.
+type FlowResult struct {
+	Path []StageResult `json:"path"`
+}
+
+// Stages returns the names of the stages along the path taken.
+func (r *FlowResult) Stages() []string {
+	stages := make([]string, 0, len(r.Path))
+	for _, s := range r.Path {
+		stages = append(stages, s.Stage)
+	}
+	return stages
+}
+
+// NewFlow creates a flow starting at the stage named start, which has to be added with AddStage.
+func NewFlow(start string) *Flow {
+	return &Flow{start: start, stages: make(map[string]*Engine), edges: make(map[string][]*flowEdge)}
+}
+
+// AddStage adds a stage whose rules are matched by engine, return error if the stage name exists.
+func (f *Flow) AddStage(name string, engine *Engine) error {
+	if _, ok := f.stages[name]; ok {
+		return fmt.Errorf("%w: %s", ErrStageExists, name)
+	}
+	f.stages[name] = engine
+	return nil
+}
+
+// AddEdge connects two stages. After the stage from is evaluated, the edges leaving it are tried in the order
+// they were added and the first one whose condition is true is taken. An empty condition is always true.
+// Besides the variables passed to Run, the condition can refer to `matched`, the names of the rules
+// the stage matched, and `results`, the results of their actions by rule name, e.g. `"vip" in matched` or `count(matched) > 0`.
+// Return error if a stage does not exist, the condition cannot be parsed or the edge creates a cycle.
+func (f *Flow) AddEdge(from, to, condition string) error {
+	for _, name := range []string{from, to} {
+		if _, ok := f.stages[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownStage, name)
+		}
+	}
+	if from == to || f.reachable(to, from, make(map[string]bool)) {
+		return fmt.Errorf("%w: %s -> %s", ErrFlowCycle, from, to)
+	}
+
+	edge := &flowEdge{to: to, condition: condition}
+	if condition != "" {
+		program, err := parser.Compile(condition)
+		if err != nil {
+			return fmt.Errorf("edge %s -> %s: %w", from, to, err)
+		}
+		edge.program = program
+	}
+	f.edges[from] = append(f.edges[from], edge)
+	return nil
+}
+
+// reachable reports whether stage to can be reached from stage from along the edges.
+// The stages visited are searched only once, as many paths might lead to them.
+func (f *Flow) reachable(from, to string, visited map[string]bool) bool {
+	if from == to {
+		return true
+	}
+	visited[from] = true
+	for _, edge := range f.edges[from] {
+		if !visited[edge.to] && f.reachable(edge.to, to, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run evaluates the stages along the path starting at the start stage, until no edge leaving the last one is taken.
+// The actions of the rules matched are executed with vars as input.
+func (f *Flow) Run(vars map[string]interface{}, functions map[string]parser.ExpressionFunction) (*FlowResult, error) {
+	if _, ok := f.stages[f.start]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStage, f.start)
+	}
+
+	result := &FlowResult{Path: make([]StageResult, 0)}
+	for stage := f.start; stage != ""; {
+		outcome, err := f.runStage(stage, vars, functions)
+		if err != nil {
+			return nil, err
+		}
+		result.Path = append(result.Path, *outcome)
+
+		if stage, err = f.next(outcome, vars, functions); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (f *Flow) runStage(stage string, vars map[string]interface{}, functions map[string]parser.ExpressionFunction) (*StageResult, error) {
+	rules, err := f.stages[stage].Match(vars, functions)
+	if err != nil {
+		return nil, fmt.Errorf("stage %s: %w", stage, err)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name() < rules[j].Name() })
+
+	outcome := &StageResult{Stage: stage, Matched: make([]string, 0, len(rules)), Results: make(map[string]interface{}, len(rules))}
+	for _, r := range rules {
+		outcome.Matched = append(outcome.Matched, r.Name())
+		if r.action == nil {
+			outcome.Results[r.Name()] = nil
+			continue
+		}
+		res, err := r.Execute(vars)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: rule %s: %w", stage, r.Name(), err)
+		}
+		outcome.Results[r.Name()] = res
+	}
+	return outcome, nil
+}
+
+// next returns the stage the first edge taken leads to, or "" if no edge is taken.
+func (f *Flow) next(outcome *StageResult, vars map[string]interface{}, functions map[string]parser.ExpressionFunction) (string, error) {
+	edges := f.edges[outcome.Stage]
+	if len(edges) == 0 {
+		return "", nil
+	}
+
+	scope := make(map[string]interface{}, len(vars)+2)
+	for k, v := range vars {
+		scope[k] = v
+	}
+	matched := make([]interface{}, 0, len(outcome.Matched))
+	for _, name := range outcome.Matched {
+		matched = append(matched, name)
+	}
+	scope["matched"] = matched
+	scope["results"] = outcome.Results
+
+	for _, edge := range edges {
+		if edge.program == nil {
+			return edge.to, nil
+		}
+		res, err := edge.program.Evaluate(scope, functions)
+		if err != nil {
+			return "", fmt.Errorf("edge %s -> %s: %w", outcome.Stage, edge.to, err)
+		}
+		taken, ok := res.(bool)
+		if !ok {
+			return "", fmt.Errorf("edge %s -> %s: %w", outcome.Stage, edge.to, ErrNonBooleanEdge)
+		}
+		if taken {
+			return edge.to, nil
+		}
+	}
+	return "", nil
+}
+
+// FlowFile is the JSON representation of a flow, e.g.
+//
+//	{"start": "eligibility",
+//	 "stages": [{"name": "eligibility", "rules": [{"name": "adult", "condition": "age >= 18"}]},
+//	            {"name": "pricing", "rules": [{"name": "vip", "condition": "vipLevel > 5", "action": "0.3"}]}],
+//	 "edges": [{"from": "eligibility", "to": "pricing", "when": "\"adult\" in matched"}]}
+type FlowFile struct {
+	Start  string          `json:"start"`
+	Stages []FlowStageFile `json:"stages"`
+	Edges  []FlowEdgeFile  `json:"edges"`
+}
+
+// FlowStageFile is the JSON representation of a stage and its rules.
+type FlowStageFile struct {
+	Name  string           `json:"name"`
+	Rules []RuleDefinition `json:"rules"`
+}
+
+// FlowEdgeFile is the JSON representation of an edge. Without When, the edge is always taken.
+type FlowEdgeFile struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	When string `json:"when,omitempty"`
+}
+
+// DecodeFlow reads a flow file and creates the flow. The engines of the stages are created with opts.
+func DecodeFlow(r io.Reader, opts ...Option) (*Flow, error) {
+	var file FlowFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFlow, err)
+	}
+	if file.Start == "" {
+		return nil, fmt.Errorf("%w: missing start stage", ErrInvalidFlow)
+	}
+
+	flow := NewFlow(file.Start)
+	for _, stage := range file.Stages {
+		engine := NewEngine(opts...)
+		for _, def := range stage.Rules {
+			if err := def.Validate(); err != nil {
+				return nil, fmt.Errorf("%w: stage %s: %v", ErrInvalidFlow, stage.Name, err)
+			}
+			if err := engine.AddRule(def.Rule()); err != nil {
+				return nil, fmt.Errorf("stage %s: %w", stage.Name, err)
+			}
+		}
+		if err := flow.AddStage(stage.Name, engine); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := flow.stages[file.Start]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStage, file.Start)
+	}
+	for _, edge := range file.Edges {
+		if err := flow.AddEdge(edge.From, edge.To, edge.When); err != nil {
+			return nil, err
+		}
+	}
+	return flow, nil
+}
+
+// NewFlowFromFile reads the flow file at path. The engines of the stages are created with opts.
+func NewFlowFromFile(path string, opts ...Option) (*Flow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	flow, err := DecodeFlow(f, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return flow, nil
+}
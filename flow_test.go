@@ -0,0 +1,193 @@
+package gorule
+
+import (
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const orderFlow = `{
+	"start": "eligibility",
+	"stages": [
+		{"name": "eligibility", "rules": [
+			{"name": "adult", "condition": "age >= 18"},
+			{"name": "blocked", "condition": "inBlacklist"}
+		]},
+		{"name": "pricing", "rules": [
+			{"name": "vip", "condition": "vipLevel > 5", "action": "amount * 0.3"},
+			{"name": "bulk", "condition": "amount >= 1000", "action": "amount * 0.1"}
+		]},
+		{"name": "review", "rules": [{"name": "manual", "condition": "true", "action": "\"review\""}]},
+		{"name": "limits", "rules": [{"name": "cap", "condition": "amount > 500", "action": "500"}]}
+	],
+	"edges": [
+		{"from": "eligibility", "to": "review", "when": "\"blocked\" in matched"},
+		{"from": "eligibility", "to": "pricing", "when": "\"adult\" in matched"},
+		{"from": "pricing", "to": "limits", "when": "count(matched) > 0"},
+		{"from": "review", "to": "limits"}
+	]
+}`
+
+func TestFlow_Run(t *testing.T) {
+	flow, err := DecodeFlow(strings.NewReader(orderFlow), WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		vars     map[string]interface{}
+		want     []string
+		wantLast StageResult
+		wantErr  bool
+	}{
+		{
+			name:     "vip",
+			vars:     map[string]interface{}{"age": 30, "inBlacklist": false, "vipLevel": 6, "amount": 1000},
+			want:     []string{"eligibility", "pricing", "limits"},
+			wantLast: StageResult{Stage: "limits", Matched: []string{"cap"}, Results: map[string]interface{}{"cap": 500}},
+		},
+		{
+			name:     "no discount",
+			vars:     map[string]interface{}{"age": 30, "inBlacklist": false, "vipLevel": 1, "amount": 100},
+			want:     []string{"eligibility", "pricing"},
+			wantLast: StageResult{Stage: "pricing", Matched: []string{}, Results: map[string]interface{}{}},
+		},
+		{
+			name:     "blocked",
+			vars:     map[string]interface{}{"age": 30, "inBlacklist": true, "vipLevel": 6, "amount": 100},
+			want:     []string{"eligibility", "review", "limits"},
+			wantLast: StageResult{Stage: "limits", Matched: []string{}, Results: map[string]interface{}{}},
+		},
+		{
+			name:     "minor",
+			vars:     map[string]interface{}{"age": 16, "inBlacklist": false},
+			want:     []string{"eligibility"},
+			wantLast: StageResult{Stage: "eligibility", Matched: []string{}, Results: map[string]interface{}{}},
+		},
+		{
+			name:    "missing variable",
+			vars:    map[string]interface{}{"age": 30, "inBlacklist": false},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := flow.Run(tt.vars, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got.Stages(), tt.want) {
+				t.Errorf("Run() path = %v, want %v", got.Stages(), tt.want)
+			}
+			if last := got.Path[len(got.Path)-1]; !reflect.DeepEqual(last, tt.wantLast) {
+				t.Errorf("Run() last stage = %+v, want %+v", last, tt.wantLast)
+			}
+		})
+	}
+
+	got, err := flow.Run(map[string]interface{}{"age": 30, "inBlacklist": false, "vipLevel": 6, "amount": 1000}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pricing := StageResult{Stage: "pricing", Matched: []string{"bulk", "vip"}, Results: map[string]interface{}{"bulk": 100.0, "vip": 300.0}}
+	if !reflect.DeepEqual(got.Path[1], pricing) {
+		t.Errorf("Run() pricing = %+v, want %+v", got.Path[1], pricing)
+	}
+}
+
+func TestFlow_AddEdge(t *testing.T) {
+	flow := NewFlow("a")
+	for _, name := range []string{"a", "b", "c"} {
+		if err := flow.AddStage(name, NewEngine()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		from, to  string
+		condition string
+		wantErr   error
+	}{
+		{name: "a -> b", from: "a", to: "b"},
+		{name: "b -> c", from: "b", to: "c", condition: `"x" in matched`},
+		{name: "a -> c", from: "a", to: "c"},
+		{name: "cycle", from: "c", to: "a", wantErr: ErrFlowCycle},
+		{name: "self", from: "b", to: "b", wantErr: ErrFlowCycle},
+		{name: "unknown stage", from: "a", to: "d", wantErr: ErrUnknownStage},
+		{name: "invalid condition", from: "a", to: "b", condition: "x >", wantErr: errors.New("syntax error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := flow.AddEdge(tt.from, tt.to, tt.condition)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("AddEdge() error = %v", err)
+				}
+				return
+			}
+			if err == nil || (!errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error())) {
+				t.Errorf("AddEdge() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// the cycle check visits each stage once, however many paths lead to it
+	dense := NewFlow("0")
+	for i := 0; i < 40; i++ {
+		if err := dense.AddStage(strconv.Itoa(i), NewEngine()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 39; i >= 0; i-- {
+		for j := i + 1; j < 40; j++ {
+			if err := dense.AddEdge(strconv.Itoa(i), strconv.Itoa(j), ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := dense.AddEdge("39", "0", ""); !errors.Is(err, ErrFlowCycle) {
+		t.Errorf("AddEdge() error = %v, want %v", err, ErrFlowCycle)
+	}
+
+	if err := flow.AddStage("a", NewEngine()); !errors.Is(err, ErrStageExists) {
+		t.Errorf("AddStage() error = %v, want %v", err, ErrStageExists)
+	}
+	if _, err := NewFlow("x").Run(nil, nil); !errors.Is(err, ErrUnknownStage) {
+		t.Errorf("Run() error = %v, want %v", err, ErrUnknownStage)
+	}
+}
+
+func TestDecodeFlow_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr error
+	}{
+		{"invalid json", `{"start": `, ErrInvalidFlow},
+		{"missing start", `{"stages": []}`, ErrInvalidFlow},
+		{"unknown start", `{"start": "a", "stages": []}`, ErrUnknownStage},
+		{"duplicate stage", `{"start": "a", "stages": [{"name": "a"}, {"name": "a"}]}`, ErrStageExists},
+		{"duplicate rule", `{"start": "a", "stages": [{"name": "a", "rules": [
+			{"name": "r", "condition": "true"}, {"name": "r", "condition": "true"}]}]}`, ErrRuleExists},
+		{"rule without condition", `{"start": "a", "stages": [{"name": "a", "rules": [{"name": "r"}]}]}`, ErrInvalidFlow},
+		{"invalid rollout", `{"start": "a", "stages": [{"name": "a", "rules": [
+			{"name": "r", "condition": "true", "rollout": {"percent": 120, "key": "userId"}}]}]}`, ErrInvalidFlow},
+		{"cycle", `{"start": "a", "stages": [{"name": "a"}, {"name": "b"}],
+			"edges": [{"from": "a", "to": "b"}, {"from": "b", "to": "a"}]}`, ErrFlowCycle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeFlow(strings.NewReader(tt.file), WithLogger(log.New(io.Discard, "", 0))); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DecodeFlow() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,10 +2,20 @@ module github.com/spikewong/gorule
 
 go 1.18
 
-require github.com/stretchr/testify v1.8.1
+require (
+	github.com/davecgh/go-spew v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.17
+	github.com/stretchr/testify v1.8.1
+	google.golang.org/grpc v1.56.3
+	google.golang.org/protobuf v1.30.0
+)
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.11.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,682 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotAnalyzable is returned for conditions which cannot be analyzed, see Analyzer.
+var ErrNotAnalyzable = errors.New("condition cannot be analyzed")
+
+// maxTerms limits the number of conjunctions a condition is expanded into.
+const maxTerms = 1024
+
+// Analyzer compares conditions over numeric, bool and enumerated (string) variables.
+//
+// A condition is analyzable if, once simplified, it only combines comparisons of a variable with literals,
+// e.g. `age >= 18`, `region == "eu"`, `channel in ["web", "app"]`, `score in 1..<10`, `age between 18 and 65`
+// and `!inBlacklist`, using `&&`, `||` and `!`. Variables may be members of objects, e.g. `user.age`.
+//
+// Each variable must be compared with values of one type across all conditions added, which determines
+// its domain: numbers are reals, strings are enumerated and bools are true and false.
+// Conditions are analyzed as if all their variables were present in the facts.
+type Analyzer struct {
+	kinds map[string]valueKind
+}
+
+// NewAnalyzer creates an analyzer without conditions.
+func NewAnalyzer() *Analyzer {
+	return &Analyzer{kinds: map[string]valueKind{}}
+}
+
+// AnalyzedCondition is a condition added to an Analyzer.
+type AnalyzedCondition struct {
+	analyzer *Analyzer
+	root     *node
+	vars     []string // variables compared by the condition
+	terms    []term   // disjunction of the satisfying conjunctions
+	negated  []term   // terms of the negated condition, expanded once needed
+	err      error    // error expanding the negated condition
+}
+
+// Add parses the condition and expands it into the conjunctions satisfying it.
+// The error wraps ErrNotAnalyzable unless the condition cannot be parsed.
+func (a *Analyzer) Add(str string) (c *AnalyzedCondition, err error) {
+	defer recoverError(&err)
+
+	root := parse(str).simplify()
+	kinds := make(map[string]valueKind, len(a.kinds))
+	for k, v := range a.kinds {
+		kinds[k] = v
+	}
+
+	c = &AnalyzedCondition{analyzer: a, root: root}
+	if c.terms, err = expand(root, false, kinds); err != nil {
+		return nil, err
+	}
+	// the kinds are only kept if the condition is analyzable
+	a.kinds = kinds
+	c.vars = variables(root, nil)
+	return c, nil
+}
+
+// Satisfiable reports whether any facts satisfy the condition and returns an example.
+func (c *AnalyzedCondition) Satisfiable() (map[string]interface{}, bool) {
+	if len(c.terms) == 0 {
+		return nil, false
+	}
+	return c.terms[0].witness(c.vars, c.analyzer.kinds), true
+}
+
+// Overlaps reports whether any facts satisfy both conditions and returns an example.
+func (c *AnalyzedCondition) Overlaps(other *AnalyzedCondition) (map[string]interface{}, bool) {
+	return intersect(c.terms, other.terms, append(c.vars, other.vars...), c.analyzer.kinds)
+}
+
+// SharesVariables reports whether both conditions compare at least one variable in common.
+func (c *AnalyzedCondition) SharesVariables(other *AnalyzedCondition) bool {
+	for _, v := range c.vars {
+		for _, o := range other.vars {
+			if v == o {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Implies reports whether all facts satisfying the condition satisfy the other one as well.
+// If not, facts satisfying the condition but not the other one are returned.
+func (c *AnalyzedCondition) Implies(other *AnalyzedCondition) (bool, map[string]interface{}, error) {
+	negated, err := other.negation()
+	if err != nil {
+		return false, nil, err
+	}
+	if witness, ok := intersect(c.terms, negated, append(c.vars, other.vars...), c.analyzer.kinds); ok {
+		return false, witness, nil
+	}
+	return true, nil, nil
+}
+
+func (c *AnalyzedCondition) negation() ([]term, error) {
+	if c.negated == nil && c.err == nil {
+		c.negated, c.err = expand(c.root, true, c.analyzer.kinds)
+		if c.negated == nil {
+			c.negated = []term{}
+		}
+	}
+	return c.negated, c.err
+}
+
+func intersect(terms, others []term, vars []string, kinds map[string]valueKind) (map[string]interface{}, bool) {
+	for _, t := range terms {
+		for _, o := range others {
+			if both, ok := t.intersect(o); ok {
+				return both.witness(vars, kinds), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// expand returns the disjunction of conjunctions equivalent to the node, or to its negation if negate is set.
+func expand(n *node, negate bool, kinds map[string]valueKind) ([]term, error) {
+	switch n.typ {
+	case nodeLiteral:
+		b, ok := n.value.(bool)
+		if !ok {
+			break
+		}
+		if b != negate {
+			return []term{{}}, nil
+		}
+		return []term{}, nil
+
+	case nodeUnary:
+		if n.op == "!" {
+			return expand(n.args[0], !negate, kinds)
+		}
+
+	case nodeBinary:
+		switch n.op {
+		case "&&", "||":
+			left, err := expand(n.args[0], negate, kinds)
+			if err != nil {
+				return nil, err
+			}
+			right, err := expand(n.args[1], negate, kinds)
+			if err != nil {
+				return nil, err
+			}
+			// by De Morgan's laws, the negation of a conjunction is the disjunction of the negations
+			if (n.op == "||") != negate {
+				return union(left, right)
+			}
+			return product(left, right)
+		}
+	}
+
+	name, set, err := constraint(n, kinds)
+	if err != nil {
+		return nil, err
+	}
+	if negate {
+		set = set.complement()
+	}
+	if set.empty() {
+		return []term{}, nil
+	}
+	return []term{{name: set}}, nil
+}
+
+func union(left, right []term) ([]term, error) {
+	if len(left)+len(right) > maxTerms {
+		return nil, fmt.Errorf("%w: too complex", ErrNotAnalyzable)
+	}
+	return append(append([]term{}, left...), right...), nil
+}
+
+func product(left, right []term) ([]term, error) {
+	terms := []term{}
+	for _, l := range left {
+		for _, r := range right {
+			if t, ok := l.intersect(r); ok {
+				if len(terms) == maxTerms {
+					return nil, fmt.Errorf("%w: too complex", ErrNotAnalyzable)
+				}
+				terms = append(terms, t)
+			}
+		}
+	}
+	return terms, nil
+}
+
+// constraint returns the variable and the values it is restricted to by a comparison.
+func constraint(n *node, kinds map[string]valueKind) (string, valueSet, error) {
+	notAnalyzable := fmt.Errorf("%w: unsupported expression at position %d", ErrNotAnalyzable, n.pos)
+
+	// a variable on its own has to be true
+	if name, ok := variablePath(n); ok {
+		set := valueSet{kind: kindBool, bools: [2]bool{false, true}}
+		return name, set, checkKind(kinds, name, set.kind)
+	}
+	if n.typ != nodeBinary {
+		return "", valueSet{}, notAnalyzable
+	}
+
+	op, left, right := n.op, n.args[0], n.args[1]
+	if _, ok := variablePath(left); !ok {
+		if flipped, ok := flippedOps[op]; ok {
+			op, left, right = flipped, right, left
+		}
+	}
+	name, ok := variablePath(left)
+	if !ok {
+		return "", valueSet{}, notAnalyzable
+	}
+
+	var set valueSet
+	switch {
+	case right.typ == nodeLiteral:
+		set, ok = compareLiteral(op, right.value)
+
+	case right.typ == nodeArray && (op == "in" || op == "not in"):
+		values := make([]interface{}, 0, len(right.args))
+		for _, arg := range right.args {
+			if arg.typ != nodeLiteral {
+				return "", valueSet{}, notAnalyzable
+			}
+			values = append(values, arg.value)
+		}
+		set, ok = oneOf(values)
+		if ok && op == "not in" {
+			set = set.complement()
+		}
+
+	case right.typ == nodeRange && (op == "in" || op == "not in" || op == "between"):
+		set, ok = inRange(right)
+		if ok && op == "not in" {
+			set = set.complement()
+		}
+
+	default:
+		ok = false
+	}
+	if !ok {
+		return "", valueSet{}, notAnalyzable
+	}
+	return name, set, checkKind(kinds, name, set.kind)
+}
+
+// flippedOps maps the comparisons to the ones with swapped operands.
+var flippedOps = map[string]string{
+	"==": "==", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<=",
+}
+
+func checkKind(kinds map[string]valueKind, name string, kind valueKind) error {
+	if known, ok := kinds[name]; ok && known != kind {
+		return fmt.Errorf("%w: %s is compared with %s and %s", ErrNotAnalyzable, name, known, kind)
+	}
+	kinds[name] = kind
+	return nil
+}
+
+// variables appends the variables compared within the node to vars.
+func variables(n *node, vars []string) []string {
+	if name, ok := variablePath(n); ok {
+		return append(vars, name)
+	}
+	for _, arg := range n.args {
+		if arg != nil {
+			vars = variables(arg, vars)
+		}
+	}
+	return vars
+}
+
+// variablePath returns the name of a variable or of a member of it, e.g. `user.age`.
+func variablePath(n *node) (string, bool) {
+	switch n.typ {
+	case nodeVar:
+		return n.name, true
+	case nodeMember:
+		if parent, ok := variablePath(n.args[0]); ok {
+			return parent + "." + n.name, true
+		}
+	}
+	return "", false
+}
+
+func compareLiteral(op string, val interface{}) (valueSet, bool) {
+	switch v := val.(type) {
+	case bool:
+		set := valueSet{kind: kindBool}
+		switch op {
+		case "==":
+			set.bools[boolIndex(v)] = true
+		case "!=":
+			set.bools[boolIndex(!v)] = true
+		default:
+			return valueSet{}, false
+		}
+		return set, true
+
+	case string:
+		set := valueSet{kind: kindString, strings: stringSet{values: map[string]bool{v: true}}}
+		switch op {
+		case "==":
+			return set, true
+		case "!=":
+			return set.complement(), true
+		}
+		return valueSet{}, false
+	}
+
+	f, ok := toNumber(val)
+	if !ok {
+		return valueSet{}, false
+	}
+	all := interval{lo: math.Inf(-1), hi: math.Inf(1), loOpen: true, hiOpen: true}
+	iv := all
+	switch op {
+	case "==", "!=":
+		iv = interval{lo: f, hi: f}
+	case "<":
+		iv.hi, iv.hiOpen = f, true
+	case "<=":
+		iv.hi, iv.hiOpen = f, false
+	case ">":
+		iv.lo, iv.loOpen = f, true
+	case ">=":
+		iv.lo, iv.loOpen = f, false
+	default:
+		return valueSet{}, false
+	}
+	set := valueSet{kind: kindNumber, intervals: []interval{iv}}
+	if op == "!=" {
+		set = set.complement()
+	}
+	return set, true
+}
+
+func oneOf(values []interface{}) (valueSet, bool) {
+	if len(values) == 0 {
+		return valueSet{}, false
+	}
+	if _, ok := values[0].(string); ok {
+		set := valueSet{kind: kindString, strings: stringSet{values: map[string]bool{}}}
+		for _, val := range values {
+			s, ok := val.(string)
+			if !ok {
+				return valueSet{}, false
+			}
+			set.strings.values[s] = true
+		}
+		return set, true
+	}
+
+	set := valueSet{kind: kindNumber}
+	for _, val := range values {
+		f, ok := toNumber(val)
+		if !ok {
+			return valueSet{}, false
+		}
+		set.intervals = append(set.intervals, interval{lo: f, hi: f})
+	}
+	set.intervals = normalize(set.intervals)
+	return set, true
+}
+
+func inRange(n *node) (valueSet, bool) {
+	iv := interval{lo: math.Inf(-1), hi: math.Inf(1), loOpen: true, hiOpen: true}
+	if from := n.args[0]; from != nil {
+		f, ok := toNumber(literalValue(from))
+		if !ok {
+			return valueSet{}, false
+		}
+		iv.lo, iv.loOpen = f, false
+	}
+	if to := n.args[1]; to != nil {
+		f, ok := toNumber(literalValue(to))
+		if !ok {
+			return valueSet{}, false
+		}
+		iv.hi, iv.hiOpen = f, n.op == "..<"
+	}
+	return valueSet{kind: kindNumber, intervals: normalize([]interval{iv})}, true
+}
+
+func literalValue(n *node) interface{} {
+	if n.typ == nodeLiteral {
+		return n.value
+	}
+	return nil
+}
+
+func toNumber(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// term is a conjunction of restrictions of variables. Variables not contained are unrestricted.
+type term map[string]valueSet
+
+// intersect returns the conjunction of both terms, which is false if any variable cannot take a value.
+func (t term) intersect(other term) (term, bool) {
+	both := make(term, len(t)+len(other))
+	for name, set := range t {
+		both[name] = set
+	}
+	for name, set := range other {
+		if known, ok := both[name]; ok {
+			set = known.intersect(set)
+		}
+		if set.empty() {
+			return nil, false
+		}
+		both[name] = set
+	}
+	return both, true
+}
+
+// witness returns facts satisfying the term, including a value for each of vars not restricted by the term,
+// so the facts can be evaluated. Members are returned as nested objects.
+func (t term) witness(vars []string, kinds map[string]valueKind) map[string]interface{} {
+	all := make(term, len(t)+len(vars))
+	for _, name := range vars {
+		all[name] = fullSet(kinds[name])
+	}
+	for name, set := range t {
+		all[name] = set
+	}
+
+	facts := map[string]interface{}{}
+	for name, set := range all {
+		obj := facts
+		path := strings.Split(name, ".")
+		for _, key := range path[:len(path)-1] {
+			child, ok := obj[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				obj[key] = child
+			}
+			obj = child
+		}
+		obj[path[len(path)-1]] = set.witness()
+	}
+	return facts
+}
+
+type valueKind int
+
+const (
+	kindNumber valueKind = iota
+	kindString
+	kindBool
+)
+
+func (k valueKind) String() string {
+	return [...]string{"number", "string", "bool"}[k]
+}
+
+// valueSet is the set of values a variable may take. Only the field of its kind is used.
+type valueSet struct {
+	kind      valueKind
+	intervals []interval // sorted and disjoint
+	strings   stringSet
+	bools     [2]bool // whether false and true are contained
+}
+
+// fullSet returns the set of all values of the kind.
+func fullSet(kind valueKind) valueSet {
+	switch kind {
+	case kindNumber:
+		return valueSet{kind: kind, intervals: []interval{{lo: math.Inf(-1), hi: math.Inf(1), loOpen: true, hiOpen: true}}}
+	case kindString:
+		return valueSet{kind: kind, strings: stringSet{except: true}}
+	}
+	return valueSet{kind: kind, bools: [2]bool{true, true}}
+}
+
+func boolIndex(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s valueSet) empty() bool {
+	switch s.kind {
+	case kindNumber:
+		return len(s.intervals) == 0
+	case kindString:
+		return !s.strings.except && len(s.strings.values) == 0
+	}
+	return !s.bools[0] && !s.bools[1]
+}
+
+// intersect returns the values contained in both sets, which are of the same kind.
+func (s valueSet) intersect(other valueSet) valueSet {
+	switch s.kind {
+	case kindNumber:
+		var intervals []interval
+		for _, a := range s.intervals {
+			for _, b := range other.intervals {
+				if iv := a.intersect(b); !iv.empty() {
+					intervals = append(intervals, iv)
+				}
+			}
+		}
+		return valueSet{kind: kindNumber, intervals: normalize(intervals)}
+	case kindString:
+		return valueSet{kind: kindString, strings: s.strings.intersect(other.strings)}
+	}
+	return valueSet{kind: kindBool, bools: [2]bool{s.bools[0] && other.bools[0], s.bools[1] && other.bools[1]}}
+}
+
+// complement returns the values of the same kind not contained in the set.
+func (s valueSet) complement() valueSet {
+	switch s.kind {
+	case kindNumber:
+		var intervals []interval
+		lo, loOpen := math.Inf(-1), true
+		for _, iv := range s.intervals {
+			if gap := (interval{lo: lo, loOpen: loOpen, hi: iv.lo, hiOpen: !iv.loOpen}); !gap.empty() {
+				intervals = append(intervals, gap)
+			}
+			lo, loOpen = iv.hi, !iv.hiOpen
+		}
+		if gap := (interval{lo: lo, loOpen: loOpen, hi: math.Inf(1), hiOpen: true}); !gap.empty() {
+			intervals = append(intervals, gap)
+		}
+		return valueSet{kind: kindNumber, intervals: intervals}
+	case kindString:
+		return valueSet{kind: kindString, strings: stringSet{values: s.strings.values, except: !s.strings.except}}
+	}
+	return valueSet{kind: kindBool, bools: [2]bool{!s.bools[0], !s.bools[1]}}
+}
+
+func (s valueSet) witness() interface{} {
+	switch s.kind {
+	case kindNumber:
+		return s.intervals[0].witness()
+	case kindString:
+		return s.strings.witness()
+	}
+	return s.bools[1]
+}
+
+// interval is a range of numbers. Infinite bounds are open.
+type interval struct {
+	lo, hi         float64
+	loOpen, hiOpen bool
+}
+
+func (iv interval) empty() bool {
+	return iv.lo > iv.hi || (iv.lo == iv.hi && (iv.loOpen || iv.hiOpen))
+}
+
+func (iv interval) intersect(other interval) interval {
+	res := iv
+	if other.lo > res.lo || (other.lo == res.lo && other.loOpen) {
+		res.lo, res.loOpen = other.lo, other.loOpen
+	}
+	if other.hi < res.hi || (other.hi == res.hi && other.hiOpen) {
+		res.hi, res.hiOpen = other.hi, other.hiOpen
+	}
+	return res
+}
+
+// witness returns a number within the interval, preferring integers.
+func (iv interval) witness() interface{} {
+	var candidate float64
+	switch {
+	case math.IsInf(iv.lo, -1) && math.IsInf(iv.hi, 1):
+		candidate = 0
+	case math.IsInf(iv.lo, -1):
+		candidate = math.Floor(iv.hi)
+		if iv.hiOpen && candidate == iv.hi {
+			candidate--
+		}
+	default:
+		candidate = math.Ceil(iv.lo)
+		if iv.loOpen && candidate == iv.lo {
+			candidate++
+		}
+	}
+	if candidate > iv.hi || (candidate == iv.hi && iv.hiOpen) {
+		if iv.lo == iv.hi {
+			candidate = iv.lo
+		} else {
+			candidate = (iv.lo + iv.hi) / 2
+		}
+	}
+	if candidate == math.Trunc(candidate) && math.Abs(candidate) < 1<<53 {
+		return int(candidate)
+	}
+	return candidate
+}
+
+// normalize sorts the intervals, merges overlapping ones and drops empty ones.
+func normalize(intervals []interval) []interval {
+	sort.Slice(intervals, func(i, j int) bool {
+		a, b := intervals[i], intervals[j]
+		return a.lo < b.lo || (a.lo == b.lo && !a.loOpen && b.loOpen)
+	})
+
+	var merged []interval
+	for _, iv := range intervals {
+		if iv.empty() {
+			continue
+		}
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if iv.lo < last.hi || (iv.lo == last.hi && (!iv.loOpen || !last.hiOpen)) {
+				if iv.hi > last.hi || (iv.hi == last.hi && !iv.hiOpen) {
+					last.hi, last.hiOpen = iv.hi, iv.hiOpen
+				}
+				continue
+			}
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// stringSet is a finite set of strings or, if except is set, all strings except the ones contained.
+type stringSet struct {
+	values map[string]bool
+	except bool
+}
+
+func (s stringSet) intersect(other stringSet) stringSet {
+	if s.except && !other.except {
+		s, other = other, s
+	}
+	values := map[string]bool{}
+	if s.except { // both exclude values
+		for v := range s.values {
+			values[v] = true
+		}
+		for v := range other.values {
+			values[v] = true
+		}
+		return stringSet{values: values, except: true}
+	}
+	for v := range s.values {
+		if other.values[v] != other.except {
+			values[v] = true
+		}
+	}
+	return stringSet{values: values}
+}
+
+// witness returns the smallest value of a finite set or a value not excluded.
+func (s stringSet) witness() string {
+	if !s.except {
+		values := make([]string, 0, len(s.values))
+		for v := range s.values {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		return values[0]
+	}
+	for i := 0; ; i++ {
+		candidate := "other"
+		if i > 0 {
+			candidate += strconv.Itoa(i)
+		}
+		if !s.values[candidate] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package parser
+
+type nodeType int
+
+const (
+	nodeLiteral nodeType = iota
+	nodeArray
+	nodeObject
+	nodeVar
+	nodeMember
+	nodeIndex
+	nodeSlice
+	nodeCall
+	nodeUnary
+	nodeBinary
+	nodeTernary
+	nodeLet
+	nodeRange
+)
+
+// node is an element of the syntax tree built by the parser.
+// Which of the fields are set depends on typ:
+//
+//	nodeLiteral  value
+//	nodeArray    args (elements)
+//	nodeObject   args (alternating keys and values)
+//	nodeVar      name
+//	nodeMember   op ("." or "?."), name, args[0] (object)
+//	nodeIndex    op ("[" or "?["), args[0] (object), args[1] (key)
+//	nodeSlice    args[0] (string or array), args[1] (from, may be nil), args[2] (to, may be nil)
+//	nodeCall     name, args
+//	nodeUnary    op, args[0]
+//	nodeBinary   op, args[0], args[1]
+//	nodeTernary  args[0] (condition), args[1], args[2]
+//	nodeLet      name, args[0] (value), args[1] (body in which name is bound to value)
+//	nodeRange    op (".." or "..<"), args[0] (from, may be nil), args[1] (to, may be nil);
+//	             only used as right operand of "in", "not in" and "between"
+type node struct {
+	typ   nodeType
+	op    string
+	name  string
+	value interface{}
+	args  []*node
+
+	// pos and end are the positions of the first character of the node within
+	// the source and of the character following it, both counting from 1.
+	pos, end int
+}
+
+// env holds everything an expression can refer to while being evaluated.
+type env struct {
+	variables map[string]interface{}
+	functions map[string]ExpressionFunction
+	locals    *binding
+	observer  observer
+}
+
+// observer is notified about the evaluation of each node except literals, e.g. to explain an expression.
+// It has to call eval to evaluate the node and return its result.
+type observer interface {
+	observe(n *node, eval func() interface{}) interface{}
+}
+
+// binding is a value bound to a name within a part of the expression,
+// e.g. the current element `#` of a collection operation.
+type binding struct {
+	name   string
+	value  interface{}
+	parent *binding
+}
+
+func newEnv(variables map[string]interface{}, functions map[string]ExpressionFunction) *env {
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+	if functions == nil {
+		functions = map[string]ExpressionFunction{}
+	}
+	return &env{variables: variables, functions: functions}
+}
+
+// with returns a copy of the env in which name resolves to value.
+func (e *env) with(name string, value interface{}) *env {
+	return &env{
+		variables: e.variables,
+		functions: e.functions,
+		locals:    &binding{name: name, value: value, parent: e.locals},
+		observer:  e.observer,
+	}
+}
+
+func (e *env) lookup(name string) (interface{}, bool) {
+	for b := e.locals; b != nil; b = b.parent {
+		if b.name == name {
+			return b.value, true
+		}
+	}
+	val, ok := e.variables[name]
+	return val, ok
+}
+
+func newLiteral(value interface{}, tok Token) *node {
+	return &node{typ: nodeLiteral, value: value, pos: tok.pos, end: tok.end}
+}
+
+func newUnary(op string, tok Token, operand *node) *node {
+	return &node{typ: nodeUnary, op: op, args: []*node{operand}, pos: tok.pos, end: operand.end}
+}
+
+func newBinary(op string, left, right *node) *node {
+	return &node{typ: nodeBinary, op: op, args: []*node{left, right}, pos: left.pos, end: right.end}
+}
+
+func (n *node) eval(e *env) interface{} {
+	if e.observer != nil && n.typ != nodeLiteral {
+		return e.observer.observe(n, func() interface{} { return n.evalNode(e) })
+	}
+	return n.evalNode(e)
+}
+
+func (n *node) evalNode(e *env) interface{} {
+	switch n.typ {
+	case nodeLiteral:
+		return n.value
+
+	case nodeArray:
+		arr := make([]interface{}, 0, len(n.args))
+		for _, arg := range n.args {
+			arr = append(arr, arg.eval(e))
+		}
+		return arr
+
+	case nodeObject:
+		obj := make(map[string]interface{}, len(n.args)/2)
+		for i := 0; i < len(n.args); i += 2 {
+			addObjectMember(obj, n.args[i].eval(e), n.args[i+1].eval(e))
+		}
+		return obj
+
+	case nodeVar:
+		return accessVar(e, n.name)
+
+	case nodeMember, nodeIndex:
+		val, _ := n.access(e)
+		return val
+
+	case nodeSlice:
+		v := n.args[0].eval(e)
+		var from, to interface{}
+		if n.args[1] != nil {
+			from = n.args[1].eval(e)
+		}
+		if n.args[2] != nil {
+			to = n.args[2].eval(e)
+		}
+		return slice(v, from, to)
+
+	case nodeCall:
+		if _, ok := e.functions[n.name]; !ok && isBuiltin(n.name) {
+			return callBuiltin(e, n.name, n.args)
+		}
+		args := make([]interface{}, 0, len(n.args))
+		for _, arg := range n.args {
+			args = append(args, arg.eval(e))
+		}
+		return callFunction(e.functions, n.name, args)
+
+	case nodeUnary:
+		return evalUnary(n.op, n.args[0].eval(e))
+
+	case nodeBinary:
+		if n.op == "??" {
+			// The right operand is only resolved if the left one is nil.
+			if val := n.args[0].evalOptional(e); val != nil {
+				return val
+			}
+			return n.args[1].eval(e)
+		}
+		if n.args[1].typ == nodeRange {
+			inRange := n.args[1].contains(e, n.args[0].eval(e))
+			if n.op == "not in" {
+				return !inRange
+			}
+			return inRange
+		}
+		left := n.args[0].eval(e)
+		right := n.args[1].eval(e)
+		return evalBinary(n.op, left, right)
+
+	case nodeTernary:
+		// All operands are resolved (no short-circuiting).
+		cond := n.args[0].eval(e)
+		left := n.args[1].eval(e)
+		right := n.args[2].eval(e)
+		if asBool(cond) {
+			return left
+		}
+		return right
+
+	case nodeLet:
+		return n.args[1].eval(e.with(n.name, n.args[0].eval(e)))
+	}
+	panic(evalError("eval", "unknown node type %d", n.typ))
+}
+
+// access evaluates a member or index access. If the object of an optional access is nil, the rest of the chain
+// is skipped, so `missing?.a.b` results in nil, and false is returned.
+func (n *node) access(e *env) (interface{}, bool) {
+	optional := n.op == "?." || n.op == "?["
+
+	var obj interface{}
+	if optional && n.args[0].typ == nodeVar {
+		obj = n.args[0].evalOptional(e)
+	} else {
+		var ok bool
+		if obj, ok = n.args[0].evalChain(e); !ok {
+			return nil, false
+		}
+	}
+	if optional && obj == nil {
+		return nil, false
+	}
+
+	var field interface{} = n.name
+	if n.typ == nodeIndex {
+		field = n.args[1].eval(e)
+	}
+	if optional {
+		return accessFieldOptional(obj, field), true
+	}
+	return accessField(obj, field), true
+}
+
+// evalChain evaluates the node like eval, but reports false if it is an access whose chain was skipped.
+func (n *node) evalChain(e *env) (val interface{}, ok bool) {
+	if n.typ != nodeMember && n.typ != nodeIndex {
+		return n.eval(e), true
+	}
+	ok = true
+	access := func() interface{} {
+		val, ok = n.access(e)
+		return val
+	}
+	if e.observer != nil {
+		return e.observer.observe(n, access), ok
+	}
+	return access(), ok
+}
+
+// evalOptional evaluates the node like eval, except that a missing variable
+// resolves to nil. It is used for the operands of null-safe operators.
+func (n *node) evalOptional(e *env) interface{} {
+	if n.typ != nodeVar {
+		return n.eval(e)
+	}
+
+	lookup := func() interface{} {
+		val, _ := e.lookup(n.name)
+		return val
+	}
+	if e.observer != nil {
+		return e.observer.observe(n, lookup)
+	}
+	return lookup()
+}
+
+// contains reports whether val lies within the range node.
+// The upper bound is only resolved if val is not below the lower bound.
+func (n *node) contains(e *env, val interface{}) bool {
+	if from := n.args[0]; from != nil && !compare(val, from.eval(e), ">=") {
+		return false
+	}
+	if to := n.args[1]; to != nil {
+		if n.op == "..<" {
+			return compare(val, to.eval(e), "<")
+		}
+		return compare(val, to.eval(e), "<=")
+	}
+	return true
+}
+
+func evalUnary(op string, val interface{}) interface{} {
+	switch op {
+	case "-":
+		return unaryMinus(val)
+	case "!":
+		return !asBool(val)
+	case "~":
+		return ^asInteger(val)
+	}
+	panic(evalError("syntax", "unsupported operation %q", op))
+}
+
+func evalBinary(op string, left, right interface{}) interface{} {
+	switch op {
+	case "+":
+		return add(left, right)
+	case "-":
+		return sub(left, right)
+	case "*":
+		return mul(left, right)
+	case "/":
+		return div(left, right)
+	case "%":
+		return mod(left, right)
+	case "==":
+		return deepEqual(left, right)
+	case "!=":
+		return !deepEqual(left, right)
+	case "<", ">", "<=", ">=":
+		return compare(left, right, op)
+	case "&&":
+		l := asBool(left)
+		r := asBool(right)
+		return l && r
+	case "||":
+		l := asBool(left)
+		r := asBool(right)
+		return l || r
+	case "|":
+		return asInteger(left) | asInteger(right)
+	case "&":
+		return asInteger(left) & asInteger(right)
+	case "^":
+		return asInteger(left) ^ asInteger(right)
+	case "<<":
+		return shiftLeft(asInteger(left), asInteger(right))
+	case ">>":
+		return shiftRight(asInteger(left), asInteger(right))
+	case "in":
+		return contains("in-operator", right, left)
+	case "not in":
+		return !contains("in-operator", right, left)
+	case "startsWith":
+		return startsWith(left, right)
+	case "endsWith":
+		return endsWith(left, right)
+	case "contains":
+		return contains("contains", left, right)
+	case "~=":
+		return equalFold(left, right)
+	}
+	panic(evalError("syntax", "unsupported operation %q", op))
+}
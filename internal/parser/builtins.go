@@ -0,0 +1,127 @@
+package parser
+
+// builtinArity holds the minimum and maximum number of arguments of the collection operations.
+// Their first argument is an array, all further arguments except the initial value of reduce
+// are resolved once per element, where `#` refers to the current element and `#index` to its index.
+var builtinArity = map[string][2]int{
+	"any":    {2, 2},
+	"all":    {2, 2},
+	"none":   {2, 2},
+	"filter": {2, 2},
+	"map":    {2, 2},
+	"count":  {1, 2},
+	"sum":    {1, 2},
+	"reduce": {2, 3},
+}
+
+func isBuiltin(name string) bool {
+	_, ok := builtinArity[name]
+	return ok
+}
+
+func callBuiltin(e *env, name string, args []*node) interface{} {
+	arity := builtinArity[name]
+	if len(args) < arity[0] || len(args) > arity[1] {
+		if arity[0] == arity[1] {
+			panic(evalError("function", "%s requires %d arguments, but got %d", name, arity[0], len(args)))
+		}
+		panic(evalError("function", "%s requires %d to %d arguments, but got %d", name, arity[0], arity[1], len(args)))
+	}
+
+	arr := asArray(name, args[0].eval(e))
+
+	switch name {
+	case "any":
+		for i, v := range arr {
+			if asBool(args[1].eval(withElem(e, i, v))) {
+				return true
+			}
+		}
+		return false
+
+	case "all":
+		for i, v := range arr {
+			if !asBool(args[1].eval(withElem(e, i, v))) {
+				return false
+			}
+		}
+		return true
+
+	case "none":
+		for i, v := range arr {
+			if asBool(args[1].eval(withElem(e, i, v))) {
+				return false
+			}
+		}
+		return true
+
+	case "filter":
+		res := make([]interface{}, 0)
+		for i, v := range arr {
+			if asBool(args[1].eval(withElem(e, i, v))) {
+				res = append(res, v)
+			}
+		}
+		return res
+
+	case "map":
+		res := make([]interface{}, 0, len(arr))
+		for i, v := range arr {
+			res = append(res, args[1].eval(withElem(e, i, v)))
+		}
+		return res
+
+	case "count":
+		if len(args) == 1 {
+			return len(arr)
+		}
+		count := 0
+		for i, v := range arr {
+			if asBool(args[1].eval(withElem(e, i, v))) {
+				count++
+			}
+		}
+		return count
+
+	case "sum":
+		var sum interface{} = 0
+		for i, v := range arr {
+			if len(args) == 2 {
+				v = args[1].eval(withElem(e, i, v))
+			}
+			if typeOf(v) != "number" {
+				panic(evalError("type", "sum requires numbers, but was %s", typeOf(v)))
+			}
+			sum = add(sum, v)
+		}
+		return sum
+
+	case "reduce":
+		var acc interface{}
+		start := 0
+		if len(args) == 3 {
+			acc = args[2].eval(e)
+		} else if len(arr) == 0 {
+			panic(evalError("eval", "reduce of empty array requires an initial value"))
+		} else {
+			acc, start = arr[0], 1
+		}
+		for i := start; i < len(arr); i++ {
+			acc = args[1].eval(withElem(e, i, arr[i]).with("#acc", acc))
+		}
+		return acc
+	}
+	panic(evalError("syntax", "no such function %q", name))
+}
+
+func withElem(e *env, idx int, val interface{}) *env {
+	return e.with("#index", idx).with("#", val)
+}
+
+func asArray(name string, val interface{}) []interface{} {
+	arr, ok := val.([]interface{})
+	if !ok {
+		panic(evalError("type", "%s requires array, but was %s", name, typeOf(val)))
+	}
+	return arr
+}
@@ -0,0 +1,294 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+)
+
+// Warning describes a valid but questionable construct within an expression.
+type Warning struct {
+	Pos     int
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Pos > 0 {
+		return w.Message + " at position " + strconv.Itoa(w.Pos)
+	}
+	return w.Message
+}
+
+// Check parses the expression and reports warnings without evaluating it.
+// Besides let-bindings shadowing outer ones, operations on types known in advance which would fail
+// during evaluation are reported. If variables is not nil, their types are taken into account and
+// let-bindings shadowing one of them are reported as well.
+func Check(str string, variables map[string]interface{}) (warnings []Warning, err error) {
+	defer recoverError(&err)
+
+	c := &checker{variables: variables, bound: map[string]*string{}}
+	c.check(parse(str))
+	return c.warnings, nil
+}
+
+// CheckCondition works like Check, but additionally reports if the expression cannot result in a bool
+// and if it is always true or always false unless it fails, e.g. `1 > 2 && x` or `x || !!true`.
+func CheckCondition(str string, variables map[string]interface{}) (warnings []Warning, err error) {
+	defer recoverError(&err)
+
+	c := &checker{variables: variables, bound: map[string]*string{}}
+	root := parse(str)
+	if typ := c.check(root); typ != "" && typ != "bool" {
+		c.warn(root, fmt.Sprintf("type error: condition must result in bool, but was %s", typ))
+	}
+	if b, ok := knownResult(root.simplify()); ok {
+		c.warn(root, fmt.Sprintf("condition is always %t", b))
+	}
+	return c.warnings, nil
+}
+
+// knownResult returns the result of a simplified condition if it is a constant bool
+// or a chain of `&&` or `||` with an operand deciding the result, e.g. `false` in `x && false`.
+func knownResult(n *node) (result bool, ok bool) {
+	switch {
+	case n.typ == nodeLiteral:
+		result, ok = n.value.(bool)
+		return result, ok
+	case n.typ == nodeBinary && (n.op == "&&" || n.op == "||"):
+		deciding := n.op == "||"
+		for _, arg := range n.args {
+			if b, ok := knownResult(arg); ok && b == deciding {
+				return deciding, true
+			}
+		}
+	}
+	return false, false
+}
+
+// sampleValues holds a value for each type, used to find out whether an operation supports a type.
+var sampleValues = map[string]interface{}{
+	"nil":    nil,
+	"bool":   false,
+	"number": 1,
+	"string": "",
+	"array":  []interface{}{},
+	"object": map[string]interface{}{},
+}
+
+// checker infers the types of nodes where possible. An empty type means that it is unknown before evaluation.
+type checker struct {
+	variables map[string]interface{}
+	bound     map[string]*string // types of the let-bindings in scope
+	warnings  []Warning
+}
+
+func (c *checker) warn(n *node, msg string) {
+	c.warnings = append(c.warnings, Warning{Pos: n.pos, Message: msg})
+}
+
+// try runs the operation on sample values and reports the error, if any.
+func (c *checker) try(n *node, operation func() interface{}) (typ string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			var evalErr *EvalError
+			if err, ok := r.(error); ok && errors.As(err, &evalErr) && (evalErr.Kind == "type" || evalErr.Kind == "syntax") {
+				c.warn(n, evalErr.Error())
+			}
+			typ = ""
+		}
+	}()
+	return typeOf(operation())
+}
+
+func (c *checker) checkAll(nodes []*node) []string {
+	types := make([]string, len(nodes))
+	for i, n := range nodes {
+		if n != nil {
+			types[i] = c.check(n)
+		}
+	}
+	return types
+}
+
+func (c *checker) check(n *node) string {
+	switch n.typ {
+	case nodeLiteral:
+		return typeOf(n.value)
+
+	case nodeArray:
+		c.checkAll(n.args)
+		return "array"
+
+	case nodeObject:
+		types := c.checkAll(n.args)
+		for i := 0; i < len(n.args); i += 2 {
+			if types[i] != "" && types[i] != "string" {
+				c.warn(n.args[i], fmt.Sprintf("type error: object key must be string, but was %s", types[i]))
+			}
+		}
+		return "object"
+
+	case nodeVar:
+		if typ, ok := c.bound[n.name]; ok {
+			return *typ
+		}
+		if val, ok := c.variables[n.name]; ok {
+			return typeOf(val)
+		}
+		return ""
+
+	case nodeCall:
+		return c.checkCall(n)
+
+	case nodeUnary:
+		typ := c.check(n.args[0])
+		if typ == "" {
+			if n.op == "!" {
+				return "bool"
+			}
+			return "number"
+		}
+		return c.try(n, func() interface{} { return evalUnary(n.op, sampleValues[typ]) })
+
+	case nodeBinary:
+		return c.checkBinary(n)
+
+	case nodeTernary:
+		types := c.checkAll(n.args)
+		if types[0] != "" {
+			c.try(n.args[0], func() interface{} { return asBool(sampleValues[types[0]]) })
+		}
+		if types[1] == types[2] {
+			return types[1]
+		}
+		return ""
+
+	case nodeLet:
+		typ := c.check(n.args[0])
+		if _, ok := c.bound[n.name]; ok {
+			c.warn(n, fmt.Sprintf("let %q shadows an outer let-binding", n.name))
+		} else if _, ok := c.variables[n.name]; ok {
+			c.warn(n, fmt.Sprintf("let %q shadows a variable", n.name))
+		}
+
+		outer, wasBound := c.bound[n.name]
+		c.bound[n.name] = &typ
+		res := c.check(n.args[1])
+		if wasBound {
+			c.bound[n.name] = outer
+		} else {
+			delete(c.bound, n.name)
+		}
+		return res
+	}
+
+	// member and index access and slicing depend on the values
+	c.checkAll(n.args)
+	return ""
+}
+
+func (c *checker) checkCall(n *node) string {
+	types := c.checkAll(n.args)
+	if _, ok := c.variables[n.name]; ok || !isBuiltin(n.name) || len(n.args) == 0 {
+		return ""
+	}
+	if types[0] != "" {
+		c.try(n.args[0], func() interface{} { return asArray(n.name, sampleValues[types[0]]) })
+	}
+
+	switch n.name {
+	case "any", "all", "none":
+		return "bool"
+	case "filter", "map":
+		return "array"
+	case "count", "sum":
+		return "number"
+	}
+	return ""
+}
+
+func (c *checker) checkBinary(n *node) string {
+	types := c.checkAll(n.args)
+	left, right := types[0], types[1]
+
+	switch {
+	case n.op == "??":
+		if left != "" && left != "nil" {
+			return left
+		}
+		if left == right {
+			return left
+		}
+		return ""
+
+	case n.args[1].typ == nodeRange:
+		for _, bound := range n.args[1].args {
+			if bound == nil {
+				continue
+			}
+			typ := c.check(bound)
+			if left != "" && typ != "" {
+				c.try(n, func() interface{} { return compare(sampleValues[left], sampleValues[typ], "<=") })
+				left = "" // report a mismatch only once
+			}
+		}
+		return "bool"
+	}
+
+	if left == "" && right == "" {
+		return resultType(n.op)
+	}
+	if left == "" {
+		left = assumedType(n.op, right, false)
+	}
+	if right == "" {
+		right = assumedType(n.op, left, true)
+	}
+	typ := c.try(n, func() interface{} { return evalBinary(n.op, sampleValues[left], sampleValues[right]) })
+	if typ == "" || resultType(n.op) != "" {
+		return resultType(n.op)
+	}
+	if types[0] == "" || types[1] == "" {
+		// e.g. the sum of an unknown value and a number might be a string
+		return ""
+	}
+	return typ
+}
+
+// resultType returns the type of the result of the operation, if it does not depend on its operands.
+func resultType(op string) string {
+	switch op {
+	case "==", "!=", "~=", "<", ">", "<=", ">=", "&&", "||", "in", "not in", "startsWith", "endsWith", "contains":
+		return "bool"
+	case "-", "*", "/", "%", "|", "&", "^", "<<", ">>":
+		return "number"
+	}
+	return ""
+}
+
+// assumedType returns the most permissive type for an operand of an unknown type,
+// given that the other operand is of type other.
+func assumedType(op string, other string, isRight bool) string {
+	switch op {
+	case "&&", "||":
+		return "bool"
+	case "-", "*", "/", "%", "|", "&", "^", "<<", ">>":
+		return "number"
+	case "startsWith", "endsWith":
+		return "string"
+	case "in", "not in", "contains":
+		isCollection := isRight == (op != "contains")
+		if isCollection {
+			return "array"
+		}
+		if other == "string" || other == "object" {
+			return "string"
+		}
+		return "nil"
+	}
+	return other
+}
@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Coverage records how often the sub-expressions of an expression were evaluated across evaluations.
+// The expression is parsed once, so evaluating it repeatedly is cheaper than calling Evaluate.
+// It is safe for concurrent use.
+type Coverage struct {
+	expr  string
+	root  *node
+	nodes []*NodeCoverage
+	index map[*node]*NodeCoverage
+
+	mu sync.Mutex
+}
+
+// NodeCoverage holds the counts of a sub-expression. Literals are omitted unless they make up the whole expression.
+// Conditions are the whole expression, the operands of `&&`, `||` and `!` and the conditions of `?:`,
+// which are fully covered once they resulted in both true and false.
+type NodeCoverage struct {
+	Expr      string `json:"expr"`
+	Pos       int    `json:"pos"`
+	End       int    `json:"end"`
+	Condition bool   `json:"condition"`
+	Hits      int    `json:"hits"`
+	True      int    `json:"true"`
+	False     int    `json:"false"`
+	Errors    int    `json:"errors"`
+}
+
+// Covered reports whether the sub-expression was evaluated and, for conditions, resulted in both true and false.
+func (nc NodeCoverage) Covered() bool {
+	if nc.Condition {
+		return nc.True > 0 && nc.False > 0
+	}
+	return nc.Hits > 0
+}
+
+// CoverageStats summarizes a Coverage.
+type CoverageStats struct {
+	Nodes       int `json:"nodes"`       // number of sub-expressions
+	NodesHit    int `json:"nodesHit"`    // number of sub-expressions evaluated at least once
+	Outcomes    int `json:"outcomes"`    // number of possible outcomes of conditions, i.e. two per condition
+	OutcomesHit int `json:"outcomesHit"` // number of outcomes of conditions seen at least once
+}
+
+// NewCoverage parses the expression to record the coverage of its evaluations.
+func NewCoverage(str string) (c *Coverage, err error) {
+	defer recoverError(&err)
+
+	c = &Coverage{expr: str, root: parse(str), index: map[*node]*NodeCoverage{}}
+	c.add(c.root, true)
+	return c, nil
+}
+
+func (c *Coverage) add(n *node, condition bool) {
+	// ranges are not evaluated on their own, only their bounds are
+	if n.typ != nodeRange && (n.typ != nodeLiteral || n == c.root) {
+		nc := &NodeCoverage{Expr: c.expr[n.pos-1 : n.end-1], Pos: n.pos, End: n.end, Condition: condition}
+		c.nodes = append(c.nodes, nc)
+		c.index[n] = nc
+	}
+
+	for i, arg := range n.args {
+		if arg == nil {
+			continue
+		}
+		isCondition := (n.typ == nodeBinary && (n.op == "&&" || n.op == "||")) ||
+			(n.typ == nodeUnary && n.op == "!") ||
+			(n.typ == nodeTernary && i == 0)
+		c.add(arg, isCondition)
+	}
+}
+
+// Expr returns the expression covered.
+func (c *Coverage) Expr() string {
+	return c.expr
+}
+
+// Evaluate evaluates the expression like Evaluate and records the evaluation of its sub-expressions.
+func (c *Coverage) Evaluate(
+	variables map[string]interface{},
+	functions map[string]ExpressionFunction,
+) (result interface{}, err error) {
+	defer recoverError(&err)
+
+	e := newEnv(variables, functions)
+	e.observer = c
+	return c.observe(c.root, func() interface{} { return c.root.evalNode(e) }), nil
+}
+
+func (c *Coverage) observe(n *node, eval func() interface{}) (val interface{}) {
+	nc := c.index[n]
+	if nc == nil {
+		return eval()
+	}
+
+	failed := true
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		nc.Hits++
+		if failed {
+			nc.Errors++
+		} else if b, ok := val.(bool); ok && b {
+			nc.True++
+		} else if ok {
+			nc.False++
+		}
+	}()
+
+	val = eval()
+	failed = false
+	return val
+}
+
+// Nodes returns the counts of the sub-expressions, outer ones before inner ones.
+func (c *Coverage) Nodes() []NodeCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	nodes := make([]NodeCoverage, 0, len(c.nodes))
+	for _, nc := range c.nodes {
+		nodes = append(nodes, *nc)
+	}
+	return nodes
+}
+
+// Stats summarizes the counts of the sub-expressions.
+func (c *Coverage) Stats() CoverageStats {
+	var stats CoverageStats
+	for _, nc := range c.Nodes() {
+		stats.Nodes++
+		if nc.Hits > 0 {
+			stats.NodesHit++
+		}
+		if nc.Condition {
+			stats.Outcomes += 2
+			if nc.True > 0 {
+				stats.OutcomesHit++
+			}
+			if nc.False > 0 {
+				stats.OutcomesHit++
+			}
+		}
+	}
+	return stats
+}
+
+// Reset sets all counts to zero.
+func (c *Coverage) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, nc := range c.nodes {
+		nc.Hits, nc.True, nc.False, nc.Errors = 0, 0, 0, 0
+	}
+}
+
+func (c *Coverage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Expr  string         `json:"expr"`
+		Nodes []NodeCoverage `json:"nodes"`
+		Stats CoverageStats  `json:"stats"`
+	}{c.expr, c.Nodes(), c.Stats()})
+}
@@ -0,0 +1,318 @@
+package parser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrInvalidProgram is returned by UnmarshalBinary for data which was not written by MarshalBinary.
+var ErrInvalidProgram = errors.New("invalid compiled program")
+
+// programEncoding is the version of the encoding written by MarshalBinary, to be raised whenever it changes.
+const programEncoding = 1
+
+// literal values are tagged by their type
+const (
+	tagNil byte = iota
+	tagFalse
+	tagTrue
+	tagInt
+	tagFloat
+	tagString
+)
+
+// MarshalBinary encodes the program, i.e. its source and simplified syntax tree, so UnmarshalBinary
+// can restore it without parsing the source again.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	e := &encoder{buf: []byte{programEncoding}}
+	e.string(p.source)
+	e.node(p.root)
+	return e.buf, nil
+}
+
+// UnmarshalBinary restores a program encoded by MarshalBinary.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != programEncoding {
+		return fmt.Errorf("%w: unsupported encoding", ErrInvalidProgram)
+	}
+
+	d := &decoder{buf: data[1:]}
+	source := d.string()
+	root := d.node()
+	if d.err == nil && root == nil {
+		d.err = errors.New("missing syntax tree")
+	}
+	if d.err == nil && root.typ == nodeRange {
+		d.err = errors.New("range as syntax tree")
+	}
+	if d.err == nil && len(d.buf) > 0 {
+		d.err = errors.New("trailing data")
+	}
+	if d.err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProgram, d.err)
+	}
+
+	p.source, p.root = source, root
+	return nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *encoder) int(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// node writes 0 for a missing node, e.g. the omitted bound of a slice, and 1 followed by the fields otherwise.
+func (e *encoder) node(n *node) {
+	if n == nil {
+		e.buf = append(e.buf, 0)
+		return
+	}
+	e.buf = append(e.buf, 1)
+	e.uint(uint64(n.typ))
+	e.string(n.op)
+	e.string(n.name)
+	e.value(n.value)
+	e.uint(uint64(n.pos))
+	e.uint(uint64(n.end))
+	e.uint(uint64(len(n.args)))
+	for _, arg := range n.args {
+		e.node(arg)
+	}
+}
+
+func (e *encoder) value(val interface{}) {
+	switch v := val.(type) {
+	case bool:
+		if v {
+			e.buf = append(e.buf, tagTrue)
+		} else {
+			e.buf = append(e.buf, tagFalse)
+		}
+	case int:
+		e.buf = append(e.buf, tagInt)
+		e.int(int64(v))
+	case float64:
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		e.buf = append(append(e.buf, tagFloat), b[:]...)
+	case string:
+		e.buf = append(e.buf, tagString)
+		e.string(v)
+	default:
+		// literals are nil, bool, int, float64 or string, so only nil is left
+		e.buf = append(e.buf, tagNil)
+	}
+}
+
+// decoder reads what encoder wrote. After the first error, it only returns zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+	d.buf = nil
+}
+
+func (d *decoder) byte() byte {
+	if len(d.buf) == 0 {
+		d.fail("unexpected end of data")
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail("invalid number")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) int() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail("invalid number")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) position() int {
+	v := d.uint()
+	if v > math.MaxInt32 {
+		d.fail("invalid position %d", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) string() string {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.fail("unexpected end of data")
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) node() *node {
+	if d.byte() == 0 || d.err != nil {
+		return nil
+	}
+
+	n := &node{}
+	if typ := d.uint(); typ > uint64(nodeRange) {
+		d.fail("invalid node type %d", typ)
+		return nil
+	} else {
+		n.typ = nodeType(typ)
+	}
+	n.op = d.string()
+	n.name = d.string()
+	n.value = d.value()
+	n.pos = d.position()
+	n.end = d.position()
+	// every operand takes a byte at least
+	args := d.uint()
+	if args > uint64(len(d.buf)) {
+		d.fail("invalid number of operands %d", args)
+		return nil
+	}
+	if args > 0 {
+		n.args = make([]*node, args)
+		for i := range n.args {
+			n.args[i] = d.node()
+		}
+	}
+	if d.err != nil {
+		return nil
+	}
+	if err := n.checkDecoded(); err != nil {
+		d.fail("node type %d: %v", n.typ, err)
+		return nil
+	}
+	return n
+}
+
+// checkDecoded checks that the node has the shape the parser builds, see node, as the evaluation relies on it.
+func (n *node) checkDecoded() error {
+	if want, ok := operands[n.typ]; ok && len(n.args) != want {
+		return fmt.Errorf("%d operands", len(n.args))
+	}
+	if n.typ == nodeObject && len(n.args)%2 != 0 {
+		return fmt.Errorf("%d operands", len(n.args))
+	}
+	if !validOp(n.typ, n.op) {
+		return fmt.Errorf("invalid operator %q", n.op)
+	}
+	for i, arg := range n.args {
+		switch {
+		case arg == nil:
+			// only the bounds of slices and ranges may be omitted
+			if n.typ != nodeRange && (n.typ != nodeSlice || i == 0) {
+				return fmt.Errorf("missing operand %d", i)
+			}
+		case arg.typ == nodeRange:
+			if n.typ != nodeBinary || i != 1 || (n.op != "in" && n.op != "not in" && n.op != "between") {
+				return fmt.Errorf("range as operand %d", i)
+			}
+		}
+	}
+	if n.op == "between" && n.args[1].typ != nodeRange {
+		return errors.New("between without range")
+	}
+	return nil
+}
+
+// operands are the number of operands of the node types having a fixed number.
+var operands = map[nodeType]int{
+	nodeLiteral: 0,
+	nodeVar:     0,
+	nodeMember:  1,
+	nodeIndex:   2,
+	nodeSlice:   3,
+	nodeUnary:   1,
+	nodeBinary:  2,
+	nodeTernary: 3,
+	nodeLet:     2,
+	nodeRange:   2,
+}
+
+// ops are the operators of the node types having one, the others have none.
+var ops = map[nodeType][]string{
+	nodeMember: {".", "?."},
+	nodeIndex:  {"[", "?["},
+	nodeUnary:  {"-", "!", "~"},
+	nodeBinary: {
+		"+", "-", "*", "/", "%", "==", "!=", "<", ">", "<=", ">=", "&&", "||", "|", "&", "^", "<<", ">>",
+		"in", "not in", "between", "startsWith", "endsWith", "contains", "~=", "??",
+	},
+	nodeRange: {"..", "..<"},
+}
+
+func validOp(typ nodeType, op string) bool {
+	valid, ok := ops[typ]
+	if !ok {
+		return op == ""
+	}
+	for _, v := range valid {
+		if op == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *decoder) value() interface{} {
+	switch tag := d.byte(); tag {
+	case tagNil:
+		return nil
+	case tagFalse:
+		return false
+	case tagTrue:
+		return true
+	case tagInt:
+		return int(d.int())
+	case tagFloat:
+		if len(d.buf) < 8 {
+			d.fail("unexpected end of data")
+			return nil
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+		d.buf = d.buf[8:]
+		return v
+	case tagString:
+		return d.string()
+	default:
+		d.fail("invalid literal tag %d", tag)
+		return nil
+	}
+}
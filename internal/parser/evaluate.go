@@ -1,24 +1,63 @@
 package parser
 
 import (
+	"fmt"
 	"runtime"
 )
 
+// Error is returned for expressions which cannot be parsed.
+// Pos is the position of the token at which the expression became invalid, counting from 1.
+type Error struct {
+	Message string
+	Pos     int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// EvalError is an error evaluating an expression. Kind is "syntax", "type", "var", "function", "eval" or "range",
+// and the message starts with it, e.g. "type error: cannot add or concatenate type bool and number".
+type EvalError struct {
+	Kind string
+	Err  error
+}
+
+func evalError(kind, format string, args ...interface{}) *EvalError {
+	return &EvalError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *EvalError) Error() string {
+	return e.Kind + " error: " + e.Err.Error()
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
 func Evaluate(
 	str string,
 	variables map[string]interface{},
 	functions map[string]ExpressionFunction,
 ) (result interface{}, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if _, ok := r.(runtime.Error); ok {
-				panic(r)
-			}
-			err = r.(error)
-		}
-	}()
+	defer recoverError(&err)
 
-	lexer := NewLexer(str, variables, functions)
+	return parse(str).eval(newEnv(variables, functions)), nil
+}
+
+func parse(str string) *node {
+	lexer := NewLexer(str)
 	yyNewParser().Parse(lexer)
-	return lexer.Result(), nil
+	return lexer.Result()
+}
+
+// recoverError turns the panics raised while parsing or evaluating an expression into an error.
+// Runtime errors are not recovered, as they indicate a bug.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		if _, ok := r.(runtime.Error); ok {
+			panic(r)
+		}
+		*err = r.(error)
+	}
 }
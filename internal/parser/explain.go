@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Explanation describes how an expression or one of its sub-expressions was evaluated.
+// Literals are omitted, as their value is obvious.
+type Explanation struct {
+	Expr     string         `json:"expr"`
+	Pos      int            `json:"pos"`
+	Value    interface{}    `json:"value"`
+	Error    string         `json:"error,omitempty"`
+	Children []*Explanation `json:"children,omitempty"`
+}
+
+// String renders the explanation as a tree with one sub-expression per line.
+func (x *Explanation) String() string {
+	var sb strings.Builder
+	x.write(&sb, "", "")
+	return sb.String()
+}
+
+func (x *Explanation) write(sb *strings.Builder, prefix, childPrefix string) {
+	sb.WriteString(prefix)
+	sb.WriteString(x.Expr)
+	if x.Error != "" {
+		sb.WriteString("  ! ")
+		sb.WriteString(x.Error)
+	} else {
+		sb.WriteString("  => ")
+		sb.WriteString(FormatValue(x.Value))
+	}
+	sb.WriteString("\n")
+
+	for i, child := range x.Children {
+		if i < len(x.Children)-1 {
+			child.write(sb, childPrefix+"├── ", childPrefix+"│   ")
+		} else {
+			child.write(sb, childPrefix+"└── ", childPrefix+"    ")
+		}
+	}
+}
+
+// FormatValue formats a value of an expression the way it would be written as a literal.
+func FormatValue(val interface{}) string {
+	if val == nil {
+		return "nil"
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(b)
+}
+
+// Explain evaluates the expression like Evaluate and additionally returns how each sub-expression was evaluated.
+// If the evaluation fails, the explanation up to the failing sub-expression is returned along with the error.
+func Explain(
+	str string,
+	variables map[string]interface{},
+	functions map[string]ExpressionFunction,
+) (explanation *Explanation, err error) {
+	defer recoverError(&err)
+
+	root := parse(str)
+	t := &tracer{src: str, current: &Explanation{}}
+	defer func() {
+		// runs before recoverError, so a partial explanation is returned along with the error
+		explanation = t.current.Children[0]
+	}()
+
+	e := newEnv(variables, functions)
+	e.observer = t
+	t.observe(root, func() interface{} { return root.evalNode(e) }) // literals are explained at the root only
+	return explanation, nil
+}
+
+// tracer records an Explanation while evaluating an expression.
+type tracer struct {
+	src     string
+	current *Explanation
+}
+
+func (t *tracer) observe(n *node, eval func() interface{}) (val interface{}) {
+	parent := t.current
+	x := &Explanation{Expr: t.src[n.pos-1 : n.end-1], Pos: n.pos}
+	parent.Children = append(parent.Children, x)
+	t.current = x
+
+	defer func() {
+		t.current = parent
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok {
+				x.Error = err.Error()
+			}
+			panic(r)
+		}
+		x.Value = val
+	}()
+
+	return eval()
+}
@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FormatWidth is the line width beyond which Format breaks chains of `&&` and `||` into multiple lines.
+const FormatWidth = 80
+
+// Format parses the expression and prints it canonically: operators are surrounded by single spaces,
+// only the parentheses required by precedence are kept, strings are double-quoted and chains of
+// `&&` and `||` exceeding FormatWidth are broken into one line per operand.
+func Format(str string) (formatted string, err error) {
+	defer recoverError(&err)
+
+	return parse(str).format(), nil
+}
+
+func (n *node) format() string {
+	p := &printer{width: FormatWidth}
+	return p.print(n, "")
+}
+
+// Precedence levels of the nodes, binding tighter with increasing level.
+const (
+	precLet = iota
+	precTernary
+	precCoalesce
+	precOr
+	precAnd
+	precBitOr
+	precBitXor
+	precBitAnd
+	precEquality
+	precRelational
+	precRange
+	precShift
+	precAdditive
+	precMultiplicative
+	precUnary
+	precPostfix
+)
+
+var binaryPrecedence = map[string]int{
+	"??": precCoalesce,
+	"||": precOr,
+	"&&": precAnd,
+	"|":  precBitOr,
+	"^":  precBitXor,
+	"&":  precBitAnd,
+	"==": precEquality, "!=": precEquality, "~=": precEquality,
+	"<": precRelational, "<=": precRelational, ">": precRelational, ">=": precRelational,
+	"startsWith": precRelational, "endsWith": precRelational, "contains": precRelational,
+	"in": precRelational, "not in": precRelational, "between": precRelational,
+	"<<": precShift, ">>": precShift,
+	"+": precAdditive, "-": precAdditive,
+	"*": precMultiplicative, "/": precMultiplicative, "%": precMultiplicative,
+}
+
+func (n *node) precedence() int {
+	switch n.typ {
+	case nodeLet:
+		return precLet
+	case nodeTernary:
+		return precTernary
+	case nodeBinary:
+		return binaryPrecedence[n.op]
+	case nodeUnary:
+		return precUnary
+	case nodeRange:
+		return precRange
+	case nodeLiteral:
+		if isNegativeNumber(n.value) {
+			return precUnary
+		}
+	}
+	return precPostfix
+}
+
+func isNegativeNumber(val interface{}) bool {
+	switch v := val.(type) {
+	case int:
+		return v < 0
+	case float64:
+		return v < 0 || (v == 0 && math.Signbit(v))
+	}
+	return false
+}
+
+type printer struct {
+	width int
+}
+
+// operand prints the node as operand, enclosed in parentheses if it binds looser than minPrec.
+func (p *printer) operand(n *node, minPrec int, indent string) string {
+	if n.precedence() < minPrec {
+		return "(" + p.print(n, indent+"  ") + ")"
+	}
+	return p.print(n, indent)
+}
+
+func (p *printer) list(nodes []*node, minPrec int, indent string) string {
+	parts := make([]string, 0, len(nodes))
+	for _, arg := range nodes {
+		parts = append(parts, p.operand(arg, minPrec, indent))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// print prints the node; indent is used for the continuation lines of broken chains.
+func (p *printer) print(n *node, indent string) string {
+	switch n.typ {
+	case nodeLiteral:
+		return formatLiteral(n.value)
+
+	case nodeArray:
+		return "[" + p.list(n.args, precLet, indent) + "]"
+
+	case nodeObject:
+		parts := make([]string, 0, len(n.args)/2)
+		for i := 0; i < len(n.args); i += 2 {
+			// a ternary would be ambiguous with the colon
+			parts = append(parts, p.operand(n.args[i], precCoalesce, indent)+": "+p.operand(n.args[i+1], precCoalesce, indent))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+
+	case nodeVar:
+		return n.name
+
+	case nodeMember:
+		return p.operand(n.args[0], precPostfix, indent) + n.op + n.name
+
+	case nodeIndex:
+		return p.operand(n.args[0], precPostfix, indent) + n.op + p.print(n.args[1], indent) + "]"
+
+	case nodeSlice:
+		s := p.operand(n.args[0], precPostfix, indent) + "["
+		if n.args[1] != nil {
+			s += p.operand(n.args[1], precCoalesce, indent)
+		}
+		s += ":"
+		if n.args[2] != nil {
+			s += p.operand(n.args[2], precCoalesce, indent)
+		}
+		return s + "]"
+
+	case nodeCall:
+		return n.name + "(" + p.list(n.args, precLet, indent) + ")"
+
+	case nodeUnary:
+		operand := p.operand(n.args[0], precUnary, indent)
+		if n.op == "-" && strings.HasPrefix(operand, "-") {
+			// "--" would be read as decrement operator
+			operand = "(" + operand + ")"
+		}
+		return n.op + operand
+
+	case nodeBinary:
+		if n.op == "&&" || n.op == "||" {
+			return p.chain(n, indent)
+		}
+		if n.op == "between" {
+			bounds := n.args[1].args
+			return p.operand(n.args[0], precRelational, indent) + " between " +
+				p.operand(bounds[0], precRange, indent) + " and " + p.operand(bounds[1], precRange, indent)
+		}
+		prec := binaryPrecedence[n.op]
+		left, right := prec, prec+1
+		if n.op == "??" { // right-associative
+			left, right = prec+1, prec
+		}
+		if (n.op == "in" || n.op == "not in") && n.args[0].typ == nodeUnary && n.args[0].op == "!" {
+			// `!x in y` is rejected as ambiguous
+			left = precPostfix
+		}
+		return p.operand(n.args[0], left, indent) + " " + n.op + " " + p.operand(n.args[1], right, indent)
+
+	case nodeRange:
+		s := ""
+		if n.args[0] != nil {
+			s += p.operand(n.args[0], precShift, indent)
+		}
+		s += n.op
+		if n.args[1] != nil {
+			s += p.operand(n.args[1], precShift, indent)
+		}
+		return s
+
+	case nodeTernary:
+		return p.operand(n.args[0], precCoalesce, indent) + " ? " +
+			p.operand(n.args[1], precCoalesce, indent) + " : " + p.operand(n.args[2], precTernary, indent)
+
+	case nodeLet:
+		return "let " + n.name + " = " + p.operand(n.args[0], precTernary, indent) + "; " + p.print(n.args[1], indent)
+	}
+	return ""
+}
+
+// chain prints a chain of the same logical operator, e.g. `a && b && c`.
+// If it does not fit into a line, each operand is put on a line of its own, starting with the operator.
+func (p *printer) chain(n *node, indent string) string {
+	prec := binaryPrecedence[n.op]
+	operands := flattenChain(n)
+
+	parts := make([]string, 0, len(operands))
+	for _, operand := range operands {
+		parts = append(parts, p.operand(operand, prec+1, indent))
+	}
+
+	inline := strings.Join(parts, " "+n.op+" ")
+	if len(indent)+len(inline) <= p.width && !strings.Contains(inline, "\n") {
+		return inline
+	}
+
+	// print the operands again, as their continuation lines are indented further
+	nested := indent + "  "
+	for i, operand := range operands {
+		if i == 0 {
+			continue
+		}
+		parts[i] = p.operand(operand, prec+1, nested)
+	}
+	return strings.Join(parts, "\n"+nested+n.op+" ")
+}
+
+// flattenChain returns the operands of a left-associative chain of the operator of n.
+func flattenChain(n *node) []*node {
+	if left := n.args[0]; left.typ == nodeBinary && left.op == n.op {
+		return append(flattenChain(left), n.args[1])
+	}
+	return []*node{n.args[0], n.args[1]}
+}
+
+func formatLiteral(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return formatFloat(v)
+	case string:
+		return strconv.Quote(v)
+	}
+	return FormatValue(val)
+}
+
+// formatFloat formats the number so it is read as float64 again, e.g. 1.0 instead of 1.
+func formatFloat(f float64) string {
+	abs := math.Abs(f)
+	var s string
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	} else {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
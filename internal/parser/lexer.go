@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"go/scanner"
 	"go/token"
@@ -15,42 +14,72 @@ const BitSizeOfInt = int(unsafe.Sizeof(0)) * 8
 type Token struct {
 	literal string
 	value   interface{}
+
+	// pos and end are the positions of the first character of the token
+	// and of the character following it, both counting from 1.
+	pos, end int
+}
+
+type scanResult struct {
+	pos token.Pos
+	tok token.Token
+	lit string
 }
 
 type Lexer struct {
 	scanner scanner.Scanner
-	result  interface{}
+	result  *node
+
+	src    []byte
+	offset int // offset of the scanned part within src
 
 	nextTokenType int
 	nextTokenInfo Token
 
-	variables map[string]interface{}
-	functions map[string]ExpressionFunction
-}
+	peeked *scanResult
 
-func NewLexer(src string, variables map[string]interface{}, functions map[string]ExpressionFunction) *Lexer {
-	if variables == nil {
-		variables = map[string]interface{}{}
-	}
-	if functions == nil {
-		functions = map[string]ExpressionFunction{}
-	}
+	betweens int // number of between-operators still waiting for their "and"
 
-	lexer := &Lexer{
-		variables: variables,
-		functions: functions,
-	}
+	operand bool // whether the token returned last ends an operand, so that an operator can follow
 
-	fset := token.NewFileSet()
-	file := fset.AddFile("", fset.Base(), len(src))
+	ternaries []int // number of ternary operators waiting for their ":" per nesting level of brackets
 
-	lexer.scanner.Init(file, []byte(src), nil, 0)
+	lastPos int // position of the token returned last, for syntax errors
+}
+
+func NewLexer(src string) *Lexer {
+	lexer := &Lexer{src: []byte(src), ternaries: []int{0}}
+	lexer.rescan(0)
 	return lexer
 }
 
+// rescan continues scanning at the given offset of the source.
+// This is needed where go/scanner splits the source differently than we do, e.g. "1..2" is scanned as "1." and ".2".
+func (l *Lexer) rescan(offset int) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(l.src)-offset)
+
+	l.scanner.Init(file, l.src[offset:], nil, 0)
+	l.offset = offset
+	l.peeked = nil
+}
+
+// followedBy reports whether the source continues with s after the token of the given length at pos.
+func (l *Lexer) followedBy(pos token.Pos, length int, s string) bool {
+	offset := int(pos) - 1 + length
+	return offset <= len(l.src) && strings.HasPrefix(string(l.src[offset:]), s)
+}
+
 func (l *Lexer) scan() (token.Pos, token.Token, string) {
+	if l.peeked != nil {
+		next := l.peeked
+		l.peeked = nil
+		return next.pos, next.tok, next.lit
+	}
+
 	for {
 		pos, tok, lit := l.scanner.Scan()
+		pos += token.Pos(l.offset)
 		if tok == token.SEMICOLON && lit == "\n" {
 			// go/scanner automatically inserted this token --> ignore it
 			continue
@@ -62,6 +91,65 @@ func (l *Lexer) scan() (token.Pos, token.Token, string) {
 		return pos, tok, lit
 	}
 }
+
+// scanAdjacent returns the next token if it directly follows the character at pos
+// and has the given type. Otherwise, the token is kept for the next scan.
+func (l *Lexer) scanAdjacent(pos token.Pos, tok token.Token, lit string) bool {
+	nextPos, nextTok, nextLit := l.scan()
+	if nextPos == pos+1 && nextTok == tok && nextLit == lit {
+		return true
+	}
+	l.peeked = &scanResult{pos: nextPos, tok: nextTok, lit: nextLit}
+	return false
+}
+
+// scanAdjacentIdent returns the literal of the next token if it is an identifier
+// directly following the character at pos. Otherwise, the token is kept for the next scan.
+func (l *Lexer) scanAdjacentIdent(pos token.Pos) (string, bool) {
+	nextPos, nextTok, nextLit := l.scan()
+	if nextPos == pos+1 && nextTok == token.IDENT {
+		return nextLit, true
+	}
+	l.peeked = &scanResult{pos: nextPos, tok: nextTok, lit: nextLit}
+	return "", false
+}
+
+// scanKeyword returns whether the next token is an identifier with one of the given literals
+// and the position following it. Otherwise, the token is kept for the next scan.
+func (l *Lexer) scanKeyword(literals ...string) (int, bool) {
+	nextPos, nextTok, nextLit := l.scan()
+	if nextTok == token.IDENT {
+		for _, lit := range literals {
+			if nextLit == lit {
+				return int(nextPos) + len(nextLit), true
+			}
+		}
+	}
+	l.peeked = &scanResult{pos: nextPos, tok: nextTok, lit: nextLit}
+	return 0, false
+}
+
+// operatorWords are the identifiers which can be operators between two operands.
+var operatorWords = map[string]bool{
+	"in": true, "IN": true, "not": true, "NOT": true,
+	"between": true, "startsWith": true, "endsWith": true, "contains": true,
+}
+
+// startsBinding reports whether the next token can be the name of a let-binding or start an operand,
+// i.e. whether a preceding "let" starts a let-binding rather than referring to a variable named "let".
+// The token is kept for the next scan.
+func (l *Lexer) startsBinding() bool {
+	nextPos, nextTok, nextLit := l.scan()
+	l.peeked = &scanResult{pos: nextPos, tok: nextTok, lit: nextLit}
+	switch nextTok {
+	case token.IDENT:
+		return !operatorWords[nextLit]
+	case token.INT, token.FLOAT, token.STRING:
+		return true
+	}
+	return false
+}
+
 func (l *Lexer) Lex(lval *yySymType) int {
 	var tokenType int
 	var err error
@@ -71,14 +159,24 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		tokenType = l.nextTokenType
 		l.nextTokenType = 0
 		lval.token = l.nextTokenInfo
+		l.lastPos = lval.token.pos
+		l.operand = false
 		return tokenType
 	}
 
 	pos, tok, lit := l.scan()
 
+	if tok == token.FLOAT && strings.HasSuffix(lit, ".") && l.followedBy(pos, len(lit), ".") {
+		// the number is the start of a range like "1..2"
+		lit = strings.TrimSuffix(lit, ".")
+		tok = token.INT
+		l.rescan(int(pos) - 1 + len(lit))
+	}
+
 	tokenInfo := Token{
 		value:   nil,
 		literal: lit,
+		pos:     int(pos),
 	}
 
 	switch tok {
@@ -154,6 +252,8 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		l.nextTokenInfo = Token{
 			value:   nil,
 			literal: "-",
+			pos:     int(pos) + 1,
+			end:     int(pos) + 2,
 		}
 
 		// Bit manipulations
@@ -177,12 +277,44 @@ func (l *Lexer) Lex(lval *yySymType) int {
 			tokenInfo.value = false
 		} else if lit == "in" || lit == "IN" {
 			tokenType = IN
+		} else if lit == "not" || lit == "NOT" {
+			tokenType = IDENT
+			if !l.operand {
+				// a variable named "not", possibly followed by "in"
+			} else if end, ok := l.scanKeyword("in", "IN"); ok {
+				tokenType = NOT_IN
+				tokenInfo.literal = "not in"
+				tokenInfo.end = end
+			}
+		} else if lit == "between" && l.operand {
+			tokenType = BETWEEN
+			l.betweens++
+		} else if lit == "and" && l.betweens > 0 && l.operand {
+			tokenType = BETWEEN_AND
+			l.betweens--
+		} else if lit == "let" && l.startsBinding() {
+			tokenType = LET
+		} else if lit == "startsWith" && l.operand {
+			tokenType = STARTS_WITH
+		} else if lit == "endsWith" && l.operand {
+			tokenType = ENDS_WITH
+		} else if lit == "contains" && l.operand {
+			tokenType = CONTAINS
 		} else {
 			tokenType = IDENT
 		}
 
 	case token.PERIOD:
 		tokenType = int('.')
+		if l.followedBy(pos, 1, ".") {
+			tokenType = RANGE
+			tokenInfo.literal = ".."
+			if l.followedBy(pos, 2, "<") {
+				tokenType = RANGE_EXCL
+				tokenInfo.literal = "..<"
+			}
+			l.rescan(int(pos) - 1 + len(tokenInfo.literal))
+		}
 
 	case token.COMMA:
 		tokenType = int(',')
@@ -190,6 +322,12 @@ func (l *Lexer) Lex(lval *yySymType) int {
 	case token.COLON:
 		tokenType = int(':')
 
+	case token.ASSIGN:
+		tokenType = int('=')
+
+	case token.SEMICOLON:
+		tokenType = int(';')
+
 	case token.LBRACK, token.RBRACK,
 		token.LBRACE, token.RBRACE,
 		token.LPAREN, token.RPAREN:
@@ -197,18 +335,54 @@ func (l *Lexer) Lex(lval *yySymType) int {
 
 	case token.TILDE:
 		tokenType = BIT_NOT
+		if l.scanAdjacent(pos, token.ASSIGN, "") {
+			tokenType = IEQL
+			tokenInfo.literal = "~="
+		}
 
 	case token.ILLEGAL:
 		if lit == "?" {
-			tokenType = int('?')
+			switch {
+			case l.scanAdjacent(pos, token.ILLEGAL, "?"):
+				tokenType = COALESCE
+				tokenInfo.literal = "??"
+			case l.scanAdjacent(pos, token.PERIOD, ""):
+				tokenType = OPT_DOT
+				tokenInfo.literal = "?."
+			case l.scanAdjacent(pos, token.LBRACK, ""):
+				if l.ternaryFollows(pos) {
+					// e.g. `cond ?[1] : [2]`, the bracket is returned next
+					l.peeked = &scanResult{pos: pos + 1, tok: token.LBRACK}
+					tokenType = int('?')
+					break
+				}
+				tokenType = OPT_LBRACK
+				tokenInfo.literal = "?["
+			default:
+				tokenType = int('?')
+			}
 			break
 		}
 		if lit == ":" {
 			tokenType = int(':')
 			break
 		}
+		if lit == "#" {
+			tokenType = ELEM
+			if name, ok := l.scanAdjacentIdent(pos); ok {
+				if name != "acc" && name != "index" {
+					l.Perrorf(pos, "unknown token %q", "#"+name)
+				}
+				tokenInfo.literal += name
+			}
+			break
+		}
 		if lit == "~" { // for backwards compatibility with old go versions where token.TILDE did not exist yet
 			tokenType = BIT_NOT
+			if l.scanAdjacent(pos, token.ASSIGN, "") {
+				tokenType = IEQL
+				tokenInfo.literal = "~="
+			}
 			break
 		}
 		fallthrough
@@ -217,21 +391,129 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		l.Perrorf(pos, "unknown token %q (%q)", tok.String(), lit)
 	}
 
+	if tokenInfo.end == 0 {
+		if tokenInfo.literal != "" {
+			tokenInfo.end = tokenInfo.pos + len(tokenInfo.literal)
+		} else {
+			tokenInfo.end = tokenInfo.pos + len(tok.String())
+		}
+	}
+
 	lval.token = tokenInfo
+	l.lastPos = tokenInfo.pos
+	l.operand = endsOperand(tokenType)
+	l.countTernaries(tokenType)
 	return tokenType
 }
 
+// countTernaries keeps track of the ternary operators waiting for their ":", see ternaryFollows.
+func (l *Lexer) countTernaries(tokenType int) {
+	top := len(l.ternaries) - 1
+	switch tokenType {
+	case '(', '[', '{', OPT_LBRACK:
+		l.ternaries = append(l.ternaries, 0)
+	case ')', ']', '}':
+		if top > 0 {
+			l.ternaries = l.ternaries[:top]
+		}
+	case '?':
+		l.ternaries[top]++
+	case ':':
+		if l.ternaries[top] > 0 {
+			l.ternaries[top]--
+		}
+	}
+}
+
+// ternaryFollows reports whether the "?" at pos, directly followed by "[", is a ternary operator followed by an array
+// rather than an optional index. This is the case if more colons follow on the same nesting level of brackets
+// than the ternary operators waiting there need, e.g. in `cond ?[1] : [2]`, which was a ternary in former versions.
+func (l *Lexer) ternaryFollows(pos token.Pos) bool {
+	offset := int(pos) // of the character following "?"
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", fset.Base(), len(l.src)-offset), l.src[offset:], nil, 0)
+
+	depth, open, colons := 0, 0, 0
+	coalesce := false
+scan:
+	for {
+		p, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break scan
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+			continue
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+			if depth < 0 {
+				break scan
+			}
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		if tok == token.COMMA || tok == token.SEMICOLON && lit != "\n" {
+			break scan
+		}
+		if tok == token.COLON || tok == token.ILLEGAL && lit == ":" {
+			if open > 0 {
+				open--
+			} else {
+				colons++
+			}
+		}
+		if tok == token.ILLEGAL && lit == "?" {
+			// "??", "?." and "?[" are no ternary operators, but "?.5" is one
+			next := offset + int(p)
+			switch {
+			case coalesce:
+				coalesce = false
+			case next < len(l.src) && l.src[next] == '?':
+				coalesce = true
+			case next < len(l.src) && l.src[next] == '[':
+			case next+1 < len(l.src) && l.src[next] == '.' && (l.src[next+1] < '0' || l.src[next+1] > '9'):
+			default:
+				open++
+			}
+		}
+	}
+	return colons > l.ternaries[len(l.ternaries)-1]
+}
+
+// endsOperand reports whether a token of the given type can be the last token of an operand.
+// Operator words like "contains" are only operators after such a token and identifiers otherwise.
+func endsOperand(tokenType int) bool {
+	switch tokenType {
+	case IDENT, LITERAL_NIL, LITERAL_BOOL, LITERAL_NUMBER, LITERAL_STRING, ELEM, ')', ']', '}':
+		return true
+	}
+	return false
+}
+
 func (l *Lexer) Error(e string) {
-	panic(errors.New(e))
+	panic(&Error{Message: e, Pos: l.lastPos})
+}
+
+// newIn creates an "in" or "not in" operation. A "!" in front of the left operand without parenthesis negates
+// the whole operation, as `!x in y` meant `!(x in y)` in former versions, when "in" bound stronger than "!".
+func (l *Lexer) newIn(op string, left, right *node) *node {
+	if left.typ == nodeUnary && left.op == "!" && l.src[left.pos-1] == '!' {
+		return &node{typ: nodeUnary, op: "!", args: []*node{l.newIn(op, left.args[0], right)}, pos: left.pos, end: right.end}
+	}
+	return newBinary(op, left, right)
 }
 
 func (l *Lexer) Perrorf(pos token.Pos, format string, a ...interface{}) {
 	if pos.IsValid() {
 		format = format + " at position " + strconv.Itoa(int(pos))
 	}
-	panic(fmt.Errorf(format, a...))
+	panic(&Error{Message: fmt.Sprintf(format, a...), Pos: int(pos)})
 }
 
-func (l *Lexer) Result() interface{} {
+func (l *Lexer) Result() *node {
 	return l.result
 }
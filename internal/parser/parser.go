@@ -11,9 +11,8 @@ import __yyfmt__ "fmt"
 type yySymType struct {
 	yys      int
 	token    Token
-	expr     interface{}
-	exprList []interface{}
-	exprMap  map[string]interface{}
+	expr     *node
+	exprList []*node
 }
 
 const LITERAL_NIL = 57346
@@ -33,6 +32,20 @@ const SHL = 57359
 const SHR = 57360
 const BIT_NOT = 57361
 const IN = 57362
+const NOT_IN = 57363
+const COALESCE = 57364
+const OPT_DOT = 57365
+const OPT_LBRACK = 57366
+const ELEM = 57367
+const LET = 57368
+const IEQL = 57369
+const STARTS_WITH = 57370
+const ENDS_WITH = 57371
+const CONTAINS = 57372
+const RANGE = 57373
+const RANGE_EXCL = 57374
+const BETWEEN = 57375
+const BETWEEN_AND = 57376
 
 var yyToknames = [...]string{
 	"$end",
@@ -55,24 +68,40 @@ var yyToknames = [...]string{
 	"SHR",
 	"BIT_NOT",
 	"IN",
+	"NOT_IN",
+	"COALESCE",
+	"OPT_DOT",
+	"OPT_LBRACK",
+	"ELEM",
+	"LET",
+	"IEQL",
+	"STARTS_WITH",
+	"ENDS_WITH",
+	"CONTAINS",
+	"RANGE",
+	"RANGE_EXCL",
+	"BETWEEN",
+	"BETWEEN_AND",
+	"'('",
+	"')'",
+	"'['",
+	"']'",
+	"'{'",
+	"'}'",
+	"'-'",
+	"'!'",
 	"'?'",
 	"':'",
 	"'|'",
 	"'^'",
 	"'&'",
 	"'+'",
-	"'-'",
 	"'*'",
 	"'/'",
 	"'%'",
-	"'!'",
 	"'.'",
-	"'['",
-	"']'",
-	"'('",
-	"')'",
-	"'{'",
-	"'}'",
+	"'='",
+	"';'",
 	"','",
 }
 
@@ -82,7 +111,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line parser.go.y:145
+//line parser.go.y:184
 
 //line yacctab:1
 var yyExca = [...]int8{
@@ -93,148 +122,221 @@ var yyExca = [...]int8{
 
 const yyPrivate = 57344
 
-const yyLast = 561
-
-var yyAct = [...]int8{
-	45, 2, 88, 80, 81, 79, 78, 71, 42, 41,
-	47, 79, 44, 38, 39, 7, 48, 49, 50, 51,
-	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
-	62, 63, 64, 65, 66, 67, 68, 69, 70, 6,
-	72, 74, 31, 32, 25, 26, 27, 28, 29, 30,
-	36, 37, 5, 40, 19, 77, 33, 35, 34, 20,
-	21, 22, 23, 24, 40, 38, 39, 4, 3, 75,
-	1, 0, 0, 0, 86, 0, 38, 39, 0, 0,
-	89, 0, 90, 91, 92, 0, 93, 31, 32, 25,
-	26, 27, 28, 29, 30, 36, 37, 98, 40, 19,
-	85, 33, 35, 34, 20, 21, 22, 23, 24, 0,
-	38, 39, 84, 31, 32, 25, 26, 27, 28, 29,
-	30, 36, 37, 0, 40, 19, 0, 33, 35, 34,
-	20, 21, 22, 23, 24, 0, 38, 39, 97, 31,
-	32, 25, 26, 27, 28, 29, 30, 36, 37, 0,
-	40, 19, 0, 33, 35, 34, 20, 21, 22, 23,
-	24, 0, 38, 39, 95, 31, 32, 25, 26, 27,
-	28, 29, 30, 36, 37, 0, 40, 19, 96, 33,
-	35, 34, 20, 21, 22, 23, 24, 0, 38, 39,
-	31, 32, 25, 26, 27, 28, 29, 30, 36, 37,
-	0, 40, 19, 83, 33, 35, 34, 20, 21, 22,
-	23, 24, 0, 38, 39, 31, 32, 25, 26, 27,
-	28, 29, 30, 36, 37, 0, 40, 19, 82, 33,
-	35, 34, 20, 21, 22, 23, 24, 0, 38, 39,
-	31, 32, 25, 26, 27, 28, 29, 30, 36, 37,
-	0, 40, 19, 0, 33, 35, 34, 20, 21, 22,
-	23, 24, 0, 38, 39, 31, 0, 25, 26, 27,
-	28, 29, 30, 36, 37, 0, 40, 0, 0, 33,
-	35, 34, 20, 21, 22, 23, 24, 0, 38, 39,
-	25, 26, 27, 28, 29, 30, 36, 37, 0, 40,
-	0, 0, 33, 35, 34, 20, 21, 22, 23, 24,
-	0, 38, 39, 25, 26, 27, 28, 29, 30, 36,
-	37, 0, 40, 0, 0, 0, 35, 34, 20, 21,
-	22, 23, 24, 0, 38, 39, 25, 26, 27, 28,
-	29, 30, 36, 37, 0, 40, 0, 0, 0, 0,
-	34, 20, 21, 22, 23, 24, 0, 38, 39, 10,
-	11, 12, 13, 9, 0, 0, 0, 40, 10, 11,
-	12, 13, 9, 0, 18, 22, 23, 24, 0, 38,
-	39, 0, 16, 18, 0, 0, 17, 0, 14, 0,
-	8, 16, 15, 46, 0, 17, 0, 14, 94, 8,
-	0, 15, 10, 11, 12, 13, 9, 27, 28, 29,
-	30, 36, 37, 0, 40, 0, 0, 18, 0, 0,
-	20, 21, 22, 23, 24, 16, 38, 39, 0, 17,
-	0, 14, 87, 8, 0, 15, 25, 26, 27, 28,
-	29, 30, 36, 37, 0, 40, 10, 11, 12, 13,
-	9, 20, 21, 22, 23, 24, 0, 38, 39, 0,
-	0, 18, 0, 0, 0, 0, 0, 0, 0, 16,
-	0, 0, 0, 17, 0, 14, 0, 8, 76, 15,
-	10, 11, 12, 13, 9, 10, 11, 12, 13, 9,
-	0, 0, 0, 0, 0, 18, 0, 0, 73, 0,
-	18, 0, 0, 16, 0, 0, 0, 17, 16, 14,
-	0, 8, 17, 15, 14, 43, 8, 0, 15, 10,
-	11, 12, 13, 9, 0, 0, 0, 0, 36, 37,
-	0, 40, 0, 0, 18, 0, 0, 20, 21, 22,
-	23, 24, 16, 38, 39, 0, 17, 40, 14, 0,
-	8, 0, 15, 20, 21, 22, 23, 24, 0, 38,
-	39,
+const yyLast = 1127
+
+var yyAct = [...]uint8{
+	57, 2, 121, 56, 101, 94, 54, 89, 88, 52,
+	53, 59, 7, 6, 5, 4, 3, 60, 61, 62,
+	63, 105, 64, 65, 66, 67, 68, 69, 70, 71,
+	72, 73, 74, 75, 76, 77, 78, 79, 80, 81,
+	82, 83, 84, 85, 86, 87, 106, 104, 90, 92,
+	93, 97, 99, 43, 44, 1, 98, 0, 103, 46,
+	48, 107, 46, 48, 105, 0, 0, 115, 116, 0,
+	0, 0, 0, 47, 0, 0, 47, 24, 0, 0,
+	0, 0, 0, 0, 23, 25, 26, 27, 45, 0,
+	0, 45, 112, 0, 43, 44, 117, 118, 0, 0,
+	46, 48, 120, 0, 0, 0, 122, 0, 123, 124,
+	125, 0, 126, 0, 47, 0, 129, 130, 24, 0,
+	131, 0, 0, 0, 0, 23, 25, 26, 27, 45,
+	0, 0, 0, 135, 136, 38, 39, 28, 29, 30,
+	31, 32, 33, 43, 44, 0, 49, 50, 22, 46,
+	48, 0, 0, 34, 35, 36, 37, 0, 0, 51,
+	0, 0, 0, 47, 0, 0, 0, 24, 0, 21,
+	0, 40, 42, 41, 23, 25, 26, 27, 45, 0,
+	132, 38, 39, 28, 29, 30, 31, 32, 33, 43,
+	44, 0, 49, 50, 22, 46, 48, 0, 0, 34,
+	35, 36, 37, 0, 0, 51, 0, 0, 0, 47,
+	110, 0, 0, 24, 0, 21, 111, 40, 42, 41,
+	23, 25, 26, 27, 45, 38, 39, 28, 29, 30,
+	31, 32, 33, 43, 44, 0, 49, 50, 22, 46,
+	48, 0, 0, 34, 35, 36, 37, 0, 0, 51,
+	0, 0, 0, 47, 134, 0, 0, 24, 0, 21,
+	0, 40, 42, 41, 23, 25, 26, 27, 45, 38,
+	39, 28, 29, 30, 31, 32, 33, 43, 44, 0,
+	49, 50, 22, 46, 48, 0, 0, 34, 35, 36,
+	37, 0, 0, 51, 0, 0, 0, 47, 0, 0,
+	0, 24, 0, 21, 133, 40, 42, 41, 23, 25,
+	26, 27, 45, 38, 39, 28, 29, 30, 31, 32,
+	33, 43, 44, 0, 49, 50, 22, 46, 48, 0,
+	0, 34, 35, 36, 37, 0, 0, 51, 0, 0,
+	0, 47, 128, 0, 0, 24, 0, 21, 0, 40,
+	42, 41, 23, 25, 26, 27, 45, 38, 39, 28,
+	29, 30, 31, 32, 33, 43, 44, 0, 49, 50,
+	22, 46, 48, 0, 0, 34, 35, 36, 37, 0,
+	0, 51, 119, 0, 0, 47, 0, 0, 0, 24,
+	0, 21, 0, 40, 42, 41, 23, 25, 26, 27,
+	45, 38, 39, 28, 29, 30, 31, 32, 33, 43,
+	44, 0, 49, 50, 22, 46, 48, 0, 0, 34,
+	35, 36, 37, 0, 0, 51, 0, 0, 0, 47,
+	114, 0, 0, 24, 0, 21, 0, 40, 42, 41,
+	23, 25, 26, 27, 45, 38, 39, 28, 29, 30,
+	31, 32, 33, 43, 44, 0, 49, 50, 22, 46,
+	48, 0, 0, 34, 35, 36, 37, 0, 0, 51,
+	0, 0, 0, 47, 0, 0, 0, 24, 0, 21,
+	109, 40, 42, 41, 23, 25, 26, 27, 45, 38,
+	39, 28, 29, 30, 31, 32, 33, 43, 44, 0,
+	49, 50, 22, 46, 48, 0, 0, 34, 35, 36,
+	37, 0, 0, 51, 0, 0, 0, 47, 0, 0,
+	0, 24, 0, 21, 108, 40, 42, 41, 23, 25,
+	26, 27, 45, 38, 39, 28, 29, 30, 31, 32,
+	33, 43, 44, 0, 49, 50, 22, 46, 48, 0,
+	0, 34, 35, 36, 37, 0, 0, 51, 0, 0,
+	100, 47, 0, 0, 0, 24, 0, 21, 0, 40,
+	42, 41, 23, 25, 26, 27, 45, 38, 39, 28,
+	29, 30, 31, 32, 33, 43, 44, 0, 49, 50,
+	22, 46, 48, 0, 0, 34, 35, 36, 37, 0,
+	0, 51, 0, 0, 0, 47, 0, 0, 0, 24,
+	0, 21, 0, 40, 42, 41, 23, 25, 26, 27,
+	45, 38, 39, 28, 29, 30, 31, 32, 33, 43,
+	44, 0, 49, 50, 22, 46, 48, 0, 0, 34,
+	35, 36, 37, 0, 0, 51, 0, 0, 0, 47,
+	0, 0, 0, 24, 0, 0, 0, 40, 42, 41,
+	23, 25, 26, 27, 45, 38, 0, 28, 29, 30,
+	31, 32, 33, 43, 44, 0, 49, 50, 0, 46,
+	48, 0, 0, 34, 35, 36, 37, 0, 0, 51,
+	0, 0, 0, 47, 0, 0, 0, 24, 0, 0,
+	0, 40, 42, 41, 23, 25, 26, 27, 45, 28,
+	29, 30, 31, 32, 33, 43, 44, 0, 49, 50,
+	0, 46, 48, 0, 0, 34, 35, 36, 37, 0,
+	0, 51, 0, 0, 0, 47, 0, 0, 0, 24,
+	0, 0, 0, 40, 42, 41, 23, 25, 26, 27,
+	45, 28, 29, 30, 31, 32, 33, 43, 44, 0,
+	49, 50, 0, 46, 48, 0, 0, 34, 35, 36,
+	37, 0, 0, 51, 0, 0, 0, 47, 0, 0,
+	0, 24, 0, 0, 0, 0, 42, 41, 23, 25,
+	26, 27, 45, 28, 29, 30, 31, 32, 33, 43,
+	44, 0, 49, 50, 0, 46, 48, 0, 0, 34,
+	35, 36, 37, 0, 0, 51, 0, 0, 0, 47,
+	0, 0, 0, 24, 0, 0, 0, 0, 0, 41,
+	23, 25, 26, 27, 45, 28, 29, 30, 31, 32,
+	33, 43, 44, 0, 49, 50, 0, 46, 48, 0,
+	0, 34, 35, 36, 37, 0, 0, 51, 0, 0,
+	0, 47, 0, 0, 0, 24, 0, 0, 0, 0,
+	0, 0, 23, 25, 26, 27, 45, 30, 31, 32,
+	33, 43, 44, 0, 49, 50, 0, 46, 48, 0,
+	0, 0, 35, 36, 37, 0, 0, 51, 0, 0,
+	0, 47, 0, 46, 48, 24, 0, 0, 46, 48,
+	0, 0, 23, 25, 26, 27, 45, 47, 0, 0,
+	0, 24, 47, 11, 12, 13, 14, 10, 23, 25,
+	26, 27, 45, 0, 25, 26, 27, 45, 19, 0,
+	0, 0, 0, 0, 20, 9, 0, 11, 12, 13,
+	14, 10, 0, 0, 8, 0, 15, 0, 16, 0,
+	17, 18, 19, 91, 0, 0, 0, 0, 20, 9,
+	0, 0, 0, 0, 95, 96, 0, 0, 8, 0,
+	15, 0, 16, 0, 17, 18, 11, 12, 13, 14,
+	10, 0, 0, 0, 11, 12, 13, 14, 10, 0,
+	0, 19, 0, 0, 0, 0, 0, 20, 9, 19,
+	0, 0, 0, 0, 0, 20, 9, 8, 0, 15,
+	127, 16, 0, 17, 18, 8, 0, 15, 113, 16,
+	0, 17, 18, 11, 12, 13, 14, 10, 0, 0,
+	0, 11, 12, 13, 14, 10, 0, 0, 19, 0,
+	0, 0, 0, 0, 20, 9, 19, 0, 0, 0,
+	0, 0, 20, 9, 8, 102, 15, 0, 16, 0,
+	17, 18, 8, 0, 15, 0, 16, 58, 17, 18,
+	11, 12, 13, 14, 10, 0, 0, 0, 11, 12,
+	13, 14, 10, 0, 0, 19, 0, 0, 0, 0,
+	0, 20, 9, 19, 0, 0, 0, 0, 0, 20,
+	9, 8, 0, 15, 55, 16, 0, 17, 18, 8,
+	0, 15, 0, 16, 0, 17, 18,
 }
 
 var yyPact = [...]int16{
-	515, -1000, 231, -1000, -1000, -1000, -1000, -1000, 515, -27,
-	-1000, -1000, -1000, -1000, 481, 355, 515, 515, 515, 515,
-	515, 515, 515, 515, 515, 515, 515, 515, 515, 515,
-	515, 515, 515, 515, 515, 515, 515, 515, -1, 476,
-	515, 33, 442, -1000, -28, 231, -1000, -35, 206, 44,
-	44, 44, 181, 347, 347, 44, 44, 44, 394, 394,
-	511, 511, 511, 511, 279, 256, 302, 425, 325, 527,
-	527, -1000, 78, 398, -19, -1000, -1000, -34, -1000, 515,
-	-1000, 515, 515, 515, -1000, 364, 130, -1000, -1000, 231,
-	156, 231, 231, 104, -1000, -1000, 515, -1000, 231,
+	1084, -1000, 568, -1000, -1000, -1000, -1000, -1000, 1084, 2,
+	-29, -1000, -1000, -1000, -1000, 1076, 1037, 1084, 1084, 1084,
+	-1000, 1084, 1084, 1084, 1084, 1084, 1084, 1084, 1084, 1084,
+	1084, 1084, 1084, 1084, 1084, 1084, 1084, 1084, 1084, 1084,
+	1084, 1084, 1084, 1084, 1084, 0, -1, 919, 1084, 943,
+	943, 1084, 524, -49, 1029, -1000, 9, 568, -1000, 6,
+	480, 39, 39, 39, 436, 612, 885, 885, 39, 39,
+	39, 864, 864, 77, 77, 77, 77, 864, 77, 77,
+	77, 698, 656, 740, 824, 782, 880, 880, -1000, -1000,
+	172, 990, 392, 36, -1000, 1084, 1084, 36, -1000, 348,
+	-1000, 1084, -1000, -34, -1000, 1084, -1000, 1084, 1084, 1084,
+	-1000, 982, 304, -1000, -1000, 1084, 1084, 77, 77, 1084,
+	126, -1000, 568, 260, 568, 568, 216, -1000, -1000, 77,
+	77, 77, 1084, 1084, -1000, 568, 568,
 }
 
 var yyPgo = [...]int8{
-	0, 70, 0, 68, 67, 52, 39, 15, 12, 10,
+	0, 55, 0, 16, 15, 14, 13, 12, 5, 3,
+	11,
 }
 
 var yyR1 = [...]int8{
 	0, 1, 2, 2, 2, 2, 2, 2, 2, 2,
-	2, 3, 3, 3, 3, 3, 3, 3, 3, 4,
-	4, 4, 4, 4, 4, 5, 5, 5, 5, 5,
-	5, 5, 5, 5, 6, 6, 6, 6, 6, 6,
-	7, 7, 7, 7, 7, 7, 7, 7, 8, 8,
-	9, 9,
+	2, 2, 2, 3, 3, 3, 3, 3, 3, 3,
+	3, 4, 4, 4, 4, 4, 4, 5, 5, 5,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	6, 6, 6, 6, 6, 6, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 8, 8, 8, 8, 8, 9, 9, 10, 10,
 }
 
 var yyR2 = [...]int8{
 	0, 1, 1, 1, 1, 1, 1, 5, 3, 3,
-	4, 1, 1, 1, 1, 2, 3, 2, 3, 2,
-	3, 3, 3, 3, 3, 2, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 3, 2,
-	1, 3, 4, 3, 6, 5, 5, 4, 1, 3,
-	3, 5,
+	6, 3, 4, 1, 1, 1, 1, 2, 3, 2,
+	3, 2, 3, 3, 3, 3, 3, 2, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 2, 1, 1, 3, 3,
+	4, 4, 3, 3, 3, 3, 5, 6, 5, 5,
+	4, 3, 3, 2, 2, 2, 1, 3, 3, 5,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, -2, -3, -4, -5, -6, -7, 35, 8,
-	4, 5, 6, 7, 33, 37, 27, 31, 19, 21,
-	26, 27, 28, 29, 30, 11, 12, 13, 14, 15,
-	16, 9, 10, 23, 25, 24, 17, 18, 32, 33,
-	20, -2, 35, 34, -8, -2, 38, -9, -2, -2,
+	-1000, -1, -2, -3, -4, -5, -6, -7, 35, 26,
+	8, 4, 5, 6, 7, 37, 39, 41, 42, 19,
+	25, 43, 22, 48, 41, 49, 50, 51, 11, 12,
+	13, 14, 15, 16, 27, 28, 29, 30, 9, 10,
+	45, 47, 46, 17, 18, 52, 23, 37, 24, 20,
+	21, 33, -2, 8, 35, 38, -9, -2, 40, -10,
 	-2, -2, -2, -2, -2, -2, -2, -2, -2, -2,
 	-2, -2, -2, -2, -2, -2, -2, -2, -2, -2,
-	-2, 8, -2, 22, -2, 36, 36, -8, 34, 39,
-	38, 39, 22, 22, 34, 22, -2, 34, 36, -2,
-	-2, -2, -2, -2, 34, 34, 22, 34, -2,
+	-2, -2, -2, -2, -2, -2, -2, -2, 8, 8,
+	-2, 44, -2, -2, -8, 31, 32, -2, -8, -2,
+	36, 53, 36, -9, 38, 55, 40, 55, 44, 44,
+	38, 44, -2, 38, 38, 31, 32, -2, -2, 34,
+	-2, 36, -2, -2, -2, -2, -2, 38, 38, -2,
+	-2, -2, 54, 44, 38, -2, -2,
 }
 
 var yyDef = [...]int8{
-	0, -2, 1, 2, 3, 4, 5, 6, 0, 40,
-	11, 12, 13, 14, 0, 0, 0, 0, 0, 0,
+	0, -2, 1, 2, 3, 4, 5, 6, 0, 0,
+	46, 13, 14, 15, 16, 0, 0, 0, 0, 0,
+	47, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 15, 0, 48, 17, 0, 0, 19,
-	25, 39, 0, 20, 21, 22, 23, 24, 26, 27,
-	28, 29, 30, 31, 32, 33, 34, 35, 36, 37,
-	38, 41, 0, 0, 43, 8, 9, 0, 16, 0,
-	18, 0, 0, 0, 42, 0, 0, 47, 10, 49,
-	0, 50, 7, 0, 46, 45, 0, 44, 51,
+	0, 0, 0, 0, 0, 17, 0, 66, 19, 0,
+	0, 21, 27, 45, 0, 8, 22, 23, 24, 25,
+	26, 28, 29, 30, 31, 32, 33, 34, 35, 36,
+	37, 38, 39, 40, 41, 42, 43, 44, 48, 49,
+	0, 0, 0, 52, 54, 0, 0, 53, 55, 0,
+	9, 0, 11, 0, 18, 0, 20, 0, 0, 0,
+	50, 0, 0, 60, 51, 63, 0, 64, 65, 0,
+	0, 12, 67, 0, 68, 7, 0, 59, 58, 61,
+	62, 56, 0, 0, 57, 10, 69,
 }
 
 var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 31, 3, 3, 3, 30, 25, 3,
-	35, 36, 28, 26, 39, 27, 32, 29, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 22, 3,
-	3, 3, 3, 21, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 42, 3, 3, 3, 51, 47, 3,
+	35, 36, 49, 48, 55, 41, 52, 50, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 44, 54,
+	3, 53, 3, 43, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 33, 3, 34, 24, 3, 3, 3, 3, 3,
+	3, 37, 3, 38, 46, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 37, 23, 38,
+	3, 3, 3, 39, 45, 40,
 }
 
 var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
-	12, 13, 14, 15, 16, 17, 18, 19, 20,
+	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
+	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+	32, 33, 34,
 }
 
 var yyTok3 = [...]int8{
@@ -580,301 +682,390 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:65
+//line parser.go.y:83
 		{
 			yyVAL.expr = yyDollar[1].expr
 			yylex.(*Lexer).result = yyVAL.expr
 		}
 	case 7:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.go.y:77
+//line parser.go.y:95
 		{
-			if asBool(yyDollar[1].expr) {
-				yyVAL.expr = yyDollar[3].expr
-			} else {
-				yyVAL.expr = yyDollar[5].expr
-			}
+			yyVAL.expr = &node{typ: nodeTernary, args: []*node{yyDollar[1].expr, yyDollar[3].expr, yyDollar[5].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[5].expr.end}
 		}
 	case 8:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:78
+//line parser.go.y:96
 		{
-			yyVAL.expr = yyDollar[2].expr
+			yyVAL.expr = newBinary("??", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 9:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:79
+//line parser.go.y:97
 		{
-			yyVAL.expr = callFunction(yylex.(*Lexer).functions, yyDollar[1].token.literal, []interface{}{})
+			yyVAL.expr = yyDollar[2].expr
+			yyVAL.expr.pos = yyDollar[1].token.pos
+			yyVAL.expr.end = yyDollar[3].token.end
 		}
 	case 10:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.go.y:80
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.go.y:98
 		{
-			yyVAL.expr = callFunction(yylex.(*Lexer).functions, yyDollar[1].token.literal, yyDollar[3].exprList)
+			yyVAL.expr = &node{typ: nodeLet, name: yyDollar[2].token.literal, args: []*node{yyDollar[4].expr, yyDollar[6].expr}, pos: yyDollar[1].token.pos, end: yyDollar[6].expr.end}
 		}
 	case 11:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:84
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:99
 		{
-			yyVAL.expr = nil
+			yyVAL.expr = &node{typ: nodeCall, name: yyDollar[1].token.literal, pos: yyDollar[1].token.pos, end: yyDollar[3].token.end}
 		}
 	case 12:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:85
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.go.y:100
 		{
-			yyVAL.expr = yyDollar[1].token.value
+			yyVAL.expr = &node{typ: nodeCall, name: yyDollar[1].token.literal, args: yyDollar[3].exprList, pos: yyDollar[1].token.pos, end: yyDollar[4].token.end}
 		}
 	case 13:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:86
+//line parser.go.y:104
 		{
-			yyVAL.expr = yyDollar[1].token.value
+			yyVAL.expr = newLiteral(nil, yyDollar[1].token)
 		}
 	case 14:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:87
+//line parser.go.y:105
 		{
-			yyVAL.expr = yyDollar[1].token.value
+			yyVAL.expr = newLiteral(yyDollar[1].token.value, yyDollar[1].token)
 		}
 	case 15:
-		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.go.y:88
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:106
 		{
-			yyVAL.expr = []interface{}{}
+			yyVAL.expr = newLiteral(yyDollar[1].token.value, yyDollar[1].token)
 		}
 	case 16:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:89
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:107
 		{
-			yyVAL.expr = yyDollar[2].exprList
+			yyVAL.expr = newLiteral(yyDollar[1].token.value, yyDollar[1].token)
 		}
 	case 17:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.go.y:90
+//line parser.go.y:108
 		{
-			yyVAL.expr = map[string]interface{}{}
+			yyVAL.expr = &node{typ: nodeArray, pos: yyDollar[1].token.pos, end: yyDollar[2].token.end}
 		}
 	case 18:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:91
+//line parser.go.y:109
 		{
-			yyVAL.expr = yyDollar[2].exprMap
+			yyVAL.expr = &node{typ: nodeArray, args: yyDollar[2].exprList, pos: yyDollar[1].token.pos, end: yyDollar[3].token.end}
 		}
 	case 19:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.go.y:95
+//line parser.go.y:110
 		{
-			yyVAL.expr = unaryMinus(yyDollar[2].expr)
+			yyVAL.expr = &node{typ: nodeObject, pos: yyDollar[1].token.pos, end: yyDollar[2].token.end}
 		}
 	case 20:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:96
+//line parser.go.y:111
 		{
-			yyVAL.expr = add(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = &node{typ: nodeObject, args: yyDollar[2].exprList, pos: yyDollar[1].token.pos, end: yyDollar[3].token.end}
 		}
 	case 21:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:97
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:115
 		{
-			yyVAL.expr = sub(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = newUnary("-", yyDollar[1].token, yyDollar[2].expr)
 		}
 	case 22:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:98
+//line parser.go.y:116
 		{
-			yyVAL.expr = mul(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = newBinary("+", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 23:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:99
+//line parser.go.y:117
 		{
-			yyVAL.expr = div(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = newBinary("-", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 24:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:100
+//line parser.go.y:118
 		{
-			yyVAL.expr = mod(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = newBinary("*", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 25:
-		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.go.y:104
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:119
 		{
-			yyVAL.expr = !asBool(yyDollar[2].expr)
+			yyVAL.expr = newBinary("/", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 26:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:105
+//line parser.go.y:120
 		{
-			yyVAL.expr = deepEqual(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = newBinary("%", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 27:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:106
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:124
 		{
-			yyVAL.expr = !deepEqual(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = newUnary("!", yyDollar[1].token, yyDollar[2].expr)
 		}
 	case 28:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:107
+//line parser.go.y:125
 		{
-			yyVAL.expr = compare(yyDollar[1].expr, yyDollar[3].expr, "<")
+			yyVAL.expr = newBinary("==", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 29:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:108
+//line parser.go.y:126
 		{
-			yyVAL.expr = compare(yyDollar[1].expr, yyDollar[3].expr, ">")
+			yyVAL.expr = newBinary("!=", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 30:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:109
+//line parser.go.y:127
 		{
-			yyVAL.expr = compare(yyDollar[1].expr, yyDollar[3].expr, "<=")
+			yyVAL.expr = newBinary("<", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 31:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:110
+//line parser.go.y:128
 		{
-			yyVAL.expr = compare(yyDollar[1].expr, yyDollar[3].expr, ">=")
+			yyVAL.expr = newBinary(">", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 32:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:111
+//line parser.go.y:129
 		{
-			left := asBool(yyDollar[1].expr)
-			right := asBool(yyDollar[3].expr)
-			yyVAL.expr = left && right
+			yyVAL.expr = newBinary("<=", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 33:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:112
+//line parser.go.y:130
 		{
-			left := asBool(yyDollar[1].expr)
-			right := asBool(yyDollar[3].expr)
-			yyVAL.expr = left || right
+			yyVAL.expr = newBinary(">=", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 34:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:116
+//line parser.go.y:131
 		{
-			yyVAL.expr = asInteger(yyDollar[1].expr) | asInteger(yyDollar[3].expr)
+			yyVAL.expr = newBinary("~=", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 35:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:117
+//line parser.go.y:132
 		{
-			yyVAL.expr = asInteger(yyDollar[1].expr) & asInteger(yyDollar[3].expr)
+			yyVAL.expr = newBinary("startsWith", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 36:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:118
+//line parser.go.y:133
 		{
-			yyVAL.expr = asInteger(yyDollar[1].expr) ^ asInteger(yyDollar[3].expr)
+			yyVAL.expr = newBinary("endsWith", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 37:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:119
+//line parser.go.y:134
 		{
-			l := asInteger(yyDollar[1].expr)
-			r := asInteger(yyDollar[3].expr)
-			if r >= 0 {
-				yyVAL.expr = l << uint(r)
-			} else {
-				yyVAL.expr = l >> uint(-r)
-			}
+			yyVAL.expr = newBinary("contains", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 38:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:120
+//line parser.go.y:135
 		{
-			l := asInteger(yyDollar[1].expr)
-			r := asInteger(yyDollar[3].expr)
-			if r >= 0 {
-				yyVAL.expr = l >> uint(r)
-			} else {
-				yyVAL.expr = l << uint(-r)
-			}
+			yyVAL.expr = newBinary("&&", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 39:
-		yyDollar = yyS[yypt-2 : yypt+1]
-//line parser.go.y:121
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:136
 		{
-			yyVAL.expr = ^asInteger(yyDollar[2].expr)
+			yyVAL.expr = newBinary("||", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 40:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:125
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:140
 		{
-			yyVAL.expr = accessVar(yylex.(*Lexer).variables, yyDollar[1].token.literal)
+			yyVAL.expr = newBinary("|", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 41:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:126
+//line parser.go.y:141
 		{
-			yyVAL.expr = accessField(yyDollar[1].expr, yyDollar[3].token.literal)
+			yyVAL.expr = newBinary("&", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 42:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.go.y:127
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:142
 		{
-			yyVAL.expr = accessField(yyDollar[1].expr, yyDollar[3].expr)
+			yyVAL.expr = newBinary("^", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 43:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:128
+//line parser.go.y:143
 		{
-			yyVAL.expr = arrayContains(yyDollar[3].expr, yyDollar[1].expr)
+			yyVAL.expr = newBinary("<<", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 44:
-		yyDollar = yyS[yypt-6 : yypt+1]
-//line parser.go.y:129
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:144
 		{
-			yyVAL.expr = slice(yyDollar[1].expr, yyDollar[3].expr, yyDollar[5].expr)
+			yyVAL.expr = newBinary(">>", yyDollar[1].expr, yyDollar[3].expr)
 		}
 	case 45:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.go.y:130
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:145
 		{
-			yyVAL.expr = slice(yyDollar[1].expr, nil, yyDollar[4].expr)
+			yyVAL.expr = newUnary("~", yyDollar[1].token, yyDollar[2].expr)
 		}
 	case 46:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.go.y:131
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:149
 		{
-			yyVAL.expr = slice(yyDollar[1].expr, yyDollar[3].expr, nil)
+			yyVAL.expr = &node{typ: nodeVar, name: yyDollar[1].token.literal, pos: yyDollar[1].token.pos, end: yyDollar[1].token.end}
 		}
 	case 47:
-		yyDollar = yyS[yypt-4 : yypt+1]
-//line parser.go.y:132
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:150
 		{
-			yyVAL.expr = slice(yyDollar[1].expr, nil, nil)
+			yyVAL.expr = &node{typ: nodeVar, name: yyDollar[1].token.literal, pos: yyDollar[1].token.pos, end: yyDollar[1].token.end}
 		}
 	case 48:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line parser.go.y:136
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:151
 		{
-			yyVAL.exprList = []interface{}{yyDollar[1].expr}
+			yyVAL.expr = &node{typ: nodeMember, op: ".", name: yyDollar[3].token.literal, args: []*node{yyDollar[1].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[3].token.end}
 		}
 	case 49:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:137
+//line parser.go.y:152
 		{
-			yyVAL.exprList = append(yyDollar[1].exprList, yyDollar[3].expr)
+			yyVAL.expr = &node{typ: nodeMember, op: "?.", name: yyDollar[3].token.literal, args: []*node{yyDollar[1].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[3].token.end}
 		}
 	case 50:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line parser.go.y:141
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.go.y:153
 		{
-			yyVAL.exprMap = make(map[string]interface{})
-			yyVAL.exprMap[asObjectKey(yyDollar[1].expr)] = yyDollar[3].expr
+			yyVAL.expr = &node{typ: nodeIndex, op: "[", args: []*node{yyDollar[1].expr, yyDollar[3].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[4].token.end}
 		}
 	case 51:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.go.y:154
+		{
+			yyVAL.expr = &node{typ: nodeIndex, op: "?[", args: []*node{yyDollar[1].expr, yyDollar[3].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[4].token.end}
+		}
+	case 52:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:155
+		{
+			yyVAL.expr = yylex.(*Lexer).newIn("in", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 53:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:156
+		{
+			yyVAL.expr = yylex.(*Lexer).newIn("not in", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 54:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:157
+		{
+			yyVAL.expr = yylex.(*Lexer).newIn("in", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 55:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:158
+		{
+			yyVAL.expr = yylex.(*Lexer).newIn("not in", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 56:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line parser.go.y:142
+//line parser.go.y:159
+		{
+			yyVAL.expr = newBinary("between", yyDollar[1].expr, &node{typ: nodeRange, op: "..", args: []*node{yyDollar[3].expr, yyDollar[5].expr}, pos: yyDollar[3].expr.pos, end: yyDollar[5].expr.end})
+		}
+	case 57:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line parser.go.y:160
+		{
+			yyVAL.expr = &node{typ: nodeSlice, args: []*node{yyDollar[1].expr, yyDollar[3].expr, yyDollar[5].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[6].token.end}
+		}
+	case 58:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.go.y:161
+		{
+			yyVAL.expr = &node{typ: nodeSlice, args: []*node{yyDollar[1].expr, nil, yyDollar[4].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[5].token.end}
+		}
+	case 59:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.go.y:162
+		{
+			yyVAL.expr = &node{typ: nodeSlice, args: []*node{yyDollar[1].expr, yyDollar[3].expr, nil}, pos: yyDollar[1].expr.pos, end: yyDollar[5].token.end}
+		}
+	case 60:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line parser.go.y:163
+		{
+			yyVAL.expr = &node{typ: nodeSlice, args: []*node{yyDollar[1].expr, nil, nil}, pos: yyDollar[1].expr.pos, end: yyDollar[4].token.end}
+		}
+	case 61:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:167
+		{
+			yyVAL.expr = &node{typ: nodeRange, op: "..", args: []*node{yyDollar[1].expr, yyDollar[3].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[3].expr.end}
+		}
+	case 62:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:168
+		{
+			yyVAL.expr = &node{typ: nodeRange, op: "..<", args: []*node{yyDollar[1].expr, yyDollar[3].expr}, pos: yyDollar[1].expr.pos, end: yyDollar[3].expr.end}
+		}
+	case 63:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:169
+		{
+			yyVAL.expr = &node{typ: nodeRange, op: "..", args: []*node{yyDollar[1].expr, nil}, pos: yyDollar[1].expr.pos, end: yyDollar[2].token.end}
+		}
+	case 64:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:170
+		{
+			yyVAL.expr = &node{typ: nodeRange, op: "..", args: []*node{nil, yyDollar[2].expr}, pos: yyDollar[1].token.pos, end: yyDollar[2].expr.end}
+		}
+	case 65:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line parser.go.y:171
+		{
+			yyVAL.expr = &node{typ: nodeRange, op: "..<", args: []*node{nil, yyDollar[2].expr}, pos: yyDollar[1].token.pos, end: yyDollar[2].expr.end}
+		}
+	case 66:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line parser.go.y:175
+		{
+			yyVAL.exprList = []*node{yyDollar[1].expr}
+		}
+	case 67:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:176
+		{
+			yyVAL.exprList = append(yyDollar[1].exprList, yyDollar[3].expr)
+		}
+	case 68:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line parser.go.y:180
+		{
+			yyVAL.exprList = []*node{yyDollar[1].expr, yyDollar[3].expr}
+		}
+	case 69:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line parser.go.y:181
 		{
-			yyVAL.exprMap = addObjectMember(yyDollar[1].exprMap, yyDollar[3].expr, yyDollar[5].expr)
+			yyVAL.exprList = append(yyDollar[1].exprList, yyDollar[3].expr, yyDollar[5].expr)
 		}
 	}
 	goto yystack /* stack new state and value */
@@ -1,13 +1,12 @@
 %{
-package internal
+package parser
 
 %}
 
 %union {
   token     Token
-  expr      interface{}
-  exprList  []interface{}
-  exprMap   map[string]interface{}
+  expr      *node
+  exprList  []*node
 }
 
 
@@ -20,8 +19,9 @@ package internal
 %type<expr> logic
 %type<expr> bitManipulation
 %type<expr> varAccess
+%type<expr> range
 %type<exprList> exprList
-%type<exprMap> exprMap
+%type<exprList> exprMap
 
 %token<token> LITERAL_NIL    // nil
 %token<token> LITERAL_BOOL   // true false
@@ -40,23 +40,41 @@ package internal
 %token<token> SHR            // >>
 %token<token> BIT_NOT        // ~
 %token<token> IN             // in
-
-/* Operator precedence is taken from C/C++: http://en.cppreference.com/w/c/language/operator_precedence */
-
+%token<token> NOT_IN         // not in
+%token<token> COALESCE       // ??
+%token<token> OPT_DOT        // ?.
+%token<token> OPT_LBRACK     // ?[
+%token<token> ELEM           // # #index #acc
+%token<token> LET            // let
+%token<token> IEQL           // ~=
+%token<token> STARTS_WITH    // startsWith
+%token<token> ENDS_WITH      // endsWith
+%token<token> CONTAINS       // contains
+%token<token> RANGE          // ..
+%token<token> RANGE_EXCL     // ..<
+%token<token> BETWEEN        // between
+%token<token> BETWEEN_AND    // and (only after between)
+%token<token> '(' ')' '[' ']' '{' '}' '-' '!'
+
+/* Operator precedence is taken from C/C++: http://en.cppreference.com/w/c/language/operator_precedence
+   The operators unknown to C bind like the relational operators. */
+
+%right LET
 %right '?' ':'
+%right COALESCE
 %left  OR
 %left  AND
 %left  '|'
 %left  '^'
 %left  '&'
-%left  EQL NEQ
-%left  LSS LEQ GTR GEQ
+%left  EQL NEQ IEQL
+%left  LSS LEQ GTR GEQ STARTS_WITH ENDS_WITH CONTAINS IN NOT_IN BETWEEN
+%nonassoc RANGE RANGE_EXCL
 %left  SHL SHR
 %left  '+' '-'
 %left  '*' '/' '%'
 %right '!' BIT_NOT
-%left  IN
-%left  '.' '[' ']'
+%left  '.' '[' ']' OPT_DOT OPT_LBRACK
 
 %%
 
@@ -74,72 +92,93 @@ expr
   | logic
   | bitManipulation
   | varAccess
-  | expr '?' expr ':' expr { if asBool($1) { $$ = $3 } else { $$ = $5 } }
-  | '(' expr ')'           { $$ = $2 }
-  | IDENT '(' ')'          { $$ = callFunction(yylex.(*Lexer).functions, $1.literal, []interface{}{}) }
-  | IDENT '(' exprList ')' { $$ = callFunction(yylex.(*Lexer).functions, $1.literal, $3) }
+  | expr '?' expr ':' expr { $$ = &node{typ: nodeTernary, args: []*node{$1, $3, $5}, pos: $1.pos, end: $5.end} }
+  | expr COALESCE expr     { $$ = newBinary("??", $1, $3) }
+  | '(' expr ')'           { $$ = $2; $$.pos = $1.pos; $$.end = $3.end }
+  | LET IDENT '=' expr ';' expr %prec LET { $$ = &node{typ: nodeLet, name: $2.literal, args: []*node{$4, $6}, pos: $1.pos, end: $6.end} }
+  | IDENT '(' ')'          { $$ = &node{typ: nodeCall, name: $1.literal, pos: $1.pos, end: $3.end} }
+  | IDENT '(' exprList ')' { $$ = &node{typ: nodeCall, name: $1.literal, args: $3, pos: $1.pos, end: $4.end} }
   ;
 
 literal
-  : LITERAL_NIL           { $$ = nil }
-  | LITERAL_BOOL          { $$ = $1.value }
-  | LITERAL_NUMBER        { $$ = $1.value }
-  | LITERAL_STRING        { $$ = $1.value }
-  | '[' ']'               { $$ = []interface{}{} }
-  | '[' exprList ']'      { $$ = $2 }
-  | '{' '}'               { $$ = map[string]interface{}{} }
-  | '{' exprMap '}'       { $$ = $2 }
+  : LITERAL_NIL           { $$ = newLiteral(nil, $1) }
+  | LITERAL_BOOL          { $$ = newLiteral($1.value, $1) }
+  | LITERAL_NUMBER        { $$ = newLiteral($1.value, $1) }
+  | LITERAL_STRING        { $$ = newLiteral($1.value, $1) }
+  | '[' ']'               { $$ = &node{typ: nodeArray, pos: $1.pos, end: $2.end} }
+  | '[' exprList ']'      { $$ = &node{typ: nodeArray, args: $2, pos: $1.pos, end: $3.end} }
+  | '{' '}'               { $$ = &node{typ: nodeObject, pos: $1.pos, end: $2.end} }
+  | '{' exprMap '}'       { $$ = &node{typ: nodeObject, args: $2, pos: $1.pos, end: $3.end} }
   ;
 
 math
-  : '-' expr %prec  '!'   { $$ = unaryMinus($2)  }  /* unary minus has higher precedence */
-  | expr '+' expr         { $$ = add($1, $3) }
-  | expr '-' expr         { $$ = sub($1, $3) }
-  | expr '*' expr         { $$ = mul($1, $3) }
-  | expr '/' expr         { $$ = div($1, $3) }
-  | expr '%' expr         { $$ = mod($1, $3) }
+  : '-' expr %prec  '!'   { $$ = newUnary("-", $1, $2) }  /* unary minus has higher precedence */
+  | expr '+' expr         { $$ = newBinary("+", $1, $3) }
+  | expr '-' expr         { $$ = newBinary("-", $1, $3) }
+  | expr '*' expr         { $$ = newBinary("*", $1, $3) }
+  | expr '/' expr         { $$ = newBinary("/", $1, $3) }
+  | expr '%' expr         { $$ = newBinary("%", $1, $3) }
   ;
 
 logic
-  : '!' expr              { $$ = !asBool($2) }
-  | expr EQL expr         { $$ = deepEqual($1, $3) }
-  | expr NEQ expr         { $$ = !deepEqual($1, $3) }
-  | expr LSS expr         { $$ = compare($1, $3, "<") }
-  | expr GTR expr         { $$ = compare($1, $3, ">") }
-  | expr LEQ expr         { $$ = compare($1, $3, "<=") }
-  | expr GEQ expr         { $$ = compare($1, $3, ">=") }
-  | expr AND expr         { left := asBool($1); right := asBool($3); $$ = left && right }
-  | expr OR expr          { left := asBool($1); right := asBool($3); $$ = left || right }
+  : '!' expr              { $$ = newUnary("!", $1, $2) }
+  | expr EQL expr         { $$ = newBinary("==", $1, $3) }
+  | expr NEQ expr         { $$ = newBinary("!=", $1, $3) }
+  | expr LSS expr         { $$ = newBinary("<", $1, $3) }
+  | expr GTR expr         { $$ = newBinary(">", $1, $3) }
+  | expr LEQ expr         { $$ = newBinary("<=", $1, $3) }
+  | expr GEQ expr         { $$ = newBinary(">=", $1, $3) }
+  | expr IEQL expr        { $$ = newBinary("~=", $1, $3) }
+  | expr STARTS_WITH expr { $$ = newBinary("startsWith", $1, $3) }
+  | expr ENDS_WITH expr   { $$ = newBinary("endsWith", $1, $3) }
+  | expr CONTAINS expr    { $$ = newBinary("contains", $1, $3) }
+  | expr AND expr         { $$ = newBinary("&&", $1, $3) }
+  | expr OR expr          { $$ = newBinary("||", $1, $3) }
   ;
 
 bitManipulation
-  : expr '|' expr         { $$ = asInteger($1) | asInteger($3) }
-  | expr '&' expr         { $$ = asInteger($1) & asInteger($3) }
-  | expr '^' expr         { $$ = asInteger($1) ^ asInteger($3) }
-  | expr SHL expr         { l := asInteger($1); r := asInteger($3); if r >= 0 { $$ = l << uint(r) } else {$$ = l >> uint(-r)} }
-  | expr SHR expr         { l := asInteger($1); r := asInteger($3); if r >= 0 { $$ = l >> uint(r) } else {$$ = l << uint(-r)} }
-  | BIT_NOT expr          { $$ = ^asInteger($2) }
+  : expr '|' expr         { $$ = newBinary("|", $1, $3) }
+  | expr '&' expr         { $$ = newBinary("&", $1, $3) }
+  | expr '^' expr         { $$ = newBinary("^", $1, $3) }
+  | expr SHL expr         { $$ = newBinary("<<", $1, $3) }
+  | expr SHR expr         { $$ = newBinary(">>", $1, $3) }
+  | BIT_NOT expr          { $$ = newUnary("~", $1, $2) }
   ;
 
 varAccess
-  : IDENT                        { $$ = accessVar(yylex.(*Lexer).variables, $1.literal) }
-  | expr '.' IDENT               { $$ = accessField($1, $3.literal) }
-  | expr '[' expr ']'            { $$ = accessField($1, $3) }
-  | expr IN expr                 { $$ = arrayContains($3, $1) }
-  | expr '[' expr ':' expr ']'   { $$ = slice($1, $3, $5) }
-  | expr '['      ':' expr ']'   { $$ = slice($1, nil, $4) }
-  | expr '[' expr ':'      ']'   { $$ = slice($1, $3, nil) }
-  | expr '['      ':'      ']'   { $$ = slice($1, nil, nil) }
+  : IDENT                              { $$ = &node{typ: nodeVar, name: $1.literal, pos: $1.pos, end: $1.end} }
+  | ELEM                               { $$ = &node{typ: nodeVar, name: $1.literal, pos: $1.pos, end: $1.end} }
+  | expr '.' IDENT                     { $$ = &node{typ: nodeMember, op: ".", name: $3.literal, args: []*node{$1}, pos: $1.pos, end: $3.end} }
+  | expr OPT_DOT IDENT                 { $$ = &node{typ: nodeMember, op: "?.", name: $3.literal, args: []*node{$1}, pos: $1.pos, end: $3.end} }
+  | expr '[' expr ']'                  { $$ = &node{typ: nodeIndex, op: "[", args: []*node{$1, $3}, pos: $1.pos, end: $4.end} }
+  | expr OPT_LBRACK expr ']'           { $$ = &node{typ: nodeIndex, op: "?[", args: []*node{$1, $3}, pos: $1.pos, end: $4.end} }
+  | expr IN expr                       { $$ = yylex.(*Lexer).newIn("in", $1, $3) }
+  | expr NOT_IN expr                   { $$ = yylex.(*Lexer).newIn("not in", $1, $3) }
+  | expr IN range                      { $$ = yylex.(*Lexer).newIn("in", $1, $3) }
+  | expr NOT_IN range                  { $$ = yylex.(*Lexer).newIn("not in", $1, $3) }
+  | expr BETWEEN expr BETWEEN_AND expr %prec BETWEEN { $$ = newBinary("between", $1, &node{typ: nodeRange, op: "..", args: []*node{$3, $5}, pos: $3.pos, end: $5.end}) }
+  | expr '[' expr ':' expr ']'         { $$ = &node{typ: nodeSlice, args: []*node{$1, $3, $5}, pos: $1.pos, end: $6.end} }
+  | expr '['      ':' expr ']'         { $$ = &node{typ: nodeSlice, args: []*node{$1, nil, $4}, pos: $1.pos, end: $5.end} }
+  | expr '[' expr ':'      ']'         { $$ = &node{typ: nodeSlice, args: []*node{$1, $3, nil}, pos: $1.pos, end: $5.end} }
+  | expr '['      ':'      ']'         { $$ = &node{typ: nodeSlice, args: []*node{$1, nil, nil}, pos: $1.pos, end: $4.end} }
+  ;
+
+range
+  : expr RANGE expr       { $$ = &node{typ: nodeRange, op: "..", args: []*node{$1, $3}, pos: $1.pos, end: $3.end} }
+  | expr RANGE_EXCL expr  { $$ = &node{typ: nodeRange, op: "..<", args: []*node{$1, $3}, pos: $1.pos, end: $3.end} }
+  | expr RANGE            { $$ = &node{typ: nodeRange, op: "..", args: []*node{$1, nil}, pos: $1.pos, end: $2.end} }
+  | RANGE expr            { $$ = &node{typ: nodeRange, op: "..", args: []*node{nil, $2}, pos: $1.pos, end: $2.end} }
+  | RANGE_EXCL expr       { $$ = &node{typ: nodeRange, op: "..<", args: []*node{nil, $2}, pos: $1.pos, end: $2.end} }
   ;
 
 exprList
-  : expr                  { $$ = []interface{}{$1} }
+  : expr                  { $$ = []*node{$1} }
   | exprList ',' expr     { $$ = append($1, $3) }
   ;
 
 exprMap
-  : expr ':' expr               { $$ = make(map[string]interface{}); $$[asObjectKey($1)] = $3 }
-  | exprMap ',' expr ':' expr   { $$ = addObjectMember($1, $3, $5) }
+  : expr ':' expr               { $$ = []*node{$1, $3} }
+  | exprMap ',' expr ':' expr   { $$ = append($1, $3, $5) }
   ;
 
-%%
\ No newline at end of file
+%%
@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"testing"
 
@@ -426,6 +427,14 @@ func Test_Arithmetic_Modulo(t *testing.T) {
 	assertEvaluation(t, nil, 0.5, "1.5 % 2.5 % 1")
 }
 
+func Test_Arithmetic_DivisionByZero(t *testing.T) {
+	vars := getTestVars()
+	assertEvalError(t, vars, "eval error: integer division by zero", "1 / 0")
+	assertEvalError(t, vars, "eval error: integer division by zero", "int / (int - int)")
+	assertEvalError(t, vars, "eval error: integer modulo by zero", "1 % 0")
+	assertEvaluation(t, nil, math.Inf(1), "1.0 / 0")
+}
+
 func Test_Arithmetic_InvalidTypes(t *testing.T) {
 	vars := getTestVars()
 	allTypes := []string{"nil", "true", "false", "42", "4.2", `"text"`, `"0"`, "[0]", "[]", "arr", `{"a":0}`, "{}", "obj"}
@@ -738,6 +747,15 @@ func Test_CompareHugeIntegers(t *testing.T) {
 	assertEvaluation(t, nil, true, fmt.Sprintf("%d.0 >= %d.0", j, i))
 }
 
+func Test_Compare_Strings(t *testing.T) {
+	assertEvaluation(t, nil, true, `"a" < "b"`)
+	assertEvaluation(t, nil, false, `"b" < "a"`)
+	assertEvaluation(t, nil, true, `"a" <= "a"`)
+	assertEvaluation(t, nil, true, `"ab" > "a"`)
+	assertEvaluation(t, nil, true, `"B" < "a"`)
+	assertEvaluation(t, nil, true, `"2023-12-31T23:59:59Z" < "2024-01-01T00:00:00Z"`)
+}
+
 func Test_Compare_InvalidTypes(t *testing.T) {
 	vars := getTestVars()
 	allTypes := []string{"nil", "true", "false", "42", "4.2", `"text"`, `"0"`, "[0]", "[]", "arr", `{"a":0}`, "{}", "obj"}
@@ -748,7 +766,7 @@ func Test_Compare_InvalidTypes(t *testing.T) {
 			typ1 := typeOfAllTypes[idx1]
 			typ2 := typeOfAllTypes[idx2]
 
-			if typ1 == "number" && typ2 == "number" {
+			if typ1 == "number" && typ2 == "number" || typ1 == "string" && typ2 == "string" {
 				continue
 			}
 
@@ -1033,6 +1051,99 @@ func Test_VariableAccess_DotSyntax_InvalidSyntax(t *testing.T) {
 	assertEvalError(t, vars, "syntax error: unexpected '[', expecting IDENT", "obj.[b]")
 }
 
+func Test_VariableAccess_OptionalChaining(t *testing.T) {
+	vars := getTestVars()
+	vars["order"] = map[string]interface{}{
+		"customer": map[string]interface{}{"tier": "gold"},
+		"items":    []interface{}{"a", "b"},
+	}
+
+	assertEvaluation(t, vars, "gold", `order?.customer?.tier`)
+	assertEvaluation(t, vars, "gold", `order?.customer.tier`)
+	assertEvaluation(t, vars, nil, `order?.address`)
+	assertEvaluation(t, vars, nil, `order?.address?.city`)
+	assertEvaluation(t, vars, nil, `missing?.customer?.tier`)
+	assertEvaluation(t, vars, nil, `nl?.field`)
+	assertEvaluation(t, vars, 51, `obj?.i`)
+
+	assertEvaluation(t, vars, "gold", `order?["customer"]?["tier"]`)
+	assertEvaluation(t, vars, "b", `order.items?[1]`)
+	assertEvaluation(t, vars, nil, `order.items?[2]`)
+	assertEvaluation(t, vars, nil, `order.items?[-1]`)
+	assertEvaluation(t, vars, nil, `missing?[0]`)
+
+	// the rest of the chain is skipped if the object of an optional access is nil
+	assertEvaluation(t, vars, nil, `missing?.customer.tier`)
+	assertEvaluation(t, vars, nil, `missing?["customer"].items[0]`)
+	assertEvaluation(t, vars, nil, `nl?.customer.tier`)
+	assertEvaluation(t, vars, "basic", `missing?.customer.tier ?? "basic"`)
+
+	// whitespace separates the ternary operator from member access and array literals
+	assertEvaluation(t, vars, []interface{}{1}, `tr ? [1] : [2]`)
+	assertEvaluation(t, vars, 0.5, `tr ?.5 : 1`)
+
+	// "?[" followed by a colon left over is a ternary operator, as in former versions
+	assertEvaluation(t, vars, []interface{}{1}, `tr ?[1]:[2]`)
+	assertEvaluation(t, vars, []interface{}{2}, `!tr ?[1]:[2]`)
+	assertEvaluation(t, vars, []interface{}{2}, `tr ? !tr ?[1] : [2] : [3]`)
+	assertEvaluation(t, vars, []interface{}{[]interface{}{1}, 2}, `[tr ?[1]:[2], 2]`)
+	assertEvaluation(t, vars, "a", `tr ? order.items?[0] : "c"`)
+	assertEvaluation(t, vars, "b", `order.items?[tr ? 1 : 0]`)
+}
+
+func Test_VariableAccess_OptionalChaining_InvalidType(t *testing.T) {
+	vars := getTestVars()
+	vars["order"] = map[string]interface{}{}
+	assertEvalError(t, vars, "syntax error: cannot access fields on type nil", `order?.address.city`)
+	assertEvalError(t, vars, "syntax error: object key must be string, but was number", `obj?[0]`)
+	assertEvalError(t, vars, "syntax error: array index must be number, but was string", `arr?["key"]`)
+	assertEvalError(t, vars, "syntax error: cannot access fields on type string", `str?.key`)
+	assertEvalError(t, vars, "syntax error: unexpected OPT_DOT", `?.key`)
+}
+
+func Test_Coalesce(t *testing.T) {
+	vars := getTestVars()
+	vars["order"] = map[string]interface{}{
+		"customer": map[string]interface{}{"tier": "gold"},
+	}
+
+	assertEvaluation(t, vars, "gold", `order?.customer?.tier ?? "basic"`)
+	assertEvaluation(t, vars, "basic", `order?.address?.tier ?? "basic"`)
+	assertEvaluation(t, vars, "basic", `missing?.customer?.tier ?? "basic"`)
+	assertEvaluation(t, vars, "basic", `missing ?? "basic"`)
+	assertEvaluation(t, vars, 1, `nl ?? 1`)
+	assertEvaluation(t, vars, false, `fl ?? true`)
+	assertEvaluation(t, vars, 0, `0 ?? 1`)
+	assertEvaluation(t, vars, "", `"" ?? "x"`)
+
+	assertEvaluation(t, vars, 3, `nil ?? nil ?? 3`)
+	assertEvaluation(t, vars, 3, `nil ?? 1 + 2`)
+	assertEvaluation(t, vars, true, `nil ?? false || true`)
+	assertEvaluation(t, vars, "a", `nil ?? tr ? "a" : "b"`)
+}
+
+func Test_Coalesce_ShortCircuit(t *testing.T) {
+	var calls int
+	functions := map[string]ExpressionFunction{
+		"fallback": func(args ...interface{}) (interface{}, error) {
+			calls++
+			return "fallback", nil
+		},
+	}
+
+	assertEvaluationFuncs(t, nil, functions, "value", `"value" ?? fallback()`)
+	assert.Equal(t, 0, calls)
+
+	assertEvaluationFuncs(t, nil, functions, "fallback", `nil ?? fallback()`)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Coalesce_InvalidSyntax(t *testing.T) {
+	assertEvalError(t, nil, "syntax error: unexpected $end", `nil ??`)
+	assertEvalError(t, nil, "syntax error: unexpected COALESCE", `?? 1`)
+	assertEvalError(t, nil, "var error: variable \"missing\" does not exist", `nil ?? missing`)
+}
+
 func Test_VariableAccess_ArraySyntax(t *testing.T) {
 	vars := getTestVars()
 
@@ -1250,13 +1361,535 @@ func Test_In(t *testing.T) {
 }
 
 func Test_In_InvalidTypes(t *testing.T) {
-	assertEvalError(t, nil, "syntax error: in-operator requires array, but was nil", "0 in nil")
-	assertEvalError(t, nil, "syntax error: in-operator requires array, but was bool", "0 in true")
-	assertEvalError(t, nil, "syntax error: in-operator requires array, but was bool", "0 in false")
-	assertEvalError(t, nil, "syntax error: in-operator requires array, but was number", "0 in 42")
-	assertEvalError(t, nil, "syntax error: in-operator requires array, but was number", "0 in 4.2")
-	assertEvalError(t, nil, "syntax error: in-operator requires array, but was string", `0 in "text"`)
-	assertEvalError(t, nil, "syntax error: in-operator requires array, but was object", "0 in {}")
+	assertEvalError(t, nil, "syntax error: in-operator requires array, string or object, but was nil", "0 in nil")
+	assertEvalError(t, nil, "syntax error: in-operator requires array, string or object, but was bool", "0 in true")
+	assertEvalError(t, nil, "syntax error: in-operator requires array, string or object, but was bool", "0 in false")
+	assertEvalError(t, nil, "syntax error: in-operator requires array, string or object, but was number", "0 in 42")
+	assertEvalError(t, nil, "syntax error: in-operator requires array, string or object, but was number", "0 in 4.2")
+	assertEvalError(t, nil, "type error: in-operator requires string to search within string, but was number", `0 in "text"`)
+	assertEvalError(t, nil, "type error: object key must be string, but was number", "0 in {}")
+	assertEvalError(t, nil, "syntax error: in-operator requires array, string or object, but was nil", "0 not in nil")
+}
+
+func Test_In_Strings(t *testing.T) {
+	vars := getTestVars()
+
+	assertEvaluation(t, vars, true, `"x" in "xyz"`)
+	assertEvaluation(t, vars, true, `"yz" in "xyz"`)
+	assertEvaluation(t, vars, true, `"" in "xyz"`)
+	assertEvaluation(t, vars, false, `"a" in "xyz"`)
+	assertEvaluation(t, vars, true, `"世" in "Hello, 世界"`)
+	assertEvaluation(t, vars, true, `"ex" in str`)
+}
+
+func Test_In_ObjectKeys(t *testing.T) {
+	vars := getTestVars()
+	vars["user"] = map[string]interface{}{
+		"roles": map[string]interface{}{"admin": true, "editor": nil},
+	}
+
+	assertEvaluation(t, vars, true, `"admin" in user.roles`)
+	assertEvaluation(t, vars, true, `"editor" in user.roles`)
+	assertEvaluation(t, vars, false, `"viewer" in user.roles`)
+	assertEvaluation(t, vars, false, `"a" in {}`)
+	assertEvaluation(t, vars, true, `"i" in obj`)
+	assertEvaluation(t, vars, true, `obj contains "s"`)
+}
+
+func Test_NotIn(t *testing.T) {
+	vars := getTestVars()
+
+	assertEvaluation(t, vars, false, `1 not in [1, 2]`)
+	assertEvaluation(t, vars, true, `3 not in [1, 2]`)
+	assertEvaluation(t, vars, true, `3 NOT IN [1, 2]`)
+	assertEvaluation(t, vars, true, `"a" not in "xyz"`)
+	assertEvaluation(t, vars, false, `"i" not in obj`)
+	assertEvaluation(t, vars, true, `"key" not in obj`)
+
+	// "not" is only a keyword if followed by "in"
+	vars["not"] = true
+	assertEvaluation(t, vars, true, `not`)
+	assertEvaluation(t, vars, true, `not && 1 not in []`)
+	assertEvaluation(t, vars, true, `not in [true]`)
+}
+
+func Test_In_Precedence(t *testing.T) {
+	vars := getTestVars()
+
+	// arithmetic binds stronger than "in", unlike in former versions, where this meant `1 + (1 in [2])` and failed
+	assertEvaluation(t, vars, true, `1 + 1 in [2]`)
+	assertEvaluation(t, vars, true, `1 + 2 in [3]`)
+	assertEvaluation(t, vars, true, `"te" + "x" in str`)
+	assertEvaluation(t, vars, true, `1 in [1] && 2 in [2]`)
+	assertEvaluation(t, vars, true, `1 in [1] == true`)
+	assertEvaluation(t, vars, true, `!(1 in [2])`)
+	assertEvaluation(t, vars, true, `tr in [true] ? true : false`)
+	assertEvaluation(t, vars, 2, `[1, 2][1 in [1] ? 1 : 0]`)
+	assertEvaluation(t, vars, true, `(!tr) in [false]`)
+
+	// "!" in front of the left operand negates the whole operation, as in former versions
+	assertEvaluation(t, vars, true, `!tr in [false]`)
+	assertEvaluation(t, vars, false, `!1 in [1]`)
+	assertEvaluation(t, vars, true, `!!1 in [1]`)
+	assertEvaluation(t, vars, false, `tr && !3 not in 1..2`)
+	assertEvaluation(t, vars, true, `!(1 in [2])`)
+}
+
+func getCartVars() map[string]interface{} {
+	return map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"category": "food", "price": 12.5, "qty": 2},
+			map[string]interface{}{"category": "alcohol", "price": 30, "qty": 1},
+			map[string]interface{}{"category": "books", "price": 60, "qty": 1},
+		},
+		"empty":   []interface{}{},
+		"numbers": []interface{}{1, 2, 3, 4},
+	}
+}
+
+func Test_Collection_Quantifiers(t *testing.T) {
+	vars := getCartVars()
+
+	assertEvaluation(t, vars, true, `any(items, #.category == "alcohol")`)
+	assertEvaluation(t, vars, false, `any(items, #.category == "toys")`)
+	assertEvaluation(t, vars, false, `any(empty, #)`)
+
+	assertEvaluation(t, vars, true, `all(items, #.price > 10)`)
+	assertEvaluation(t, vars, false, `all(items, #.price > 20)`)
+	assertEvaluation(t, vars, true, `all(empty, #)`)
+
+	assertEvaluation(t, vars, true, `none(items, #.category == "toys")`)
+	assertEvaluation(t, vars, false, `none(items, #.category == "books")`)
+	assertEvaluation(t, vars, true, `none(empty, #)`)
+
+	assertEvaluation(t, vars, true, `any(numbers, # == 3) && !any(numbers, # > 4)`)
+	assertEvaluation(t, vars, true, `any(items, any([#.category], # == "books"))`)
+	assertEvaluation(t, vars, true, `all(numbers, #index + 1 == #)`)
+}
+
+func Test_Collection_Transformations(t *testing.T) {
+	vars := getCartVars()
+
+	assertEvaluation(t, vars, []interface{}{2, 4}, `filter(numbers, # % 2 == 0)`)
+	assertEvaluation(t, vars, []interface{}{}, `filter(numbers, # > 4)`)
+	assertEvaluation(t, vars, []interface{}{"food", "alcohol", "books"}, `map(items, #.category)`)
+	assertEvaluation(t, vars, []interface{}{2, 4, 6, 8}, `map(numbers, # * 2)`)
+	assertEvaluation(t, vars, []interface{}{}, `map(empty, # * 2)`)
+	assertEvaluation(t, vars, []interface{}{0, 1, 2, 3}, `map(numbers, #index)`)
+
+	assertEvaluation(t, vars, 3, `count(items)`)
+	assertEvaluation(t, vars, 2, `count(items, #.qty == 1)`)
+	assertEvaluation(t, vars, 0, `count(empty)`)
+
+	assertEvaluation(t, vars, 10, `sum(numbers)`)
+	assertEvaluation(t, vars, 0, `sum(empty)`)
+	assertEvaluation(t, vars, 102.5, `sum(items, #.price)`)
+	assertEvaluation(t, vars, true, `sum(items, #.price * #.qty) > 100`)
+	assertEvaluation(t, vars, 90, `sum(filter(items, #.category != "food"), #.price * #.qty)`)
+
+	assertEvaluation(t, vars, 24, `reduce(numbers, #acc * #)`)
+	assertEvaluation(t, vars, 20, `reduce(numbers, #acc + #, 10)`)
+	assertEvaluation(t, vars, "", `reduce(empty, #acc + #, "")`)
+	assertEvaluation(t, vars, 3, `reduce(numbers, #index)`)
+}
+
+func Test_Collection_Lazy(t *testing.T) {
+	var calls int
+	functions := map[string]ExpressionFunction{
+		"check": func(args ...interface{}) (interface{}, error) {
+			calls++
+			return args[0], nil
+		},
+	}
+	vars := map[string]interface{}{"flags": []interface{}{false, true, false}}
+
+	assertEvaluationFuncs(t, vars, functions, true, `any(flags, check(#))`)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	assertEvaluationFuncs(t, vars, functions, false, `all(flags, check(#))`)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Collection_CustomFunctionTakesPrecedence(t *testing.T) {
+	functions := map[string]ExpressionFunction{
+		"sum": func(args ...interface{}) (interface{}, error) {
+			return len(args), nil
+		},
+	}
+	assertEvaluationFuncs(t, nil, functions, 3, `sum(1, 2, 3)`)
+}
+
+func Test_Collection_Errors(t *testing.T) {
+	vars := getCartVars()
+
+	assertEvalError(t, vars, "function error: any requires 2 arguments, but got 1", `any(items)`)
+	assertEvalError(t, vars, "function error: count requires 1 to 2 arguments, but got 3", `count(items, #, #)`)
+	assertEvalError(t, vars, "type error: any requires array, but was object", `any({}, #)`)
+	assertEvalError(t, vars, "type error: filter requires array, but was nil", `filter(nil, #)`)
+	assertEvalError(t, vars, "type error: required bool, but was number", `any(numbers, #)`)
+	assertEvalError(t, vars, "type error: sum requires numbers, but was string", `sum(items, #.category)`)
+	assertEvalError(t, vars, "eval error: reduce of empty array requires an initial value", `reduce(empty, #acc + #)`)
+
+	assertEvalError(t, vars, "var error: \"#\" can only be used within a collection operation", `#`)
+	assertEvalError(t, vars, "var error: \"#acc\" can only be used within a collection operation", `map(numbers, #acc)`)
+	assertEvalError(t, vars, "unknown token \"#elem\" at position 1", `#elem`)
+}
+
+func Test_Let_Simple(t *testing.T) {
+	vars := getTestVars()
+
+	assertEvaluation(t, vars, 3, `let x = 1 + 2; x`)
+	assertEvaluation(t, vars, 6, `let x = 1 + 2; x * 2`)
+	assertEvaluation(t, vars, 5, `let x = 2; let y = x + 1; x + y`)
+	assertEvaluation(t, vars, 84, `let double = int * 2; double`)
+	assertEvaluation(t, vars, true, `let total = obj.i * 2; total > 100 && total < 110`)
+	assertEvaluation(t, vars, 4, `(let x = 1; x + 1) * 2`)
+	assertEvaluation(t, vars, 12, `let x = (let y = 3; y * 2); x * 2`)
+	assertEvaluation(t, vars, "a", `let x = tr; x ? "a" : "b"`)
+	assertEvaluation(t, vars, []interface{}{43, 44}, `let offset = 42; map([1, 2], # + offset)`)
+	assertEvaluation(t, vars, "tx", `let o = obj; o.s`)
+	assertEvaluation(t, vars, 1, `let x = nil; x ?? 1`)
+}
+
+func Test_Let_Scoping(t *testing.T) {
+	vars := getTestVars()
+
+	// let-bindings shadow variables within their body, but do not modify them
+	assertEvaluation(t, vars, 1, `let int = 1; int`)
+	assertEvaluation(t, vars, 43, `(let int = 1; int) + int`)
+	assert.Equal(t, 42, vars["int"])
+
+	// inner let-bindings shadow outer ones
+	assertEvaluation(t, vars, 3, `let x = 1; let x = x + 2; x`)
+	assertEvaluation(t, vars, 2, `let x = 1; (let x = 5; x) - 4 + x`)
+
+	assertEvalError(t, vars, "var error: variable \"x\" does not exist", `(let x = 1; x) + x`)
+	assertEvalError(t, vars, "var error: variable \"x\" does not exist", `let x = x + 1; x`)
+}
+
+func Test_Let_AsVariable(t *testing.T) {
+	vars := map[string]interface{}{"let": 3, "items": []interface{}{1, 2}}
+
+	assertEvaluation(t, vars, 3, `let`)
+	assertEvaluation(t, vars, true, `let > 2 && let <= 3`)
+	assertEvaluation(t, vars, 4, `let + 1`)
+	assertEvaluation(t, vars, false, `let in items`)
+	assertEvaluation(t, vars, 6, `let x = let * 2; x`)
+	assertEvaluation(t, vars, 5, `let let = 5; let`)
+}
+
+func Test_Let_InvalidSyntax(t *testing.T) {
+	assertEvalError(t, nil, "syntax error: unexpected $end", `let x = 1`)
+	assertEvalError(t, nil, "syntax error: unexpected $end", `let x = 1;`)
+	assertEvalError(t, nil, "syntax error: unexpected LITERAL_NUMBER, expecting IDENT", `let 1 = 1; 1`)
+	assertEvalError(t, nil, "syntax error: unexpected LITERAL_BOOL, expecting IDENT", `let true = 1; 1`)
+	assertEvalError(t, nil, "syntax error: unexpected ';', expecting '='", `let x; x`)
+	assertEvalError(t, nil, "syntax error: unexpected '='", `x = 1`)
+}
+
+func Test_Check_Shadowing(t *testing.T) {
+	vars := getTestVars()
+
+	warnings, err := Check(`let x = 1; let y = 2; x + y`, vars)
+	if assert.NoError(t, err) {
+		assert.Empty(t, warnings)
+	}
+
+	warnings, err = Check(`let int = 1; int`, vars)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Warning{{Pos: 1, Message: `let "int" shadows a variable`}}, warnings)
+	}
+
+	warnings, err = Check(`let int = 1; int`, nil)
+	if assert.NoError(t, err) {
+		assert.Empty(t, warnings)
+	}
+
+	warnings, err = Check(`let x = 1; let x = 2; x`, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Warning{{Pos: 12, Message: `let "x" shadows an outer let-binding`}}, warnings)
+		assert.Equal(t, `let "x" shadows an outer let-binding at position 12`, warnings[0].String())
+	}
+
+	// sibling scopes do not shadow each other
+	warnings, err = Check(`(let x = 1; x) + (let x = 2; x)`, nil)
+	if assert.NoError(t, err) {
+		assert.Empty(t, warnings)
+	}
+
+	_, err = Check(`let x = 1`, nil)
+	assert.EqualError(t, err, "syntax error: unexpected $end")
+}
+
+func Test_SyntaxErrorPosition(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{`1 +`, 4},
+		{`1 + )`, 5},
+		{`(1 + 2`, 7},
+		{`[1, 2 3]`, 7},
+		{`1 + 0x`, 5},
+	}
+	for _, tt := range tests {
+		_, err := Evaluate(tt.expr, nil, nil)
+		var syntaxErr *Error
+		if assert.ErrorAs(t, err, &syntaxErr, tt.expr) {
+			assert.Equal(t, tt.pos, syntaxErr.Pos, tt.expr)
+		}
+	}
+
+	// evaluation errors have no position
+	_, err := Evaluate(`1 + x`, nil, nil)
+	var syntaxErr *Error
+	assert.False(t, errors.As(err, &syntaxErr))
+}
+
+func Test_Check_Types(t *testing.T) {
+	vars := getTestVars()
+
+	assertWarnings := func(expected []Warning, str string) {
+		warnings, err := Check(str, vars)
+		if assert.NoError(t, err, str) {
+			assert.Equal(t, expected, warnings, str)
+		}
+	}
+
+	assertWarnings(nil, `1 + 2 * int`)
+	assertWarnings(nil, `"a" + 1`)
+	assertWarnings(nil, `unknown + 1 > 2`)
+	assertWarnings(nil, `str startsWith "a" && arr contains 1`)
+	assertWarnings(nil, `count(arr) in 1..3`)
+	assertWarnings(nil, `let x = 1; x * 2`)
+
+	assertWarnings([]Warning{{Pos: 1, Message: "type error: cannot subtract type string and number"}}, `"a" - 1`)
+	assertWarnings([]Warning{{Pos: 1, Message: "type error: cannot subtract type string and number"}}, `str - 1`)
+	assertWarnings([]Warning{{Pos: 16, Message: "type error: cannot multiply type bool and number"}}, `let b = 1 < 2; b * 2`)
+	assertWarnings([]Warning{{Pos: 1, Message: "type error: cannot compare type string and number"}}, `str < 1`)
+	assertWarnings([]Warning{{Pos: 5, Message: "type error: sum requires array, but was string"}}, `sum("a")`)
+	assertWarnings([]Warning{{Pos: 1, Message: "type error: cannot compare type string and number"}}, `count(arr) + "" in 1..3`)
+
+	// the position points at the innermost failing operation
+	assertWarnings([]Warning{{Pos: 5, Message: "type error: cannot subtract type bool and number"}}, `1 + (true - 1)`)
+}
+
+func Test_CheckCondition(t *testing.T) {
+	vars := getTestVars()
+
+	warnings, err := CheckCondition(`int > 1 && str != ""`, vars)
+	if assert.NoError(t, err) {
+		assert.Empty(t, warnings)
+	}
+
+	warnings, err = CheckCondition(`unknown`, vars)
+	if assert.NoError(t, err) {
+		assert.Empty(t, warnings)
+	}
+
+	warnings, err = CheckCondition(`int + 1`, vars)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Warning{{Pos: 1, Message: "type error: condition must result in bool, but was number"}}, warnings)
+	}
+
+	warnings, err = CheckCondition(`int > 1 || !!true`, vars)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Warning{{Pos: 1, Message: "condition is always true"}}, warnings)
+	}
+
+	warnings, err = CheckCondition(`1 + 2 > 4 && int > 1`, vars)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Warning{{Pos: 1, Message: "condition is always false"}}, warnings)
+	}
+}
+
+func Test_Simplify(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`1 + 2 > y`, `3 > y`},
+		{`!!true || x`, `true || x`},
+		{`true && x`, `true && x`},
+		{`x || true`, `x || true`},
+		{`!!flag`, `!!flag`},
+		{`x * 1 + 2 * 3`, `x * 1 + 6`},
+		{`1 < 2 ? a : b`, `true ? a : b`},
+		{`x > 1 ? 1 + 1 : false ? 1 : 2`, `x > 1 ? 2 : 2`},
+		{`nil ?? x`, `nil ?? x`},
+		{`nil ?? "a"`, `"a"`},
+		{`"a" + "b" == s`, `"ab" == s`},
+		{`{"a": 1 + 1}.a * x`, `2 * x`},
+		{`5 in 1..2 + 3`, `true`},
+		{`x in [1, 2 * 2]`, `x in [1, 4]`},
+		{`len("abc") > 1`, `len("abc") > 1`},
+		{`1 / 0.0 > x`, `1 / 0.0 > x`},
+		{`"a" - 1 > x`, `"a" - 1 > x`},
+		{`let a = 2 * 3; a > x`, `let a = 6; a > x`},
+
+		// operands are only removed if they are known to be of the type the operator requires
+		{`true && x > 1`, `x > 1`},
+		{`x in [1, 2] && true`, `x in [1, 2]`},
+		{`false || !flag`, `!flag`},
+		{`!!(x > 1)`, `x > 1`},
+		{`!!!flag`, `!flag`},
+		{`-(-(x * 2))`, `x * 2`},
+		{`(x - 1) * 1`, `x - 1`},
+		{`1 * -x / 1 - 0`, `-x`},
+		{`x * 1.0`, `x * 1.0`},
+		{`"a" + x * 1`, `"a" + x * 1`},
+
+		// the branch not taken is only removed if it cannot fail, as both branches are resolved
+		{`true ? a : "b"`, `a`},
+		{`1 > 2 ? [1, 2] : x > 1`, `x > 1`},
+		{`true ? a : b`, `true ? a : b`},
+	}
+
+	for _, tt := range tests {
+		got, err := Simplify(tt.expr)
+		if assert.NoError(t, err, tt.expr) {
+			assert.Equal(t, tt.want, got, tt.expr)
+		}
+	}
+
+	_, err := Simplify(`1 +`)
+	assert.Error(t, err)
+}
+
+func Test_Compile(t *testing.T) {
+	vars := getTestVars()
+
+	program, err := Compile(`true && int > 1 + 1`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `true && int > 1 + 1`, program.Source())
+		assert.Equal(t, `int > 2`, program.String())
+		_, constant := program.Constant()
+		assert.False(t, constant)
+
+		res, err := program.Evaluate(vars, nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, true, res)
+		}
+	}
+
+	program, err = Compile(`"a" - 1 > 1`)
+	if assert.NoError(t, err) {
+		_, err := program.Evaluate(vars, nil)
+		assert.Error(t, err)
+	}
+
+	program, err = Compile(`1 < 2 && !false`)
+	if assert.NoError(t, err) {
+		val, constant := program.Constant()
+		assert.True(t, constant)
+		assert.Equal(t, true, val)
+	}
+
+	// the compiled program reports the same errors as the expression as written
+	for _, expr := range []string{`unknown || true`, `false && unknown`, `str * 1 > 0`, `!!1`, `true ? 1 : unknown`} {
+		program, err = Compile(expr)
+		if assert.NoError(t, err, expr) {
+			_, want := Evaluate(expr, vars, nil)
+			_, got := program.Evaluate(vars, nil)
+			if assert.Error(t, want, expr) {
+				assert.Equal(t, want, got, expr)
+			}
+		}
+	}
+}
+
+func Test_Range(t *testing.T) {
+	vars := getTestVars()
+	vars["age"] = 30
+
+	assertEvaluation(t, vars, true, `age in 18..65`)
+	assertEvaluation(t, vars, true, `18 in 18..65`)
+	assertEvaluation(t, vars, true, `65 in 18..65`)
+	assertEvaluation(t, vars, false, `66 in 18..65`)
+	assertEvaluation(t, vars, false, `17.9 in 18..65`)
+	assertEvaluation(t, vars, true, `64.5 in 18 .. 65`)
+
+	assertEvaluation(t, vars, true, `18 in 18..<65`)
+	assertEvaluation(t, vars, false, `65 in 18..<65`)
+	assertEvaluation(t, vars, true, `64.9 in 18 ..< 65`)
+
+	assertEvaluation(t, vars, true, `100 in 18..`)
+	assertEvaluation(t, vars, false, `10 in 18..`)
+	assertEvaluation(t, vars, true, `10 in ..18`)
+	assertEvaluation(t, vars, true, `18 in ..18`)
+	assertEvaluation(t, vars, false, `18 in ..<18`)
+
+	assertEvaluation(t, vars, false, `age not in 18..65`)
+	assertEvaluation(t, vars, true, `age not in ..<18`)
+
+	assertEvaluation(t, vars, true, `age in int-20..int+20`)
+	assertEvaluation(t, vars, true, `age in obj.i - 30..obj.i`)
+	assertEvaluation(t, vars, true, `-5 in -10..-1`)
+	assertEvaluation(t, vars, true, `-5 in -10..<-1`)
+	assertEvaluation(t, vars, true, `1.5 in 1.2..2.5`)
+	assertEvaluation(t, vars, true, `1.5 in 1..2.5`)
+	assertEvaluation(t, vars, true, `0 in 0..0`)
+	assertEvaluation(t, vars, true, `age in 18..65 && age in 20..`)
+	assertEvaluation(t, vars, true, `(age in 18..65) == true`)
+
+	assertEvaluation(t, vars, true, `"m" in "a".."z"`)
+	assertEvaluation(t, vars, false, `"z" in "a"..<"z"`)
+	assertEvaluation(t, vars, true, `"2024-06-01" in "2024-01-01".."2024-12-31"`)
+}
+
+func Test_Range_LazyUpperBound(t *testing.T) {
+	var calls int
+	functions := map[string]ExpressionFunction{
+		"upper": func(args ...interface{}) (interface{}, error) {
+			calls++
+			return 10, nil
+		},
+	}
+	assertEvaluationFuncs(t, nil, functions, false, `0 in 1..upper()`)
+	assert.Equal(t, 0, calls)
+	assertEvaluationFuncs(t, nil, functions, true, `5 in 1..upper()`)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_Range_Errors(t *testing.T) {
+	assertEvalError(t, nil, "type error: cannot compare type string and number", `"a" in 1..2`)
+	assertEvalError(t, nil, "type error: cannot compare type nil and number", `nil in 1..2`)
+	assertEvalError(t, nil, "syntax error: unexpected RANGE", `1..2`)
+	assertEvalError(t, nil, "syntax error: unexpected RANGE", `1 in 1..2..3`)
+	assertEvalError(t, nil, "syntax error: unexpected RANGE, expecting ']' or ','", `1 in [1..2]`)
+	assertEvalError(t, nil, "unknown token \"...\" (\"\") at position 7", `1 in 1...2`)
+}
+
+func Test_Between(t *testing.T) {
+	vars := getTestVars()
+	vars["age"] = 30
+
+	assertEvaluation(t, vars, true, `age between 18 and 65`)
+	assertEvaluation(t, vars, true, `18 between 18 and 65`)
+	assertEvaluation(t, vars, true, `65 between 18 and 65`)
+	assertEvaluation(t, vars, false, `66 between 18 and 65`)
+	assertEvaluation(t, vars, true, `age + 10 between 18 + 2 and 60 - 20`)
+	assertEvaluation(t, vars, true, `age between 18 and 65 && age between 30 and 30`)
+	assertEvaluation(t, vars, false, `!(age between 18 and 65)`)
+	assertEvaluation(t, vars, true, `"b" between "a" and "c"`)
+	assertEvaluation(t, vars, true, `age between (0 between 0 and 1 ? 18 : 0) and 65`)
+
+	// "and" is only a keyword after "between"
+	vars["and"] = true
+	assertEvaluation(t, vars, true, `and && age between 1 and 100`)
+	assertEvaluation(t, vars, true, `age between 1 and (and ? 100 : 0)`)
+
+	// "between" is only a keyword between two operands
+	vars["between"] = 20
+	assertEvaluation(t, vars, true, `between == 20 && between between 1 and between`)
+	assertEvaluation(t, vars, true, `age between between and 65`)
+}
+
+func Test_Between_Errors(t *testing.T) {
+	assertEvalError(t, nil, "syntax error: unexpected $end", `1 between 0`)
+	assertEvalError(t, nil, "syntax error: unexpected $end", `1 between 0 and`)
+	assertEvalError(t, nil, "type error: cannot compare type bool and number", `true between 0 and 1`)
 }
 
 func Test_String_Slice(t *testing.T) {
@@ -1279,11 +1912,93 @@ func Test_String_Slice(t *testing.T) {
 }
 
 func Test_String_Slice_Unicode(t *testing.T) {
-	// The characters 世 and 界 both require 3 bytes
+	// The characters 世 and 界 both require 3 bytes, but are indexed as one character each
 	assertEvaluation(t, nil, "Hello, ", `"Hello, 世界"[:7]`)
-	assertEvaluation(t, nil, "世界", `"Hello, 世界"[7:13]`)
-	assertEvaluation(t, nil, "世", `"Hello, 世界"[7:10]`)
-	assertEvaluation(t, nil, "界", `"Hello, 世界"[10:13]`)
+	assertEvaluation(t, nil, "世界", `"Hello, 世界"[7:9]`)
+	assertEvaluation(t, nil, "世", `"Hello, 世界"[7:8]`)
+	assertEvaluation(t, nil, "界", `"Hello, 世界"[8:]`)
+	assertEvaluation(t, nil, "ü", `"Grüße"[:3][2:]`)
+
+	assertEvalError(t, nil, "range error: end-index 10 is out of range [0, 9]", `"Hello, 世界"[7:10]`)
+}
+
+func Test_String_Operators(t *testing.T) {
+	vars := getTestVars()
+	vars["name"] = "Grüße, 世界"
+
+	assertEvaluation(t, vars, true, `"abcdef" startsWith "abc"`)
+	assertEvaluation(t, vars, true, `"abcdef" startsWith ""`)
+	assertEvaluation(t, vars, false, `"abcdef" startsWith "bc"`)
+	assertEvaluation(t, vars, false, `"ab" startsWith "abc"`)
+	assertEvaluation(t, vars, true, `name startsWith "Grü"`)
+
+	assertEvaluation(t, vars, true, `"abcdef" endsWith "def"`)
+	assertEvaluation(t, vars, false, `"abcdef" endsWith "abc"`)
+	assertEvaluation(t, vars, true, `name endsWith "世界"`)
+
+	assertEvaluation(t, vars, true, `"abcdef" contains "cd"`)
+	assertEvaluation(t, vars, false, `"abcdef" contains "dc"`)
+	assertEvaluation(t, vars, true, `name contains "ße"`)
+	assertEvaluation(t, vars, true, `arr contains "txt"`)
+	assertEvaluation(t, vars, false, `arr contains "text"`)
+	assertEvaluation(t, vars, true, `[1, [2]] contains [2.0]`)
+
+	assertEvaluation(t, vars, true, `"ab" + "cd" startsWith "abc" && str endsWith "xt"`)
+	assertEvaluation(t, vars, false, `!("abc" contains "b")`)
+	assertEvaluation(t, vars, true, `"abc" contains "b" == true`)
+}
+
+func Test_String_Operators_AsFunctionNames(t *testing.T) {
+	functions := map[string]ExpressionFunction{
+		"contains": func(args ...interface{}) (interface{}, error) {
+			return len(args), nil
+		},
+	}
+	assertEvaluationFuncs(t, nil, functions, 2, `contains("a", "b")`)
+	assertEvaluationFuncs(t, nil, functions, true, `"abc" contains ("b")`)
+}
+
+func Test_String_Operators_AsVariables(t *testing.T) {
+	vars := map[string]interface{}{
+		"startsWith": "ab",
+		"endsWith":   "yz",
+		"contains":   []interface{}{"ab", "yz"},
+		"obj":        map[string]interface{}{"contains": 1},
+	}
+	assertEvaluation(t, vars, "ab", `startsWith`)
+	assertEvaluation(t, vars, true, `"abc" startsWith startsWith`)
+	assertEvaluation(t, vars, true, `endsWith == "yz" && contains contains endsWith`)
+	assertEvaluation(t, vars, true, `(contains)[0] == startsWith`)
+	assertEvaluation(t, vars, 1, `obj.contains`)
+}
+
+func Test_String_Operators_InvalidTypes(t *testing.T) {
+	vars := getTestVars()
+	assertEvalError(t, vars, "type error: startsWith requires string and string, but was number and string", `42 startsWith "4"`)
+	assertEvalError(t, vars, "type error: endsWith requires string and string, but was string and nil", `"abc" endsWith nil`)
+	assertEvalError(t, vars, "syntax error: contains requires array, string or object, but was number", `42 contains "4"`)
+	assertEvalError(t, vars, "type error: contains requires string to search within string, but was number", `"42" contains 4`)
+	assertEvalError(t, vars, "syntax error: unexpected LITERAL_STRING", `startsWith "a"`)
+}
+
+func Test_String_EqualIgnoreCase(t *testing.T) {
+	vars := getTestVars()
+
+	assertEvaluation(t, vars, true, `"abc" ~= "ABC"`)
+	assertEvaluation(t, vars, true, `"Σίσυφος" ~= "ΣΊΣΥΦΟΣ"`)
+	assertEvaluation(t, vars, true, `"straße" ~= "STRAẞE"`)
+	assertEvaluation(t, vars, true, `"Gödel" ~= "GÖDEL"`)
+	assertEvaluation(t, vars, false, `"abc" ~= "abd"`)
+	assertEvaluation(t, vars, true, `str ~= "TEXT"`)
+
+	// other types are compared like with ==
+	assertEvaluation(t, vars, true, `1 ~= 1.0`)
+	assertEvaluation(t, vars, false, `1 ~= "1"`)
+	assertEvaluation(t, vars, true, `nil ~= nil`)
+
+	assertEvaluation(t, vars, true, `"a" + "B" ~= "ab" && true`)
+	assertEvaluation(t, vars, -2, `~1`)
+	assertEvaluation(t, vars, -2, `~ 1`)
 }
 
 func Test_String_Slice_OutOfRange(t *testing.T) {
@@ -1596,3 +2311,388 @@ func getTestVars() map[string]interface{} {
 		},
 	}
 }
+
+func Test_Explain(t *testing.T) {
+	vars := getTestVars()
+
+	x, err := Explain(`(int + 1) * 2 > 80 && str in ["text", "txt"]`, vars, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, true, x.Value)
+		assert.Equal(t, ""+
+			"(int + 1) * 2 > 80 && str in [\"text\", \"txt\"]  => true\n"+
+			"├── (int + 1) * 2 > 80  => true\n"+
+			"│   └── (int + 1) * 2  => 86\n"+
+			"│       └── (int + 1)  => 43\n"+
+			"│           └── int  => 42\n"+
+			"└── str in [\"text\", \"txt\"]  => true\n"+
+			"    ├── str  => \"text\"\n"+
+			"    └── [\"text\", \"txt\"]  => [\"text\",\"txt\"]\n",
+			x.String())
+	}
+
+	x, err = Explain(`42`, nil, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Explanation{Expr: "42", Pos: 1, Value: 42}, x)
+	}
+}
+
+func Test_Explain_Spans(t *testing.T) {
+	vars := getTestVars()
+	vars["items"] = []interface{}{1, 2}
+
+	x, err := Explain(`let a = obj?.i; a between 1 and 60 && obj.s[0:1] == "t" ? -a : any(items, # not in ..<2)`, vars, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, -51, x.Value)
+		var exprs []string
+		var collect func(x *Explanation)
+		collect = func(x *Explanation) {
+			exprs = append(exprs, x.Expr)
+			for _, child := range x.Children {
+				collect(child)
+			}
+		}
+		collect(x)
+		assert.Equal(t, []string{
+			`let a = obj?.i; a between 1 and 60 && obj.s[0:1] == "t" ? -a : any(items, # not in ..<2)`,
+			`obj?.i`,
+			`obj`,
+			`a between 1 and 60 && obj.s[0:1] == "t" ? -a : any(items, # not in ..<2)`,
+			`a between 1 and 60 && obj.s[0:1] == "t"`,
+			`a between 1 and 60`,
+			`a`,
+			`obj.s[0:1] == "t"`,
+			`obj.s[0:1]`,
+			`obj.s`,
+			`obj`,
+			`-a`,
+			`a`,
+			`any(items, # not in ..<2)`,
+			`items`,
+			`# not in ..<2`,
+			`#`,
+			`# not in ..<2`,
+			`#`,
+		}, exprs)
+	}
+}
+
+func Test_Explain_Error(t *testing.T) {
+	vars := getTestVars()
+
+	x, err := Explain(`int > 1 && obj.missing`, vars, nil)
+	assert.EqualError(t, err, `var error: object has no member "missing"`)
+	if assert.NotNil(t, x) {
+		assert.Equal(t, ""+
+			"int > 1 && obj.missing  ! var error: object has no member \"missing\"\n"+
+			"├── int > 1  => true\n"+
+			"│   └── int  => 42\n"+
+			"└── obj.missing  ! var error: object has no member \"missing\"\n"+
+			"    └── obj  => {\"b\":false,\"f\":5.1,\"i\":51,\"s\":\"tx\"}\n",
+			x.String())
+	}
+
+	x, err = Explain(`int >`, vars, nil)
+	assert.EqualError(t, err, "syntax error: unexpected $end")
+	assert.Nil(t, x)
+}
+
+func Test_Coverage(t *testing.T) {
+	c, err := NewCoverage(`age >= 18 && (vip || points > 100) ? "yes" : "no"`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, vars := range []map[string]interface{}{
+		{"age": 20, "vip": true, "points": 0},
+		{"age": 16, "vip": true, "points": 0},
+		{"age": 20, "vip": false},
+	} {
+		_, _ = c.Evaluate(vars, nil)
+	}
+
+	type counts struct {
+		Expr                      string
+		Condition                 bool
+		Hits, True, False, Errors int
+	}
+	var actual []counts
+	for _, nc := range c.Nodes() {
+		actual = append(actual, counts{nc.Expr, nc.Condition, nc.Hits, nc.True, nc.False, nc.Errors})
+	}
+	assert.Equal(t, []counts{
+		{`age >= 18 && (vip || points > 100) ? "yes" : "no"`, true, 3, 0, 0, 1},
+		{`age >= 18 && (vip || points > 100)`, true, 3, 1, 1, 1},
+		{`age >= 18`, true, 3, 2, 1, 0},
+		{`age`, false, 3, 0, 0, 0},
+		{`(vip || points > 100)`, true, 3, 2, 0, 1},
+		{`vip`, true, 3, 2, 1, 0},
+		{`points > 100`, true, 3, 0, 2, 1},
+		{`points`, false, 3, 0, 0, 1},
+	}, actual)
+
+	assert.Equal(t, CoverageStats{Nodes: 8, NodesHit: 8, Outcomes: 12, OutcomesHit: 8}, c.Stats())
+	assert.True(t, c.Nodes()[2].Covered())
+	assert.False(t, c.Nodes()[4].Covered())
+
+	c.Reset()
+	assert.Equal(t, CoverageStats{Nodes: 8, Outcomes: 12}, c.Stats())
+
+	// evaluating with coverage works like Evaluate
+	res, err := c.Evaluate(map[string]interface{}{"age": 20, "vip": true, "points": 0}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "yes", res)
+
+	_, err = NewCoverage(`1 +`)
+	assert.EqualError(t, err, "syntax error: unexpected $end")
+
+	c, _ = NewCoverage(`true`)
+	_, _ = c.Evaluate(nil, nil)
+	assert.Equal(t, []NodeCoverage{{Expr: "true", Pos: 1, End: 5, Condition: true, Hits: 1, True: 1}}, c.Nodes())
+}
+
+func Test_Format(t *testing.T) {
+	tests := []struct {
+		expr, formatted string
+	}{
+		{`1+2*3`, `1 + 2 * 3`},
+		{`(1+2)*3`, `(1 + 2) * 3`},
+		{`((a))`, `a`},
+		{`a&&(b||c)`, `a && (b || c)`},
+		{`(a&&b)||c`, `a && b || c`},
+		{`(a && b) && c`, `a && b && c`},
+		{`a && (b && c)`, `a && (b && c)`},
+		{`a - (b - c)`, `a - (b - c)`},
+		{`(a - b) - c`, `a - b - c`},
+		{`(2 << 1) + 1`, `(2 << 1) + 1`},
+		{`2 << (1 + 1)`, `2 << 1 + 1`},
+		{`- -1`, `-(-1)`},
+		{`!(a in [1,2])`, `!(a in [1, 2])`},
+		{`!!flag`, `!!flag`},
+		{`((!a)) in [true]`, `(!a) in [true]`},
+		{`!a in [true]`, `!(a in [true])`},
+		{`startsWith startsWith let`, `startsWith startsWith let`},
+		{"`raw` + \"\\x41\"", `"raw" + "A"`},
+		{`x in 18..65`, `x in 18..65`},
+		{`x not   in ..<5`, `x not in ..<5`},
+		{`x NOT IN 5..`, `x not in 5..`},
+		{`x between 1+1 and (a?1:2)`, `x between 1 + 1 and (a ? 1 : 2)`},
+		{`let a=1;let b=2;a+b`, `let a = 1; let b = 2; a + b`},
+		{`(let a = 1; a) + 1`, `(let a = 1; a) + 1`},
+		{`let a = (b ? 1 : 2); a`, `let a = b ? 1 : 2; a`},
+		{`a ? b : (c ? d : e)`, `a ? b : c ? d : e`},
+		{`(a ? b : c) ? d : e`, `(a ? b : c) ? d : e`},
+		{`a ? (b ? c : d) : e`, `a ? (b ? c : d) : e`},
+		{`a ?? (b ?? c)`, `a ?? b ?? c`},
+		{`(a ?? b) ?? c`, `(a ?? b) ?? c`},
+		{`{"a":1,"b":[1,2.0,3.5e30,0x10]}`, `{"a": 1, "b": [1, 2.0, 3.5e+30, 16]}`},
+		{`{"a": (b ? 1 : 2)}`, `{"a": (b ? 1 : 2)}`},
+		{`arr[1:2][:3][0].x?.y?["z"]`, `arr[1:2][:3][0].x?.y?["z"]`},
+		{`(a + b).c`, `(a + b).c`},
+		{`-a.b`, `-a.b`},
+		{`(-a).b`, `(-a).b`},
+		{`f( 1 ,2 )`, `f(1, 2)`},
+		{`any(arr, # > 1 && #index < 2)`, `any(arr, # > 1 && #index < 2)`},
+		{`1.0`, `1.0`},
+		{`0.1e-8`, `1e-09`},
+		{"a\n&&\tb", `a && b`},
+		{
+			`vipLevel > 5 && !inBlacklist && balance >= 100 && region == "eu" && channel in ["web", "app"] && age between 18 and 65`,
+			`vipLevel > 5
+  && !inBlacklist
+  && balance >= 100
+  && region == "eu"
+  && channel in ["web", "app"]
+  && age between 18 and 65`,
+		},
+		{
+			`(vipLevel > 5 || loyaltyPoints > 10000 || customerSegment == "enterprise-premium") && !inBlacklist`,
+			`(vipLevel > 5
+    || loyaltyPoints > 10000
+    || customerSegment == "enterprise-premium")
+  && !inBlacklist`,
+		},
+	}
+	for _, tt := range tests {
+		formatted, err := Format(tt.expr)
+		if !assert.NoError(t, err, tt.expr) {
+			continue
+		}
+		assert.Equal(t, tt.formatted, formatted, tt.expr)
+
+		// formatting is idempotent and keeps the syntax tree
+		again, err := Format(formatted)
+		assert.NoError(t, err, formatted)
+		assert.Equal(t, formatted, again, formatted)
+		assert.Equal(t, stripSpans(parse(tt.expr)), stripSpans(parse(formatted)), tt.expr)
+	}
+
+	_, err := Format(`1 +`)
+	assert.EqualError(t, err, "syntax error: unexpected $end")
+}
+
+// stripSpans removes the positions from the syntax tree, so trees of differently formatted expressions can be compared.
+func stripSpans(n *node) *node {
+	if n == nil {
+		return nil
+	}
+	stripped := *n
+	stripped.pos, stripped.end = 0, 0
+	stripped.args = make([]*node, len(n.args))
+	for i, arg := range n.args {
+		stripped.args[i] = stripSpans(arg)
+	}
+	return &stripped
+}
+
+func Test_Analyzer(t *testing.T) {
+	a := NewAnalyzer()
+	add := func(expr string) *AnalyzedCondition {
+		c, err := a.Add(expr)
+		if !assert.NoError(t, err, expr) {
+			t.FailNow()
+		}
+		return c
+	}
+
+	gold := add(`tier == "gold" && amount >= 100`)
+	goldEU := add(`tier == "gold" && amount > 200 && region in ["eu", "uk"]`)
+	silver := add(`tier in ["silver", "bronze"] && amount in 50..<500`)
+	rich := add(`amount between 300 and 1000 || user.vip`)
+	never := add(`amount > 10 && !(amount >= 5) || true && false`)
+	notSilver := add(`!(tier == "silver" || tier == "bronze") && amount >= 100`)
+
+	facts, ok := gold.Satisfiable()
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"tier": "gold", "amount": 100}, facts)
+
+	_, ok = never.Satisfiable()
+	assert.False(t, ok)
+
+	implied, _, err := goldEU.Implies(gold)
+	assert.NoError(t, err)
+	assert.True(t, implied)
+
+	implied, facts, err = gold.Implies(goldEU)
+	assert.NoError(t, err)
+	assert.False(t, implied)
+	assert.Equal(t, map[string]interface{}{"tier": "gold", "amount": 100, "region": "other"}, facts)
+
+	implied, _, err = gold.Implies(notSilver)
+	assert.NoError(t, err)
+	assert.True(t, implied)
+
+	_, ok = gold.Overlaps(silver)
+	assert.False(t, ok)
+
+	facts, ok = silver.Overlaps(rich)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"tier": "bronze", "amount": 300, "user": map[string]interface{}{"vip": true}}, facts)
+
+	facts, ok = gold.Overlaps(rich)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"tier": "gold", "amount": 300, "user": map[string]interface{}{"vip": true}}, facts)
+
+	vip := add(`user.vip`)
+	assert.True(t, gold.SharesVariables(goldEU))
+	assert.True(t, rich.SharesVariables(vip))
+	assert.False(t, gold.SharesVariables(vip))
+
+	_, err = a.Add(`len(tier) > 3`)
+	assert.ErrorIs(t, err, ErrNotAnalyzable)
+
+	_, err = a.Add(`amount == "100"`)
+	assert.ErrorIs(t, err, ErrNotAnalyzable)
+
+	_, err = a.Add(`amount >`)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNotAnalyzable)
+}
+
+func Test_AnalyzerWitness(t *testing.T) {
+	tests := []struct {
+		expr string
+		want map[string]interface{}
+	}{
+		{`x > 5`, map[string]interface{}{"x": 6}},
+		{`x > 5 && x < 6`, map[string]interface{}{"x": 5.5}},
+		{`x <= -2.5`, map[string]interface{}{"x": -3}},
+		{`x != 0 && x >= 0`, map[string]interface{}{"x": 1}},
+		{`x not in 0..`, map[string]interface{}{"x": -1}},
+		{`s != "other" && s not in ["a"]`, map[string]interface{}{"s": "other1"}},
+		{`!flag && user.address.zip == 1000`, map[string]interface{}{"flag": false, "user": map[string]interface{}{"address": map[string]interface{}{"zip": 1000}}}},
+		{`true`, map[string]interface{}{}},
+	}
+
+	for _, tt := range tests {
+		c, err := NewAnalyzer().Add(tt.expr)
+		if assert.NoError(t, err, tt.expr) {
+			facts, ok := c.Satisfiable()
+			assert.True(t, ok, tt.expr)
+			assert.Equal(t, tt.want, facts, tt.expr)
+		}
+	}
+}
+
+func Test_ProgramBinary(t *testing.T) {
+	vars := getTestVars()
+	exprs := []string{
+		`int > 1 + 1 && str == "abc"`,
+		`let x = obj.i * 2.5; x between 1 and 100 ? nil : [1, "a", true, {"k": -3}]`,
+		`arr[1:] != nil && obj?.missing ?? 0.25 >= -1.5`,
+		`count(filter(arr, # > 1)) in ..<10`,
+	}
+	for _, expr := range exprs {
+		program, err := Compile(expr)
+		if !assert.NoError(t, err, expr) {
+			continue
+		}
+		data, err := program.MarshalBinary()
+		if !assert.NoError(t, err, expr) {
+			continue
+		}
+
+		restored := &Program{}
+		if assert.NoError(t, restored.UnmarshalBinary(data), expr) {
+			assert.Equal(t, program, restored, expr)
+			want, wantErr := program.Evaluate(vars, nil)
+			got, err := restored.Evaluate(vars, nil)
+			assert.Equal(t, want, got, expr)
+			assert.Equal(t, wantErr, err, expr)
+		}
+
+		for _, corrupt := range [][]byte{nil, {2}, data[:len(data)-1], append(append([]byte{}, data...), 0)} {
+			assert.ErrorIs(t, (&Program{}).UnmarshalBinary(corrupt), ErrInvalidProgram, expr)
+		}
+	}
+}
+
+func Test_ProgramBinary_Invalid(t *testing.T) {
+	a := &node{typ: nodeVar, name: "a"}
+	r := &node{typ: nodeRange, op: "..", args: []*node{a, nil}}
+	tests := []struct {
+		name string
+		root *node
+	}{
+		{name: "missing operand", root: &node{typ: nodeBinary, op: "+", args: []*node{nil, a}}},
+		{name: "missing object", root: &node{typ: nodeMember, op: ".", name: "b", args: []*node{nil}}},
+		{name: "missing element", root: &node{typ: nodeArray, args: []*node{a, nil}}},
+		{name: "missing value", root: &node{typ: nodeObject, args: []*node{a}}},
+		{name: "unknown operator", root: &node{typ: nodeBinary, op: "**", args: []*node{a, a}}},
+		{name: "unexpected operator", root: &node{typ: nodeUnary, op: "+", args: []*node{a}}},
+		{name: "operator of ternary", root: &node{typ: nodeTernary, op: "?", args: []*node{a, a, a}}},
+		{name: "range", root: r},
+		{name: "range operand", root: &node{typ: nodeBinary, op: "==", args: []*node{a, r}}},
+		{name: "between", root: &node{typ: nodeBinary, op: "between", args: []*node{a, a}}},
+	}
+	for _, tt := range tests {
+		e := &encoder{buf: []byte{programEncoding}}
+		e.string("a")
+		e.node(tt.root)
+		assert.ErrorIs(t, (&Program{}).UnmarshalBinary(e.buf), ErrInvalidProgram, tt.name)
+	}
+
+	e := &encoder{buf: []byte{programEncoding}}
+	e.string("a[:]")
+	e.node(&node{typ: nodeSlice, args: []*node{a, nil, nil}})
+	assert.NoError(t, (&Program{}).UnmarshalBinary(e.buf))
+}
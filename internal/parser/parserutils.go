@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"runtime"
 	"strconv"
+	"strings"
 )
 
 func init() {
@@ -17,6 +18,12 @@ func init() {
 // The returned object needs to have one of the following types: `nil`, `bool`, `int`, `float64`, `string`, `[]interface{}` or `map[string]interface{}`.
 type ExpressionFunction = func(args ...interface{}) (interface{}, error)
 
+// TypeOf returns the name of the type of a value as used within expressions and their error messages,
+// i.e. "nil", "bool", "number", "string", "array" or "object".
+func TypeOf(val interface{}) string {
+	return typeOf(val)
+}
+
 func typeOf(val interface{}) string {
 	if val == nil {
 		return "nil"
@@ -47,7 +54,7 @@ func typeOf(val interface{}) string {
 func asBool(val interface{}) bool {
 	b, ok := val.(bool)
 	if !ok {
-		panic(fmt.Errorf("type error: required bool, but was %s", typeOf(val)))
+		panic(evalError("type", "required bool, but was %s", typeOf(val)))
 	}
 	return b
 }
@@ -59,12 +66,12 @@ func asInteger(val interface{}) int {
 	}
 	f, ok := val.(float64)
 	if !ok {
-		panic(fmt.Errorf("type error: required number of type integer, but was %s", typeOf(val)))
+		panic(evalError("type", "required number of type integer, but was %s", typeOf(val)))
 	}
 
 	i = int(f)
 	if float64(i) != f {
-		panic(fmt.Errorf("type error: cannot cast floating point number to integer without losing precision"))
+		panic(evalError("type", "cannot cast floating point number to integer without losing precision"))
 	}
 	return i
 }
@@ -144,7 +151,7 @@ func add(val1 interface{}, val2 interface{}) interface{} {
 		return sum
 	}
 
-	panic(fmt.Errorf("type error: cannot add or concatenate type %s and %s", typeOf(val1), typeOf(val2)))
+	panic(evalError("type", "cannot add or concatenate type %s and %s", typeOf(val1), typeOf(val2)))
 }
 
 func sub(val1 interface{}, val2 interface{}) interface{} {
@@ -170,7 +177,7 @@ func sub(val1 interface{}, val2 interface{}) interface{} {
 	if float1OK && float2OK {
 		return float1 - float2
 	}
-	panic(fmt.Errorf("type error: cannot subtract type %s and %s", typeOf(val1), typeOf(val2)))
+	panic(evalError("type", "cannot subtract type %s and %s", typeOf(val1), typeOf(val2)))
 }
 
 func mul(val1 interface{}, val2 interface{}) interface{} {
@@ -196,7 +203,7 @@ func mul(val1 interface{}, val2 interface{}) interface{} {
 	if float1OK && float2OK {
 		return float1 * float2
 	}
-	panic(fmt.Errorf("type error: cannot multiply type %s and %s", typeOf(val1), typeOf(val2)))
+	panic(evalError("type", "cannot multiply type %s and %s", typeOf(val1), typeOf(val2)))
 }
 
 func div(val1 interface{}, val2 interface{}) interface{} {
@@ -204,6 +211,9 @@ func div(val1 interface{}, val2 interface{}) interface{} {
 	int2, int2OK := val2.(int)
 
 	if int1OK && int2OK {
+		if int2 == 0 {
+			panic(evalError("eval", "integer division by zero"))
+		}
 		return int1 / int2
 	}
 
@@ -222,7 +232,7 @@ func div(val1 interface{}, val2 interface{}) interface{} {
 	if float1OK && float2OK {
 		return float1 / float2
 	}
-	panic(fmt.Errorf("type error: cannot divide type %s and %s", typeOf(val1), typeOf(val2)))
+	panic(evalError("type", "cannot divide type %s and %s", typeOf(val1), typeOf(val2)))
 }
 
 func mod(val1 interface{}, val2 interface{}) interface{} {
@@ -230,6 +240,9 @@ func mod(val1 interface{}, val2 interface{}) interface{} {
 	int2, int2OK := val2.(int)
 
 	if int1OK && int2OK {
+		if int2 == 0 {
+			panic(evalError("eval", "integer modulo by zero"))
+		}
 		return int1 % int2
 	}
 
@@ -248,7 +261,7 @@ func mod(val1 interface{}, val2 interface{}) interface{} {
 	if float1OK && float2OK {
 		return math.Mod(float1, float2)
 	}
-	panic(fmt.Errorf("type error: cannot perform modulo on type %s and %s", typeOf(val1), typeOf(val2)))
+	panic(evalError("type", "cannot perform modulo on type %s and %s", typeOf(val1), typeOf(val2)))
 }
 
 func unaryMinus(val interface{}) interface{} {
@@ -260,7 +273,12 @@ func unaryMinus(val interface{}) interface{} {
 	if ok {
 		return -floatVal
 	}
-	panic(fmt.Errorf("type error: unary minus requires number, but was %s", typeOf(val)))
+	panic(evalError("type", "unary minus requires number, but was %s", typeOf(val)))
+}
+
+// Equal reports whether two values are equal like the `==` operator does, e.g. 1 equals 1.0.
+func Equal(val1 interface{}, val2 interface{}) bool {
+	return deepEqual(val1, val2)
 }
 
 func deepEqual(val1 interface{}, val2 interface{}) bool {
@@ -338,7 +356,14 @@ func compare(val1 interface{}, val2 interface{}, operation string) bool {
 	if float1OK && float2OK {
 		return compareFloat(float1, float2, operation)
 	}
-	panic(fmt.Errorf("type error: cannot compare type %s and %s", typeOf(val1), typeOf(val2)))
+
+	str1, str1OK := val1.(string)
+	str2, str2OK := val2.(string)
+
+	if str1OK && str2OK {
+		return compareString(str1, str2, operation)
+	}
+	panic(evalError("type", "cannot compare type %s and %s", typeOf(val1), typeOf(val2)))
 }
 
 func compareInt(val1 int, val2 int, operation string) bool {
@@ -352,7 +377,7 @@ func compareInt(val1 int, val2 int, operation string) bool {
 	case ">=":
 		return val1 >= val2
 	}
-	panic(fmt.Errorf("syntax error: unsupported operation %q", operation))
+	panic(evalError("syntax", "unsupported operation %q", operation))
 }
 
 func compareFloat(val1 float64, val2 float64, operation string) bool {
@@ -366,13 +391,27 @@ func compareFloat(val1 float64, val2 float64, operation string) bool {
 	case ">=":
 		return val1 >= val2
 	}
-	panic(fmt.Errorf("syntax error: unsupported operation %q", operation))
+	panic(evalError("syntax", "unsupported operation %q", operation))
+}
+
+func compareString(val1 string, val2 string, operation string) bool {
+	switch operation {
+	case "<":
+		return val1 < val2
+	case "<=":
+		return val1 <= val2
+	case ">":
+		return val1 > val2
+	case ">=":
+		return val1 >= val2
+	}
+	panic(evalError("syntax", "unsupported operation %q", operation))
 }
 
 func asObjectKey(key interface{}) string {
 	s, ok := key.(string)
 	if !ok {
-		panic(fmt.Errorf("type error: object key must be string, but was %s", typeOf(key)))
+		panic(evalError("type", "object key must be string, but was %s", typeOf(key)))
 	}
 	return s
 }
@@ -381,16 +420,19 @@ func addObjectMember(obj map[string]interface{}, key, val interface{}) map[strin
 	s := asObjectKey(key)
 	_, ok := obj[s]
 	if ok {
-		panic(fmt.Errorf("syntax error: duplicate object key %q", s))
+		panic(evalError("syntax", "duplicate object key %q", s))
 	}
 	obj[s] = val
 	return obj
 }
 
-func accessVar(variables map[string]interface{}, varName string) interface{} {
-	val, ok := variables[varName]
+func accessVar(e *env, varName string) interface{} {
+	val, ok := e.lookup(varName)
+	if !ok && strings.HasPrefix(varName, "#") {
+		panic(evalError("var", "%q can only be used within a collection operation", varName))
+	}
 	if !ok {
-		panic(fmt.Errorf("var error: variable %q does not exist", varName))
+		panic(evalError("var", "variable %q does not exist", varName))
 	}
 	return val
 }
@@ -400,11 +442,11 @@ func accessField(s interface{}, field interface{}) interface{} {
 	if ok {
 		key, ok := field.(string)
 		if !ok {
-			panic(fmt.Errorf("syntax error: object key must be string, but was %s", typeOf(field)))
+			panic(evalError("syntax", "object key must be string, but was %s", typeOf(field)))
 		}
 		val, ok := obj[key]
 		if !ok {
-			panic(fmt.Errorf("var error: object has no member %q", field))
+			panic(evalError("var", "object has no member %q", field))
 		}
 		return val
 	}
@@ -415,21 +457,46 @@ func accessField(s interface{}, field interface{}) interface{} {
 		if !ok {
 			floatIdx, ok := field.(float64)
 			if !ok {
-				panic(fmt.Errorf("syntax error: array index must be number, but was %s", typeOf(field)))
+				panic(evalError("syntax", "array index must be number, but was %s", typeOf(field)))
 			}
 			intIdx = int(floatIdx)
 			if float64(intIdx) != floatIdx {
-				panic(fmt.Errorf("eval error: array index must be whole number, but was %f", floatIdx))
+				panic(evalError("eval", "array index must be whole number, but was %f", floatIdx))
 			}
 		}
 
 		if intIdx < 0 || intIdx >= len(arrVar) {
-			panic(fmt.Errorf("var error: array index %d is out of range [%d, %d]", intIdx, 0, len(arrVar)))
+			panic(evalError("var", "array index %d is out of range [%d, %d]", intIdx, 0, len(arrVar)))
 		}
 		return arrVar[intIdx]
 	}
 
-	panic(fmt.Errorf("syntax error: cannot access fields on type %s", typeOf(s)))
+	panic(evalError("syntax", "cannot access fields on type %s", typeOf(s)))
+}
+
+// accessFieldOptional works like accessField, but resolves to nil instead of
+// failing if s is nil, the object has no such member or the index is out of range.
+func accessFieldOptional(s interface{}, field interface{}) interface{} {
+	if s == nil {
+		return nil
+	}
+
+	if obj, ok := s.(map[string]interface{}); ok {
+		if key, ok := field.(string); ok {
+			return obj[key]
+		}
+	}
+
+	if arr, ok := s.([]interface{}); ok {
+		if idx, ok := field.(int); ok && (idx < 0 || idx >= len(arr)) {
+			return nil
+		}
+		if idx, ok := field.(float64); ok && (idx < 0 || idx >= float64(len(arr))) {
+			return nil
+		}
+	}
+
+	return accessField(s, field)
 }
 
 func slice(v interface{}, from, to interface{}) interface{} {
@@ -437,7 +504,15 @@ func slice(v interface{}, from, to interface{}) interface{} {
 	arr, isArr := v.([]interface{})
 
 	if !isStr && !isArr {
-		panic(fmt.Errorf("syntax error: slicing requires an array or string, but was %s", typeOf(v)))
+		panic(evalError("syntax", "slicing requires an array or string, but was %s", typeOf(v)))
+	}
+
+	// strings are sliced by characters rather than bytes
+	var runes []rune
+	length := len(arr)
+	if isStr {
+		runes = []rune(str)
+		length = len(runes)
 	}
 
 	var fromInt, toInt int
@@ -447,33 +522,24 @@ func slice(v interface{}, from, to interface{}) interface{} {
 		fromInt = asInteger(from)
 	}
 
-	if to == nil && isStr {
-		toInt = len(str)
-	} else if to == nil && isArr {
-		toInt = len(arr)
+	if to == nil {
+		toInt = length
 	} else {
 		toInt = asInteger(to)
 	}
 
 	if fromInt < 0 {
-		panic(fmt.Errorf("range error: start-index %d is negative", fromInt))
+		panic(evalError("range", "start-index %d is negative", fromInt))
 	}
-
-	if isStr {
-		if toInt < 0 || toInt > len(str) {
-			panic(fmt.Errorf("range error: end-index %d is out of range [0, %d]", toInt, len(str)))
-		}
-		if fromInt > toInt {
-			panic(fmt.Errorf("range error: start-index %d is greater than end-index %d", fromInt, toInt))
-		}
-		return str[fromInt:toInt]
-	}
-
-	if toInt < 0 || toInt > len(arr) {
-		panic(fmt.Errorf("range error: end-index %d is out of range [0, %d]", toInt, len(arr)))
+	if toInt < 0 || toInt > length {
+		panic(evalError("range", "end-index %d is out of range [0, %d]", toInt, length))
 	}
 	if fromInt > toInt {
-		panic(fmt.Errorf("range error: start-index %d is greater than end-index %d", fromInt, toInt))
+		panic(evalError("range", "start-index %d is greater than end-index %d", fromInt, toInt))
+	}
+
+	if isStr {
+		return string(runes[fromInt:toInt])
 	}
 	return arr[fromInt:toInt]
 }
@@ -481,7 +547,7 @@ func slice(v interface{}, from, to interface{}) interface{} {
 func arrayContains(arr interface{}, val interface{}) bool {
 	a, ok := arr.([]interface{})
 	if !ok {
-		panic(fmt.Errorf("syntax error: in-operator requires array, but was %s", typeOf(arr)))
+		panic(evalError("syntax", "in-operator requires array, but was %s", typeOf(arr)))
 	}
 
 	for _, v := range a {
@@ -492,15 +558,78 @@ func arrayContains(arr interface{}, val interface{}) bool {
 	return false
 }
 
+func shiftLeft(val, shift int) int {
+	if shift >= 0 {
+		return val << uint(shift)
+	}
+	return val >> uint(-shift)
+}
+
+func shiftRight(val, shift int) int {
+	if shift >= 0 {
+		return val >> uint(shift)
+	}
+	return val << uint(-shift)
+}
+
+func asStrings(operation string, val1, val2 interface{}) (string, string) {
+	str1, ok1 := val1.(string)
+	str2, ok2 := val2.(string)
+	if !ok1 || !ok2 {
+		panic(evalError("type", "%s requires string and string, but was %s and %s", operation, typeOf(val1), typeOf(val2)))
+	}
+	return str1, str2
+}
+
+func startsWith(val1, val2 interface{}) bool {
+	str, prefix := asStrings("startsWith", val1, val2)
+	return strings.HasPrefix(str, prefix)
+}
+
+func endsWith(val1, val2 interface{}) bool {
+	str, suffix := asStrings("endsWith", val1, val2)
+	return strings.HasSuffix(str, suffix)
+}
+
+// contains reports whether the array collection contains the element val,
+// the string collection contains the substring val or the object collection contains the key val.
+func contains(operation string, collection, val interface{}) bool {
+	switch c := collection.(type) {
+	case []interface{}:
+		return arrayContains(c, val)
+	case string:
+		substr, ok := val.(string)
+		if !ok {
+			panic(evalError("type", "%s requires string to search within string, but was %s", operation, typeOf(val)))
+		}
+		return strings.Contains(c, substr)
+	case map[string]interface{}:
+		_, ok := c[asObjectKey(val)]
+		return ok
+	}
+	panic(evalError("syntax", "%s requires array, string or object, but was %s", operation, typeOf(collection)))
+}
+
+// equalFold compares strings case-insensitively using Unicode case-folding.
+// Any other values are compared like with deepEqual.
+func equalFold(val1, val2 interface{}) bool {
+	str1, ok1 := val1.(string)
+	str2, ok2 := val2.(string)
+	if ok1 && ok2 {
+		return strings.EqualFold(str1, str2)
+	}
+	return deepEqual(val1, val2)
+}
+
 func callFunction(functions map[string]ExpressionFunction, name string, args []interface{}) interface{} {
 	f, ok := functions[name]
 	if !ok {
-		panic(fmt.Errorf("syntax error: no such function %q", name))
+		panic(evalError("syntax", "no such function %q", name))
 	}
 
 	res, err := callAndRecover(f, args)
 	if err != nil {
-		panic(fmt.Errorf("function error: %q - %w", name, err))
+		panic(evalError("function", "%q - %w", name, err))
 	}
 	return res
 }
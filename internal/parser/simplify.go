@@ -0,0 +1,232 @@
+package parser
+
+import "math"
+
+// Program is a parsed and simplified expression, which can be evaluated repeatedly without parsing it again.
+type Program struct {
+	source string
+	root   *node
+}
+
+// Compile parses and simplifies the expression.
+func Compile(str string) (program *Program, err error) {
+	defer recoverError(&err)
+
+	return &Program{source: str, root: parse(str).simplify()}, nil
+}
+
+// Simplify returns the simplified expression, formatted like Format does.
+func Simplify(str string) (string, error) {
+	program, err := Compile(str)
+	if err != nil {
+		return "", err
+	}
+	return program.String(), nil
+}
+
+// Source returns the expression the program was compiled from.
+func (p *Program) Source() string {
+	return p.source
+}
+
+// String returns the simplified expression.
+func (p *Program) String() string {
+	return p.root.format()
+}
+
+// Constant returns the result of the program if it does not depend on variables or functions.
+func (p *Program) Constant() (interface{}, bool) {
+	if p.root.typ == nodeLiteral {
+		return p.root.value, true
+	}
+	return nil, false
+}
+
+// Evaluate evaluates the program like Evaluate evaluates its source.
+func (p *Program) Evaluate(
+	variables map[string]interface{},
+	functions map[string]ExpressionFunction,
+) (result interface{}, err error) {
+	defer recoverError(&err)
+
+	return p.root.eval(newEnv(variables, functions)), nil
+}
+
+// simplify returns an equivalent syntax tree in which
+//   - operations on constants are replaced by their result, e.g. `1 + 2` by `3`,
+//   - identity operations are removed, e.g. `true && x > 1` and `x * 1` by `x > 1` and `x`,
+//   - double negations are removed, e.g. `!!(x > 1)` by `x > 1`,
+//   - ternaries with a constant condition are replaced by the branch taken, e.g. `true ? a : "b"` by `a`.
+//
+// The simplified tree results in the same values and errors as the original one: operations failing are kept,
+// operands are only removed by the rewrites if they are known to be of the type the operator requires,
+// e.g. bool for `&&`, and the branch not taken only if it cannot fail, as ternaries resolve both branches.
+// Calls are never simplified, as functions might have side effects.
+func (n *node) simplify() *node {
+	if len(n.args) == 0 {
+		return n
+	}
+
+	simplified := *n
+	simplified.args = make([]*node, len(n.args))
+	for i, arg := range n.args {
+		if arg != nil {
+			simplified.args[i] = arg.simplify()
+		}
+	}
+	n = &simplified
+
+	if n.typ != nodeCall && n.typ != nodeArray && n.typ != nodeObject && n.typ != nodeRange && n.allArgsConstant() {
+		if val, ok := n.fold(); ok {
+			return n.replaceBy(&node{typ: nodeLiteral, value: val})
+		}
+	}
+
+	switch n.typ {
+	case nodeUnary:
+		// !!x is x for bool x, and --x is x for numbers
+		operand := n.args[0]
+		if operand.typ == nodeUnary && operand.op == n.op {
+			if n.op == "!" && operand.args[0].isBool() || n.op == "-" && operand.args[0].isNumber() {
+				return n.replaceBy(operand.args[0])
+			}
+		}
+
+	case nodeBinary:
+		left, right := n.args[0], n.args[1]
+		switch n.op {
+		case "&&":
+			switch {
+			case isLiteral(left, true) && right.isBool():
+				return n.replaceBy(right)
+			case isLiteral(right, true) && left.isBool():
+				return n.replaceBy(left)
+			}
+		case "||":
+			switch {
+			case isLiteral(left, false) && right.isBool():
+				return n.replaceBy(right)
+			case isLiteral(right, false) && left.isBool():
+				return n.replaceBy(left)
+			}
+		case "*":
+			switch {
+			case isLiteral(left, 1) && right.isNumber():
+				return n.replaceBy(right)
+			case isLiteral(right, 1) && left.isNumber():
+				return n.replaceBy(left)
+			}
+		case "/":
+			if isLiteral(right, 1) && left.isNumber() {
+				return n.replaceBy(left)
+			}
+		case "-":
+			if isLiteral(right, 0) && left.isNumber() {
+				return n.replaceBy(left)
+			}
+		}
+
+	case nodeTernary:
+		if cond, ok := n.args[0].value.(bool); ok && n.args[0].typ == nodeLiteral {
+			taken, skipped := n.args[1], n.args[2]
+			if !cond {
+				taken, skipped = skipped, taken
+			}
+			if skipped.isConstant() {
+				return n.replaceBy(taken)
+			}
+		}
+	}
+	return n
+}
+
+// isLiteral reports whether the node is the literal val. The types have to match exactly,
+// e.g. `x * 1.0` is no identity operation, as it turns integers into floats.
+func isLiteral(n *node, val interface{}) bool {
+	return n.typ == nodeLiteral && n.value == val
+}
+
+// isBool reports whether the node results in a bool unless it fails.
+func (n *node) isBool() bool {
+	switch n.typ {
+	case nodeLiteral:
+		_, ok := n.value.(bool)
+		return ok
+	case nodeUnary:
+		return n.op == "!"
+	case nodeBinary:
+		return resultType(n.op) == "bool"
+	case nodeTernary:
+		return n.args[1].isBool() && n.args[2].isBool()
+	case nodeLet:
+		return n.args[1].isBool()
+	}
+	return false
+}
+
+// isNumber reports whether the node results in an int or a float unless it fails.
+func (n *node) isNumber() bool {
+	switch n.typ {
+	case nodeLiteral:
+		switch n.value.(type) {
+		case int, float64:
+			return true
+		}
+		return false
+	case nodeUnary:
+		return n.op == "-" || n.op == "~"
+	case nodeBinary:
+		return resultType(n.op) == "number"
+	case nodeTernary:
+		return n.args[1].isNumber() && n.args[2].isNumber()
+	case nodeLet:
+		return n.args[1].isNumber()
+	}
+	return false
+}
+
+// replaceBy returns the replacement with the span of n, so positions still refer to the whole replaced part.
+func (n *node) replaceBy(replacement *node) *node {
+	r := *replacement
+	r.pos, r.end = n.pos, n.end
+	return &r
+}
+
+// isConstant reports whether the node always results in the same value.
+func (n *node) isConstant() bool {
+	switch n.typ {
+	case nodeLiteral:
+		return true
+	case nodeArray, nodeObject, nodeRange:
+		return n.allArgsConstant()
+	}
+	return false
+}
+
+func (n *node) allArgsConstant() bool {
+	for _, arg := range n.args {
+		if arg != nil && !arg.isConstant() {
+			return false
+		}
+	}
+	return true
+}
+
+// fold evaluates a node with constant operands. Only results which can be written as literal are used,
+// and operations failing are kept, so their error is still reported during evaluation.
+func (n *node) fold() (val interface{}, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			val, ok = nil, false
+		}
+	}()
+
+	val = n.evalNode(newEnv(nil, nil))
+	switch v := val.(type) {
+	case nil, bool, int, string:
+		return val, true
+	case float64:
+		return val, !math.IsInf(v, 0) && !math.IsNaN(v)
+	}
+	return nil, false
+}
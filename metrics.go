@@ -0,0 +1,290 @@
+package gorule
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// Categories of the errors of rules reported to Metrics.
+const (
+	ErrorSyntax     = "syntax"      // the condition cannot be parsed or uses unknown functions or operations
+	ErrorType       = "type"        // an operation was applied to values of the wrong type
+	ErrorVariable   = "variable"    // a variable does not exist
+	ErrorFunction   = "function"    // a function returned an error
+	ErrorEval       = "eval"        // any other error during the evaluation
+	ErrorNonBoolean = "non_boolean" // the condition did not result in a bool
+)
+
+// errorCategory returns the category of an error of evaluating a condition, taken from the kind of the parser error.
+func errorCategory(err error) string {
+	var syntaxErr *parser.Error
+	if errors.As(err, &syntaxErr) {
+		return ErrorSyntax
+	}
+
+	var evalErr *parser.EvalError
+	if errors.As(err, &evalErr) {
+		switch evalErr.Kind {
+		case "syntax":
+			return ErrorSyntax
+		case "type":
+			return ErrorType
+		case "var":
+			return ErrorVariable
+		case "function":
+			return ErrorFunction
+		}
+	}
+	return ErrorEval
+}
+
+// Metrics receives measurements of Match, e.g. to export them to a monitoring system. Implementations have to be
+// safe for concurrent use and fast, as they are called for every rule evaluated.
+type Metrics interface {
+	// ObserveRule is called for every rule evaluated with the time it took to evaluate its condition, whether it matched,
+	// and the category of the error, e.g. ErrorType, or "" if the evaluation succeeded.
+	ObserveRule(rule string, duration time.Duration, matched bool, category string)
+	// ObserveMatch is called for every call of Match with the time it took, not including the evaluation of a shadow
+	// candidate, and the error returned.
+	ObserveMatch(duration time.Duration, err error)
+}
+
+// WithMetrics reports measurements of Match to m.
+func WithMetrics(m Metrics) Option {
+	return func(e *Engine) {
+		e.metrics = m
+	}
+}
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the latency histograms of PrometheusMetrics,
+// from 10µs to 100ms, unless set by NewPrometheusMetrics.
+var DefaultLatencyBuckets = []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1}
+
+// PrometheusMetrics is a Metrics keeping the measurements in memory and writing them in the Prometheus text format.
+// It is an http.Handler, so it can be scraped directly:
+//
+//	metrics := gorule.NewPrometheusMetrics()
+//	engine := gorule.NewEngine(gorule.WithMetrics(metrics))
+//	http.Handle("/metrics", metrics)
+//
+// It exports
+//
+//	gorule_match_duration_seconds                   histogram of the duration of Match
+//	gorule_match_errors_total                       counter of Match calls returning an error
+//	gorule_rule_evaluation_duration_seconds{rule}   histogram of the duration of evaluating the condition of each rule
+//	gorule_rule_matches_total{rule}                 counter of the matches of each rule
+//	gorule_rule_errors_total{rule,category}         counter of the errors of each rule by category
+//
+// The hit rate of a rule is its matches divided by the count of its evaluation duration.
+type PrometheusMetrics struct {
+	mu      sync.Mutex
+	buckets []float64
+	match   *histogram
+	errors  uint64
+	rules   map[string]*ruleMetrics
+}
+
+type ruleMetrics struct {
+	duration *histogram
+	matches  uint64
+	errors   map[string]uint64 // by category
+}
+
+type histogram struct {
+	counts []uint64 // by bucket, the last one being +Inf, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	// the upper bounds are inclusive, so v goes to the first bucket whose bound is not less than v
+	h.counts[sort.SearchFloat64s(buckets, v)]++
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) copy() *histogram {
+	return &histogram{counts: append([]uint64(nil), h.counts...), count: h.count, sum: h.sum}
+}
+
+// NewPrometheusMetrics creates empty metrics. buckets are the upper bounds in seconds of the latency histograms,
+// DefaultLatencyBuckets if none are given.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusMetrics{buckets: buckets, match: newHistogram(buckets), rules: make(map[string]*ruleMetrics)}
+}
+
+// ObserveRule implements Metrics.
+func (m *PrometheusMetrics) ObserveRule(rule string, duration time.Duration, matched bool, category string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rm, ok := m.rules[rule]
+	if !ok {
+		rm = &ruleMetrics{duration: newHistogram(m.buckets), errors: make(map[string]uint64)}
+		m.rules[rule] = rm
+	}
+	rm.duration.observe(m.buckets, duration.Seconds())
+	if matched {
+		rm.matches++
+	}
+	if category != "" {
+		rm.errors[category]++
+	}
+}
+
+// ObserveMatch implements Metrics.
+func (m *PrometheusMetrics) ObserveMatch(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.match.observe(m.buckets, duration.Seconds())
+	if err != nil {
+		m.errors++
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text format, version 0.0.4, with the rules ordered by name.
+// The metrics are copied first, so a slow writer does not block the measurements.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	match, errs, rules := m.snapshot()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	header(bw, "gorule_match_duration_seconds", "histogram", "Duration of Match calls.")
+	m.writeHistogram(bw, "gorule_match_duration_seconds", "", match)
+	header(bw, "gorule_match_errors_total", "counter", "Match calls returning an error.")
+	fmt.Fprintf(bw, "gorule_match_errors_total %d\n", errs)
+
+	header(bw, "gorule_rule_evaluation_duration_seconds", "histogram", "Duration of evaluating the condition of a rule.")
+	for _, name := range names {
+		m.writeHistogram(bw, "gorule_rule_evaluation_duration_seconds", labels("rule", name), rules[name].duration)
+	}
+	header(bw, "gorule_rule_matches_total", "counter", "Matches of a rule.")
+	for _, name := range names {
+		fmt.Fprintf(bw, "gorule_rule_matches_total{%s} %d\n", labels("rule", name), rules[name].matches)
+	}
+	header(bw, "gorule_rule_errors_total", "counter", "Errors of evaluating the condition of a rule by category.")
+	for _, name := range names {
+		ruleErrs := rules[name].errors
+		categories := make([]string, 0, len(ruleErrs))
+		for category := range ruleErrs {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			fmt.Fprintf(bw, "gorule_rule_errors_total{%s} %d\n", labels("rule", name, "category", category), ruleErrs[category])
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// snapshot returns copies of the measurements taken under the lock.
+func (m *PrometheusMetrics) snapshot() (match *histogram, errs uint64, rules map[string]*ruleMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules = make(map[string]*ruleMetrics, len(m.rules))
+	for name, rm := range m.rules {
+		copied := &ruleMetrics{duration: rm.duration.copy(), matches: rm.matches, errors: make(map[string]uint64, len(rm.errors))}
+		for category, n := range rm.errors {
+			copied.errors[category] = n
+		}
+		rules[name] = copied
+	}
+	return m.match.copy(), m.errors, rules
+}
+
+func (m *PrometheusMetrics) writeHistogram(w io.Writer, name, lbls string, h *histogram) {
+	sep := ""
+	if lbls != "" {
+		sep = ","
+	}
+
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(m.buckets) {
+			le = formatFloat(m.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=%q} %d\n", name, lbls, sep, le, cumulative)
+	}
+	if lbls != "" {
+		lbls = "{" + lbls + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, lbls, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, lbls, h.count)
+}
+
+// ServeHTTP writes the metrics, see WriteTo.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats pairs of label names and values, e.g. rule="vip",category="type".
+func labels(pairs ...string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(pairs[i])
+		sb.WriteString(`="`)
+		sb.WriteString(labelEscaper.Replace(pairs[i+1]))
+		sb.WriteByte('"')
+	}
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
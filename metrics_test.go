@@ -0,0 +1,220 @@
+package gorule
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+func Test_errorCategory(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      string
+	}{
+		{condition: "age >=", want: ErrorSyntax},
+		{condition: "unknown(age)", want: ErrorSyntax},
+		{condition: "age + true > 1", want: ErrorType},
+		{condition: "missing > 1", want: ErrorVariable},
+		{condition: "fail()", want: ErrorFunction},
+		{condition: "any([1])", want: ErrorFunction},
+		{condition: "mislead()", want: ErrorFunction},
+		{condition: "reduce([], # + #acc)", want: ErrorEval},
+	}
+	functions := map[string]parser.ExpressionFunction{
+		"fail": func(args ...interface{}) (interface{}, error) { return nil, errors.New("bad function") },
+		// the category is taken from the kind of the error, not from the message of the function
+		"mislead": func(args ...interface{}) (interface{}, error) { return nil, errors.New("type error: bad function") },
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			_, err := parser.Evaluate(tt.condition, map[string]interface{}{"age": 20}, functions)
+			if err == nil {
+				t.Fatalf("Evaluate(%q) succeeded", tt.condition)
+			}
+			if got := errorCategory(err); got != tt.want {
+				t.Errorf("errorCategory(%v) = %s, want %s", err, got, tt.want)
+			}
+		})
+	}
+}
+
+type observation struct {
+	rule     string
+	matched  bool
+	category string
+}
+
+// recordingMetrics records the observations, ignoring the durations.
+type recordingMetrics struct {
+	mu      sync.Mutex
+	rules   []observation
+	matches []error
+}
+
+func (m *recordingMetrics) ObserveRule(rule string, duration time.Duration, matched bool, category string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = append(m.rules, observation{rule: rule, matched: matched, category: category})
+}
+
+func (m *recordingMetrics) ObserveMatch(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.matches = append(m.matches, err)
+}
+
+func TestEngine_WithMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		rules    []*Rule
+		vars     map[string]interface{}
+		wantErr  bool
+		wantRule []observation
+	}{
+		{
+			name:   "match skipping bad rules",
+			config: &Config{SkipBadRuleDuringMatch: true},
+			rules:  []*Rule{NewRule("adult", "age >= 18", nil), NewRule("named", "name", nil)},
+			vars:   map[string]interface{}{"age": 20, "name": "a"},
+			wantRule: []observation{
+				{rule: "adult", matched: true},
+				{rule: "named", category: ErrorNonBoolean},
+			},
+		},
+		{
+			name:     "error",
+			config:   &Config{},
+			rules:    []*Rule{NewRule("adult", "age + 0 >= 18", nil)},
+			vars:     map[string]interface{}{"age": "20"},
+			wantErr:  true,
+			wantRule: []observation{{rule: "adult", category: ErrorType}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &recordingMetrics{}
+			e := NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithConfig(tt.config), WithMetrics(metrics))
+			if _, err := e.Reload(tt.rules); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := e.Match(tt.vars, nil); (err != nil) != tt.wantErr {
+				t.Fatalf("Match() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			sort.Slice(metrics.rules, func(i, j int) bool { return metrics.rules[i].rule < metrics.rules[j].rule })
+			if !reflect.DeepEqual(metrics.rules, tt.wantRule) {
+				t.Errorf("ObserveRule() = %+v, want %+v", metrics.rules, tt.wantRule)
+			}
+			if len(metrics.matches) != 1 || (metrics.matches[0] != nil) != tt.wantErr {
+				t.Errorf("ObserveMatch() = %v, want one call with error %v", metrics.matches, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics(1, 0.1)
+	m.ObserveRule("vip", 50*time.Millisecond, true, "")
+	m.ObserveRule("vip", 2*time.Second, false, "")
+	m.ObserveRule(`say "hi"`, 100*time.Millisecond, false, ErrorVariable)
+	m.ObserveMatch(200*time.Millisecond, nil)
+	m.ObserveMatch(100*time.Millisecond, errors.New("failed"))
+
+	want := `# HELP gorule_match_duration_seconds Duration of Match calls.
+# TYPE gorule_match_duration_seconds histogram
+gorule_match_duration_seconds_bucket{le="0.1"} 1
+gorule_match_duration_seconds_bucket{le="1"} 2
+gorule_match_duration_seconds_bucket{le="+Inf"} 2
+gorule_match_duration_seconds_sum 0.30000000000000004
+gorule_match_duration_seconds_count 2
+# HELP gorule_match_errors_total Match calls returning an error.
+# TYPE gorule_match_errors_total counter
+gorule_match_errors_total 1
+# HELP gorule_rule_evaluation_duration_seconds Duration of evaluating the condition of a rule.
+# TYPE gorule_rule_evaluation_duration_seconds histogram
+gorule_rule_evaluation_duration_seconds_bucket{rule="say \"hi\"",le="0.1"} 1
+gorule_rule_evaluation_duration_seconds_bucket{rule="say \"hi\"",le="1"} 1
+gorule_rule_evaluation_duration_seconds_bucket{rule="say \"hi\"",le="+Inf"} 1
+gorule_rule_evaluation_duration_seconds_sum{rule="say \"hi\""} 0.1
+gorule_rule_evaluation_duration_seconds_count{rule="say \"hi\""} 1
+gorule_rule_evaluation_duration_seconds_bucket{rule="vip",le="0.1"} 1
+gorule_rule_evaluation_duration_seconds_bucket{rule="vip",le="1"} 1
+gorule_rule_evaluation_duration_seconds_bucket{rule="vip",le="+Inf"} 2
+gorule_rule_evaluation_duration_seconds_sum{rule="vip"} 2.05
+gorule_rule_evaluation_duration_seconds_count{rule="vip"} 2
+# HELP gorule_rule_matches_total Matches of a rule.
+# TYPE gorule_rule_matches_total counter
+gorule_rule_matches_total{rule="say \"hi\""} 0
+gorule_rule_matches_total{rule="vip"} 1
+# HELP gorule_rule_errors_total Errors of evaluating the condition of a rule by category.
+# TYPE gorule_rule_errors_total counter
+gorule_rule_errors_total{rule="say \"hi\"",category="variable"} 1
+`
+	var sb strings.Builder
+	n, err := m.WriteTo(&sb)
+	if err != nil || n != int64(len(want)) {
+		t.Errorf("WriteTo() = %d, %v, want %d, nil", n, err, len(want))
+	}
+	if sb.String() != want {
+		t.Errorf("WriteTo() wrote\n%s\nwant\n%s", sb.String(), want)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %s", got)
+	}
+	if rec.Body.String() != want {
+		t.Errorf("ServeHTTP() wrote\n%s", rec.Body.String())
+	}
+}
+
+// blockingWriter blocks writes until release is closed.
+type blockingWriter struct {
+	writing chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.release
+	return len(p), nil
+}
+
+func TestPrometheusMetrics_SlowWriter(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.ObserveRule("vip", time.Millisecond, true, "")
+
+	w := &blockingWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	written := make(chan struct{})
+	go func() {
+		_, _ = m.WriteTo(w)
+		close(written)
+	}()
+	<-w.writing
+
+	observed := make(chan struct{})
+	go func() {
+		m.ObserveRule("vip", time.Millisecond, false, ErrorType)
+		m.ObserveMatch(time.Millisecond, nil)
+		close(observed)
+	}()
+	select {
+	case <-observed:
+	case <-time.After(time.Second):
+		t.Error("ObserveRule() blocked by WriteTo()")
+	}
+	close(w.release)
+	<-written
+}
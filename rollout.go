@@ -0,0 +1,261 @@
+package gorule
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrExperimentExists   = errors.New("experiment name already exists")
+	ErrInvalidExperiment  = errors.New("invalid experiment")
+	ErrExperimentNotFound = errors.New("experiment not found")
+)
+
+// Buckets is the number of buckets facts are assigned to by a rollout or an experiment, so a percentage
+// can be given with a precision of 0.01.
+const Buckets = 10000
+
+type rollout struct {
+	percent float64
+	key     string
+}
+
+// WithRollout matches rule only for percent (0 to 100) of the facts, e.g. 10 for 10% of the users.
+// The facts are assigned to a bucket by a stable hash of the value of the variable key, e.g. "userId" or "user.id",
+// and the name of the rule, so the same facts always get the same decision and raising the percentage
+// keeps the facts already included. Facts without the variable are never included.
+func WithRollout(percent float64, key string) RuleOption {
+	return func(r *Rule) {
+		r.rollout = &rollout{percent: percent, key: key}
+	}
+}
+
+// WithVariant makes rule part of the variant of an experiment, see Engine.AddExperiment.
+// The rule is only matched for facts assigned to the variant. Engines reject the rule unless they have the variant.
+func WithVariant(experiment, variant string) RuleOption {
+	return func(r *Rule) {
+		r.experiment, r.variant = experiment, variant
+	}
+}
+
+// Rollout returns the percentage of facts rule is matched for and the variable they are assigned by.
+// ok is false if the rule has no rollout.
+func (r *Rule) Rollout() (percent float64, key string, ok bool) {
+	if r.rollout == nil {
+		return 100, "", false
+	}
+	return r.rollout.percent, r.rollout.key, true
+}
+
+// Variant returns the experiment and the variant rule is part of, which are empty if there is none.
+func (r *Rule) Variant() (experiment, variant string) {
+	return r.experiment, r.variant
+}
+
+// Experiment divides facts into groups, the variants, by a stable hash of the value of the variable Key,
+// e.g. "userId". The weights of the variants are percentages adding up to at most 100;
+// facts assigned to none of them match no rule of the experiment.
+type Experiment struct {
+	Name     string    `json:"name"`
+	Key      string    `json:"key"`
+	Variants []Variant `json:"variants"`
+}
+
+// Variant is a group of an experiment.
+type Variant struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+}
+
+func (x *Experiment) validate() error {
+	if x.Name == "" || x.Key == "" {
+		return fmt.Errorf("%w: experiment needs a name and a key", ErrInvalidExperiment)
+	}
+	total := 0.0
+	seen := make(map[string]bool, len(x.Variants))
+	for _, v := range x.Variants {
+		if v.Name == "" || seen[v.Name] {
+			return fmt.Errorf("%w: %s: variant names have to be unique and not empty", ErrInvalidExperiment, x.Name)
+		}
+		if v.Weight < 0 {
+			return fmt.Errorf("%w: %s: variant %s has a negative weight", ErrInvalidExperiment, x.Name, v.Name)
+		}
+		seen[v.Name] = true
+		total += v.Weight
+	}
+	if total > 100 {
+		return fmt.Errorf("%w: %s: the weights of the variants add up to more than 100", ErrInvalidExperiment, x.Name)
+	}
+	return nil
+}
+
+// WithExperiments adds the experiments to the engine like AddExperiment, before the rules of a store set by
+// WithStore are loaded. Errors are logged.
+func WithExperiments(experiments ...Experiment) Option {
+	return func(e *Engine) {
+		e.initialExperiments = append(e.initialExperiments, experiments...)
+	}
+}
+
+// AddExperiment adds the experiment, whose variants rules can be part of, see WithVariant.
+// Return error if the experiment name exists or the experiment is invalid.
+func (e *Engine) AddExperiment(x Experiment) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	experiments, err := addExperiments(e.experiments, x)
+	if err != nil {
+		return err
+	}
+	// the map is replaced rather than changed, as a running Match might read it
+	e.experiments = experiments
+	return nil
+}
+
+// addExperiments returns a copy of experiments with the experiments added.
+// Return error if an experiment name exists or an experiment is invalid.
+func addExperiments(experiments map[string]*Experiment, add ...Experiment) (map[string]*Experiment, error) {
+	res := make(map[string]*Experiment, len(experiments)+len(add))
+	for name, x := range experiments {
+		res[name] = x
+	}
+	for _, x := range add {
+		if err := x.validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := res[x.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrExperimentExists, x.Name)
+		}
+		x.Variants = append([]Variant(nil), x.Variants...)
+		res[x.Name] = &x
+	}
+	return res, nil
+}
+
+// checkVariant returns an error if rule is part of a variant the experiments lack, as it would never be matched.
+func checkVariant(experiments map[string]*Experiment, rule *Rule) error {
+	if rule.experiment == "" {
+		return nil
+	}
+	if x, ok := experiments[rule.experiment]; ok {
+		for _, v := range x.Variants {
+			if v.Name == rule.variant {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: rule %s is part of variant %s of experiment %s", ErrExperimentNotFound, rule.Name(), rule.variant, rule.experiment)
+}
+
+// Assignment is the bucket facts were assigned to, either by an experiment or by the rollout of a rule.
+type Assignment struct {
+	Experiment string `json:"experiment,omitempty"`
+	Variant    string `json:"variant,omitempty"` // empty if the facts are assigned to no variant
+	Rule       string `json:"rule,omitempty"`
+	Included   bool   `json:"included,omitempty"` // whether the rule was included by its rollout
+	Bucket     int    `json:"bucket"`             // from 0 to Buckets-1
+}
+
+// bucket assigns value to one of Buckets buckets by a stable hash, salted so rollouts and experiments are independent.
+func bucket(salt string, value interface{}) int {
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(fmt.Sprint(value)))
+	return int(h.Sum64() % Buckets)
+}
+
+// threshold returns the number of buckets making up percent.
+func threshold(percent float64) int {
+	return int(math.Round(percent * Buckets / 100))
+}
+
+// lookupKey returns the value of the variable key, which can refer to the field of an object like "user.id".
+func lookupKey(vars map[string]interface{}, key string) (interface{}, bool) {
+	var val interface{} = vars
+	for _, name := range strings.Split(key, ".") {
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if val, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	return val, val != nil
+}
+
+// assigner decides whether the facts are included by the rollouts and experiments of rules and records the assignments.
+type assigner struct {
+	vars        map[string]interface{}
+	experiments map[string]*Experiment
+	variants    map[string]*Assignment // by experiment, nil if the facts lack its key
+	assignments []Assignment
+}
+
+func newAssigner(vars map[string]interface{}, experiments map[string]*Experiment) *assigner {
+	return &assigner{vars: vars, experiments: experiments, variants: make(map[string]*Assignment)}
+}
+
+// includes reports whether the rule is matched for the facts. Rules of an unknown experiment are never matched.
+func (a *assigner) includes(r *Rule) bool {
+	if r.experiment != "" {
+		if assignment := a.variant(r.experiment); assignment == nil || assignment.Variant != r.variant {
+			return false
+		}
+	}
+	if r.rollout != nil {
+		val, ok := lookupKey(a.vars, r.rollout.key)
+		if !ok {
+			return false
+		}
+		b := bucket(r.Name(), val)
+		included := b < threshold(r.rollout.percent)
+		a.assignments = append(a.assignments, Assignment{Rule: r.Name(), Included: included, Bucket: b})
+		return included
+	}
+	return true
+}
+
+func (a *assigner) variant(experiment string) *Assignment {
+	if assignment, ok := a.variants[experiment]; ok {
+		return assignment
+	}
+
+	var assignment *Assignment
+	if x, ok := a.experiments[experiment]; ok {
+		if val, ok := lookupKey(a.vars, x.Key); ok {
+			assignment = &Assignment{Experiment: x.Name, Bucket: bucket(x.Name, val)}
+			upper := 0.0
+			for _, v := range x.Variants {
+				upper += v.Weight
+				if assignment.Bucket < threshold(upper) {
+					assignment.Variant = v.Name
+					break
+				}
+			}
+			a.assignments = append(a.assignments, *assignment)
+		}
+	}
+	a.variants[experiment] = assignment
+	return assignment
+}
+
+// result returns the assignments, the ones of experiments first, ordered by name.
+func (a *assigner) result() []Assignment {
+	sort.Slice(a.assignments, func(i, j int) bool {
+		x, y := a.assignments[i], a.assignments[j]
+		if (x.Experiment == "") != (y.Experiment == "") {
+			return x.Experiment != ""
+		}
+		if x.Experiment != y.Experiment {
+			return x.Experiment < y.Experiment
+		}
+		return x.Rule < y.Rule
+	})
+	return a.assignments
+}
@@ -0,0 +1,231 @@
+package gorule
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEngine_Rollout(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	if _, err := e.Reload([]*Rule{
+		NewRule("discount", "true", nil, WithRollout(10, "userId")),
+		NewRule("nested", "true", nil, WithRollout(100, "user.id")),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	included := make(map[int]bool)
+	for id := 0; id < 10000; id++ {
+		res, err := e.Run(map[string]interface{}{"userId": id}, nil, OnlyRules(func(r *Rule) bool { return r.Name() == "discount" }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Assignments) != 1 || res.Assignments[0].Rule != "discount" {
+			t.Fatalf("Run() assignments = %+v, want the one of discount", res.Assignments)
+		}
+		if res.Assignments[0].Included != (len(res.Rules) == 1) {
+			t.Fatalf("Run() assignment %+v does not agree with %d rules matched", res.Assignments[0], len(res.Rules))
+		}
+		if len(res.Rules) == 1 {
+			included[id] = true
+		}
+	}
+	if n := len(included); n < 900 || n > 1100 {
+		t.Errorf("rollout of 10%% included %d of 10000 users", n)
+	}
+
+	// raising the percentage keeps the users already included
+	if _, err := e.Reload([]*Rule{NewRule("discount", "true", nil, WithRollout(20, "userId"))}); err != nil {
+		t.Fatal(err)
+	}
+	for id := range included {
+		rules, err := e.Match(map[string]interface{}{"userId": id}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rules) != 1 {
+			t.Fatalf("user %d was excluded after raising the rollout", id)
+		}
+	}
+
+	res, err := e.Run(map[string]interface{}{"age": 30}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rules) != 0 || len(res.Assignments) != 0 {
+		t.Errorf("Run() without userId = %d rules, %+v, want none", len(res.Rules), res.Assignments)
+	}
+}
+
+func TestEngine_Experiment(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	x := Experiment{Name: "discount", Key: "userId", Variants: []Variant{{Name: "control", Weight: 50}, {Name: "treatment", Weight: 50}}}
+	if err := e.AddExperiment(x); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddExperiment(x); !errors.Is(err, ErrExperimentExists) {
+		t.Errorf("AddExperiment() error = %v, want %v", err, ErrExperimentExists)
+	}
+	if _, err := e.Reload([]*Rule{
+		NewRule("standard", "true", nil, WithVariant("discount", "control")),
+		NewRule("generous", "true", nil, WithVariant("discount", "treatment")),
+		NewRule("generous fallback", "true", nil, WithVariant("discount", "treatment"), WithRollout(100, "userId")),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// rules of unknown experiments or variants would never match, so they are rejected
+	for _, r := range []*Rule{
+		NewRule("unknown", "true", nil, WithVariant("other", "a")),
+		NewRule("unknown variant", "true", nil, WithVariant("discount", "other")),
+	} {
+		if err := e.AddRule(r); !errors.Is(err, ErrExperimentNotFound) {
+			t.Errorf("AddRule(%s) error = %v, want %v", r.Name(), err, ErrExperimentNotFound)
+		}
+		if _, err := e.Reload([]*Rule{r}); !errors.Is(err, ErrExperimentNotFound) {
+			t.Errorf("Reload(%s) error = %v, want %v", r.Name(), err, ErrExperimentNotFound)
+		}
+	}
+	if n := len(e.Rules()); n != 3 {
+		t.Fatalf("rejected rules changed the rule set to %d rules", n)
+	}
+
+	variants := make(map[string]int)
+	for id := 0; id < 1000; id++ {
+		res, err := e.Run(map[string]interface{}{"userId": id}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assignment := res.Assignments[0]
+		variants[assignment.Variant]++
+
+		var got []string
+		for _, r := range res.Rules {
+			got = append(got, r.Name())
+		}
+		want := []string{"standard"}
+		if assignment.Variant == "treatment" {
+			want = []string{"generous", "generous fallback"}
+			if len(res.Assignments) != 2 || res.Assignments[1].Rule != "generous fallback" {
+				t.Fatalf("Run() assignments = %+v, want the experiment first", res.Assignments)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Run() for %+v = %v, want %v", assignment, got, want)
+		}
+	}
+	if variants["control"] < 400 || variants["treatment"] < 400 {
+		t.Errorf("variants assigned %v, want about half each", variants)
+	}
+}
+
+func TestExperiment_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		x    Experiment
+	}{
+		{name: "no key", x: Experiment{Name: "x"}},
+		{name: "duplicate variant", x: Experiment{Name: "x", Key: "id", Variants: []Variant{{Name: "a", Weight: 10}, {Name: "a", Weight: 10}}}},
+		{name: "negative weight", x: Experiment{Name: "x", Key: "id", Variants: []Variant{{Name: "a", Weight: -10}}}},
+		{name: "more than 100", x: Experiment{Name: "x", Key: "id", Variants: []Variant{{Name: "a", Weight: 60}, {Name: "b", Weight: 60}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewEngine().AddExperiment(tt.x); !errors.Is(err, ErrInvalidExperiment) {
+				t.Errorf("AddExperiment() error = %v, want %v", err, ErrInvalidExperiment)
+			}
+		})
+	}
+}
+
+func TestNewEngineFromFile_Experiments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	content := `{
+		"experiments": [{"name": "discount", "key": "userId", "variants": [{"name": "treatment", "weight": 100}]}],
+		"rules": [
+			{"name": "generous", "condition": "true", "experiment": "discount", "variant": "treatment"},
+			{"name": "new", "condition": "true", "rollout": {"percent": 0, "key": "userId"}}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEngineFromFile(path, WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.Run(map[string]interface{}{"userId": "u1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rules) != 1 || res.Rules[0].Name() != "generous" || len(res.Assignments) != 2 {
+		t.Errorf("Run() = %d rules, %+v, want generous and 2 assignments", len(res.Rules), res.Assignments)
+	}
+
+	for _, invalid := range []string{
+		`{"rules": [{"name": "a", "condition": "true", "rollout": {"percent": 120, "key": "userId"}}]}`,
+		`{"rules": [{"name": "a", "condition": "true", "experiment": "x"}]}`,
+		`{"rules": [], "experiments": [{"name": "x"}]}`,
+	} {
+		if _, err := DecodeRuleFile(strings.NewReader(invalid)); !errors.Is(err, ErrInvalidRuleFile) {
+			t.Errorf("DecodeRuleFile(%s) error = %v, want %v", invalid, err, ErrInvalidRuleFile)
+		}
+	}
+}
+
+func TestEngine_ReloadFile(t *testing.T) {
+	content := `{
+		"experiments": [{"name": "discount", "key": "userId", "variants": [{"name": "treatment", "weight": 100}]}],
+		"rules": [{"name": "generous", "condition": "true", "experiment": "discount", "variant": "treatment"}]
+	}`
+	file, err := DecodeRuleFile(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// LoadRules drops the experiments of the file, so its variant rules are rejected
+	rules, err := LoadRules(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	if _, err := e.Reload(rules); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("Reload() error = %v, want %v", err, ErrExperimentNotFound)
+	}
+
+	version, err := e.ReloadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("ReloadFile() = version %d, want 1", version)
+	}
+	matched, err := e.Match(map[string]interface{}{"userId": "u1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 1 || matched[0].Name() != "generous" {
+		t.Errorf("Match() = %v, want generous", matched)
+	}
+
+	// the experiments are replaced together with the rules
+	file.Experiments = nil
+	if _, err := e.ReloadFile(file); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("ReloadFile() without experiments error = %v, want %v", err, ErrExperimentNotFound)
+	}
+	file.Rules = nil
+	if _, err := e.ReloadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddRule(NewRule("generous", "true", nil, WithVariant("discount", "treatment"))); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("AddRule() after removing experiments error = %v, want %v", err, ErrExperimentNotFound)
+	}
+}
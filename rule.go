@@ -1,15 +1,89 @@
 package gorule
 
+import (
+	"strconv"
+	"time"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
 type Rule struct {
-	name      string
-	condition string
-	action    func(interface{}) (interface{}, error)
+	name       string
+	condition  string
+	action     func(interface{}) (interface{}, error)
+	program    *parser.Program // simplified condition, compiled once the rule is added to an engine
+	actionExpr *string         // the expression the action evaluates, if the rule was created from a RuleDefinition
+
+	tags        []string
+	description string
+	owner       string
+	version     string
+	attributes  map[string]string
+
+	disabled   bool
+	validFrom  time.Time // zero if the rule is valid from the beginning
+	validUntil time.Time // zero if the rule does not expire
+
+	rollout    *rollout // nil if the rule is matched for all facts
+	experiment string   // the experiment the rule is a variant of, if any
+	variant    string
 }
 
+// RuleOption sets metadata of a rule.
+type RuleOption func(*Rule)
+
 // NewRule creates rule with trigger condition and action function to be
-// executed when the condition is met.
-func NewRule(name, condition string, action func(interface{}) (interface{}, error)) *Rule {
-	return &Rule{name: name, condition: condition, action: action}
+// executed when the condition is met, with metadata set by opts.
+func NewRule(name, condition string, action func(interface{}) (interface{}, error), opts ...RuleOption) *Rule {
+	rule := &Rule{name: name, condition: condition, action: action}
+
+	for _, opt := range opts {
+		opt(rule)
+	}
+
+	return rule
+}
+
+// WithTags adds tags to rule, e.g. "region:eu", by which Match can be scoped, see OnlyTags.
+func WithTags(tags ...string) RuleOption {
+	return func(r *Rule) {
+		for _, tag := range tags {
+			if !r.HasTags(tag) {
+				r.tags = append(r.tags, tag)
+			}
+		}
+	}
+}
+
+// WithDescription sets the description of rule.
+func WithDescription(description string) RuleOption {
+	return func(r *Rule) {
+		r.description = description
+	}
+}
+
+// WithOwner sets the owner of rule, e.g. the team maintaining it.
+func WithOwner(owner string) RuleOption {
+	return func(r *Rule) {
+		r.owner = owner
+	}
+}
+
+// WithVersion sets the version of rule.
+func WithVersion(version string) RuleOption {
+	return func(r *Rule) {
+		r.version = version
+	}
+}
+
+// WithAttribute sets a custom attribute of rule.
+func WithAttribute(key, value string) RuleOption {
+	return func(r *Rule) {
+		if r.attributes == nil {
+			r.attributes = make(map[string]string)
+		}
+		r.attributes[key] = value
+	}
 }
 
 // Name returns the name of rule.
@@ -17,7 +91,145 @@ func (r *Rule) Name() string {
 	return r.name
 }
 
-// Execute will execute action function with input.
+// Condition returns the trigger condition of rule.
+func (r *Rule) Condition() string {
+	return r.condition
+}
+
+// WithEnabled sets whether rule is enabled. Rules are enabled by default.
+func WithEnabled(enabled bool) RuleOption {
+	return func(r *Rule) {
+		r.disabled = !enabled
+	}
+}
+
+// WithValidFrom sets the time from which on rule is matched.
+func WithValidFrom(from time.Time) RuleOption {
+	return func(r *Rule) {
+		r.validFrom = from
+	}
+}
+
+// WithValidUntil sets the time from which on rule is not matched anymore.
+func WithValidUntil(until time.Time) RuleOption {
+	return func(r *Rule) {
+		r.validUntil = until
+	}
+}
+
+// Tags returns the tags of rule in the order they were added.
+func (r *Rule) Tags() []string {
+	return append([]string(nil), r.tags...)
+}
+
+// HasTags reports whether rule carries all of the tags.
+func (r *Rule) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range r.tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Description returns the description of rule.
+func (r *Rule) Description() string {
+	return r.description
+}
+
+// Owner returns the owner of rule.
+func (r *Rule) Owner() string {
+	return r.owner
+}
+
+// Version returns the version of rule.
+func (r *Rule) Version() string {
+	return r.version
+}
+
+// Attribute returns the custom attribute of rule with key and whether it is set.
+func (r *Rule) Attribute(key string) (string, bool) {
+	value, ok := r.attributes[key]
+	return value, ok
+}
+
+// Attributes returns a copy of the custom attributes of rule.
+func (r *Rule) Attributes() map[string]string {
+	attributes := make(map[string]string, len(r.attributes))
+	for k, v := range r.attributes {
+		attributes[k] = v
+	}
+	return attributes
+}
+
+// Enabled reports whether rule is enabled.
+func (r *Rule) Enabled() bool {
+	return !r.disabled
+}
+
+// ValidFrom returns the time from which on rule is matched, or the zero time if there is none.
+func (r *Rule) ValidFrom() time.Time {
+	return r.validFrom
+}
+
+// ValidUntil returns the time from which on rule is not matched anymore, or the zero time if there is none.
+func (r *Rule) ValidUntil() time.Time {
+	return r.validUntil
+}
+
+// ActiveAt reports whether rule is enabled and t is within its validity window,
+// which includes ValidFrom and excludes ValidUntil.
+func (r *Rule) ActiveAt(t time.Time) bool {
+	if r.disabled {
+		return false
+	}
+	if !r.validFrom.IsZero() && t.Before(r.validFrom) {
+		return false
+	}
+	if !r.validUntil.IsZero() && !t.Before(r.validUntil) {
+		return false
+	}
+	return true
+}
+
+// Warning is a questionable part of a condition reported by Rule.Check.
+type Warning struct {
+	Pos     int    // position of the first character of the part, counting from 1
+	Message string // e.g. "condition is always true"
+}
+
+func (w Warning) String() string {
+	if w.Pos > 0 {
+		return w.Message + " at position " + strconv.Itoa(w.Pos)
+	}
+	return w.Message
+}
+
+// Check reports questionable parts of the trigger condition, e.g. conditions which are always true
+// or always false, and returns an error if the condition cannot be parsed.
+func (r *Rule) Check() ([]Warning, error) {
+	found, err := parser.CheckCondition(r.condition, nil)
+	if err != nil {
+		return nil, err
+	}
+	var warnings []Warning
+	for _, w := range found {
+		warnings = append(warnings, Warning{Pos: w.Pos, Message: w.Message})
+	}
+	return warnings, nil
+}
+
+// Execute will execute action function with input. Rules without action function return nil.
 func (r *Rule) Execute(input interface{}) (interface{}, error) {
+	if r.action == nil {
+		return nil, nil
+	}
 	return r.action(input)
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestRule_Execute(t *testing.T) {
@@ -54,3 +55,121 @@ func TestRule_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestRule_Check(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		want      []Warning
+		wantErr   bool
+	}{
+		{
+			name:      "no warnings",
+			condition: "x + y > 2",
+			want:      nil,
+		},
+		{
+			name:      "always true",
+			condition: "x > 2 || !!true",
+			want:      []Warning{{Pos: 1, Message: "condition is always true"}},
+		},
+		{
+			name:      "always false",
+			condition: "1 + 2 > 4",
+			want:      []Warning{{Pos: 1, Message: "condition is always false"}},
+		},
+		{
+			name:      "syntax error",
+			condition: "x >",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRule(tt.name, tt.condition, nil)
+			got, err := r.Check()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRule_Metadata(t *testing.T) {
+	r := NewRule("vip", "vipLevel > 5", nil,
+		WithTags("region:eu", "tier:gold", "region:eu"),
+		WithDescription("discount for vip customers"),
+		WithOwner("pricing"),
+		WithVersion("1.2"),
+		WithAttribute("ticket", "PRICE-42"),
+		WithAttribute("channel", "web"),
+	)
+
+	if want := []string{"region:eu", "tier:gold"}; !reflect.DeepEqual(r.Tags(), want) {
+		t.Errorf("Tags() = %v, want %v", r.Tags(), want)
+	}
+	if r.Description() != "discount for vip customers" || r.Owner() != "pricing" || r.Version() != "1.2" {
+		t.Errorf("Description(), Owner(), Version() = %q, %q, %q", r.Description(), r.Owner(), r.Version())
+	}
+	if got, ok := r.Attribute("ticket"); !ok || got != "PRICE-42" {
+		t.Errorf("Attribute(ticket) = %q, %v", got, ok)
+	}
+	if _, ok := r.Attribute("unknown"); ok {
+		t.Errorf("Attribute(unknown) is set")
+	}
+	if want := map[string]string{"ticket": "PRICE-42", "channel": "web"}; !reflect.DeepEqual(r.Attributes(), want) {
+		t.Errorf("Attributes() = %v, want %v", r.Attributes(), want)
+	}
+
+	// the accessors return copies
+	r.Tags()[0] = "changed"
+	r.Attributes()["ticket"] = "changed"
+	if r.Tags()[0] != "region:eu" || r.attributes["ticket"] != "PRICE-42" {
+		t.Errorf("metadata was changed through accessors")
+	}
+
+	tests := []struct {
+		tags []string
+		want bool
+	}{
+		{nil, true},
+		{[]string{"region:eu"}, true},
+		{[]string{"tier:gold", "region:eu"}, true},
+		{[]string{"region:eu", "region:us"}, false},
+	}
+	for _, tt := range tests {
+		if got := r.HasTags(tt.tags...); got != tt.want {
+			t.Errorf("HasTags(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestRule_ActiveAt(t *testing.T) {
+	from := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		opts []RuleOption
+		at   time.Time
+		want bool
+	}{
+		{name: "no window", at: from, want: true},
+		{name: "disabled", opts: []RuleOption{WithEnabled(false)}, at: from, want: false},
+		{name: "before window", opts: []RuleOption{WithValidFrom(from), WithValidUntil(until)}, at: from.Add(-time.Second), want: false},
+		{name: "start of window", opts: []RuleOption{WithValidFrom(from), WithValidUntil(until)}, at: from, want: true},
+		{name: "end of window", opts: []RuleOption{WithValidFrom(from), WithValidUntil(until)}, at: until, want: false},
+		{name: "open end", opts: []RuleOption{WithValidFrom(from)}, at: until.AddDate(10, 0, 0), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewRule(tt.name, "true", nil, tt.opts...).ActiveAt(tt.at); got != tt.want {
+				t.Errorf("ActiveAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
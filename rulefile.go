@@ -0,0 +1,271 @@
+package gorule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+var ErrInvalidRuleFile = errors.New("invalid rule file")
+
+// RuleFile is the JSON representation of a set of rules, e.g.
+//
+//	{"rules": [{"name": "vip discount", "condition": "vipLevel > 5", "action": "balance * 0.3"}]}
+type RuleFile struct {
+	Rules       []RuleDefinition `json:"rules"`
+	Experiments []Experiment     `json:"experiments,omitempty"`
+}
+
+// RuleDefinition is the JSON representation of a single rule. Action is an optional expression
+// which is evaluated with the input passed to Execute as variables. Enabled defaults to true and
+// ValidFrom and ValidUntil are RFC 3339 timestamps, e.g. "2024-12-01T00:00:00Z". Rollout limits the rule to a percentage
+// of the facts, see WithRollout, and Experiment and Variant make it part of an experiment of the rule file, see WithVariant.
+// The remaining fields are metadata.
+type RuleDefinition struct {
+	Name        string             `json:"name"`
+	Condition   string             `json:"condition"`
+	Action      string             `json:"action,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Owner       string             `json:"owner,omitempty"`
+	Version     string             `json:"version,omitempty"`
+	Attributes  map[string]string  `json:"attributes,omitempty"`
+	Enabled     *bool              `json:"enabled,omitempty"`
+	ValidFrom   *time.Time         `json:"validFrom,omitempty"`
+	ValidUntil  *time.Time         `json:"validUntil,omitempty"`
+	Rollout     *RolloutDefinition `json:"rollout,omitempty"`
+	Experiment  string             `json:"experiment,omitempty"`
+	Variant     string             `json:"variant,omitempty"`
+}
+
+// RolloutDefinition is the JSON representation of the rollout of a rule, e.g. {"percent": 10, "key": "userId"}.
+type RolloutDefinition struct {
+	Percent float64 `json:"percent"`
+	Key     string  `json:"key"`
+}
+
+// DecodeRuleFile reads a rule file without compiling its rules.
+func DecodeRuleFile(r io.Reader) (*RuleFile, error) {
+	var file RuleFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRuleFile, err)
+	}
+
+	if err := file.validate(); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+func (f *RuleFile) validate() error {
+	for i, def := range f.Rules {
+		if def.Name == "" {
+			return fmt.Errorf("%w: rule #%d has no name", ErrInvalidRuleFile, i+1)
+		}
+		if def.Condition == "" {
+			return fmt.Errorf("%w: rule %s has no condition", ErrInvalidRuleFile, def.Name)
+		}
+		if def.Rollout != nil && (def.Rollout.Key == "" || def.Rollout.Percent < 0 || def.Rollout.Percent > 100) {
+			return fmt.Errorf("%w: rule %s needs a rollout key and a percent from 0 to 100", ErrInvalidRuleFile, def.Name)
+		}
+		if (def.Experiment == "") != (def.Variant == "") {
+			return fmt.Errorf("%w: rule %s needs both an experiment and a variant", ErrInvalidRuleFile, def.Name)
+		}
+	}
+	for _, x := range f.Experiments {
+		if err := x.validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRuleFile, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the definition like DecodeRuleFile does, and returns an error wrapping ErrInvalidRuleFile
+// if it is invalid.
+func (d RuleDefinition) Validate() error {
+	return (&RuleFile{Rules: []RuleDefinition{d}}).validate()
+}
+
+// LoadRules reads a rule file and creates its rules. The experiments of the file are not returned, so engines reject
+// rules which are part of their variants unless the experiments are added to them, see Engine.ReloadFile.
+func LoadRules(r io.Reader) ([]*Rule, error) {
+	file, err := DecodeRuleFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]*Rule, 0, len(file.Rules))
+	for _, def := range file.Rules {
+		rules = append(rules, def.Rule())
+	}
+
+	return rules, nil
+}
+
+// NewEngineFromFile initializes an engine with options and adds the experiments and the rules of the rule file at path,
+// see Engine.ReloadFile.
+func NewEngineFromFile(path string, opts ...Option) (*Engine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	file, err := DecodeRuleFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	engine := NewEngine(opts...)
+	if _, err := engine.ReloadFile(file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return engine, nil
+}
+
+// ReloadFile replaces the experiments and the rules of the engine by the ones of file, creating a single new version
+// of the rule set, and returns its number. Return error if the file is invalid, two rules have the same name
+// or a rule is part of a variant the experiments lack, leaving the engine unchanged.
+func (e *Engine) ReloadFile(file *RuleFile) (int, error) {
+	if err := file.validate(); err != nil {
+		return e.Version(), err
+	}
+	experiments, err := addExperiments(nil, file.Experiments...)
+	if err != nil {
+		return e.Version(), err
+	}
+	rules := make([]*Rule, 0, len(file.Rules))
+	for _, def := range file.Rules {
+		rules = append(rules, def.Rule())
+	}
+
+	return e.Update(func(u *RuleSetUpdate) error {
+		u.experiments = experiments
+		u.rules = make(map[string]*Rule, len(rules))
+		for _, r := range rules {
+			if err := u.AddRule(r); err != nil {
+				return err
+			}
+		}
+		u.changes = []string{"reload"}
+		return nil
+	})
+}
+
+// Rule creates the rule defined. Without an action, executing the rule returns nil.
+func (d RuleDefinition) Rule() *Rule {
+	opts := []RuleOption{WithTags(d.Tags...), WithDescription(d.Description), WithOwner(d.Owner), WithVersion(d.Version)}
+	for key, value := range d.Attributes {
+		opts = append(opts, WithAttribute(key, value))
+	}
+	if d.Enabled != nil {
+		opts = append(opts, WithEnabled(*d.Enabled))
+	}
+	if d.ValidFrom != nil {
+		opts = append(opts, WithValidFrom(*d.ValidFrom))
+	}
+	if d.ValidUntil != nil {
+		opts = append(opts, WithValidUntil(*d.ValidUntil))
+	}
+	if d.Rollout != nil {
+		opts = append(opts, WithRollout(d.Rollout.Percent, d.Rollout.Key))
+	}
+	if d.Experiment != "" {
+		opts = append(opts, WithVariant(d.Experiment, d.Variant))
+	}
+
+	rule := NewRule(d.Name, d.Condition, expressionAction(d.Action), opts...)
+	rule.actionExpr = &d.Action
+	return rule
+}
+
+// Definition returns the definition of rule, e.g. to write it to a rule file. Action is only set if the rule
+// was created from a definition, as action functions cannot be written as expression.
+func (r *Rule) Definition() RuleDefinition {
+	def := RuleDefinition{
+		Name:        r.name,
+		Condition:   r.condition,
+		Tags:        r.Tags(),
+		Description: r.description,
+		Owner:       r.owner,
+		Version:     r.version,
+		Experiment:  r.experiment,
+		Variant:     r.variant,
+	}
+	if r.actionExpr != nil {
+		def.Action = *r.actionExpr
+	}
+	if len(r.attributes) > 0 {
+		def.Attributes = r.Attributes()
+	}
+	if r.disabled {
+		enabled := false
+		def.Enabled = &enabled
+	}
+	if !r.validFrom.IsZero() {
+		from := r.validFrom
+		def.ValidFrom = &from
+	}
+	if !r.validUntil.IsZero() {
+		until := r.validUntil
+		def.ValidUntil = &until
+	}
+	if r.rollout != nil {
+		def.Rollout = &RolloutDefinition{Percent: r.rollout.percent, Key: r.rollout.key}
+	}
+	return def
+}
+
+// expressionAction returns an action evaluating expr with the input as variables, or returning nil if expr is empty.
+func expressionAction(expr string) func(interface{}) (interface{}, error) {
+	return func(input interface{}) (interface{}, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		vars, _ := input.(map[string]interface{})
+		return parser.Evaluate(expr, vars, nil)
+	}
+}
+
+// DecodeFacts reads a JSON object to be used as variables of an expression.
+// Integral numbers are decoded as int and all other numbers as float64.
+func DecodeFacts(r io.Reader) (map[string]interface{}, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var facts map[string]interface{}
+	if err := dec.Decode(&facts); err != nil {
+		return nil, fmt.Errorf("cannot decode facts: %w", err)
+	}
+
+	return normalizeNumbers(facts).(map[string]interface{}), nil
+}
+
+func normalizeNumbers(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeNumbers(v[k])
+		}
+	}
+	return val
+}
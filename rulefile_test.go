@@ -0,0 +1,144 @@
+package gorule
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		wantNames  []string
+		wantResult interface{}
+		wantErr    error
+	}{
+		{
+			name: "happy path",
+			file: `{"rules": [
+				{"name": "vip", "condition": "vipLevel > 5", "action": "balance * 0.5"},
+				{"name": "no action", "condition": "true"}
+			]}`,
+			wantNames:  []string{"vip", "no action"},
+			wantResult: 50.0,
+		},
+		{
+			name:    "error: invalid json",
+			file:    `{"rules": [`,
+			wantErr: ErrInvalidRuleFile,
+		},
+		{
+			name:    "error: unknown field",
+			file:    `{"rules": [{"name": "vip", "condition": "true", "priority": 1}]}`,
+			wantErr: ErrInvalidRuleFile,
+		},
+		{
+			name:    "error: missing condition",
+			file:    `{"rules": [{"name": "vip"}]}`,
+			wantErr: ErrInvalidRuleFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := LoadRules(strings.NewReader(tt.file))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoadRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			names := make([]string, 0, len(rules))
+			for _, r := range rules {
+				names = append(names, r.Name())
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("LoadRules() names = %v, want %v", names, tt.wantNames)
+			}
+
+			got, err := rules[0].Execute(map[string]interface{}{"balance": 100})
+			if err != nil || got != tt.wantResult {
+				t.Errorf("Execute() = %v, %v, want %v", got, err, tt.wantResult)
+			}
+			if got, _ := rules[1].Execute(nil); got != nil {
+				t.Errorf("Execute() without action = %v, want nil", got)
+			}
+		})
+	}
+}
+
+func TestLoadRules_Metadata(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(`{"rules": [{
+		"name": "vip",
+		"condition": "vipLevel > 5",
+		"tags": ["region:eu"],
+		"description": "discount for vip customers",
+		"owner": "pricing",
+		"version": "3",
+		"attributes": {"ticket": "PRICE-42"},
+		"enabled": false,
+		"validFrom": "2024-12-01T00:00:00Z"
+	}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rules[0]
+	if !reflect.DeepEqual(r.Tags(), []string{"region:eu"}) || r.Description() != "discount for vip customers" ||
+		r.Owner() != "pricing" || r.Version() != "3" || !reflect.DeepEqual(r.Attributes(), map[string]string{"ticket": "PRICE-42"}) {
+		t.Errorf("LoadRules() metadata = %v, %q, %q, %q, %v", r.Tags(), r.Description(), r.Owner(), r.Version(), r.Attributes())
+	}
+	if r.Enabled() || !r.ValidFrom().Equal(time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)) || !r.ValidUntil().IsZero() {
+		t.Errorf("LoadRules() = enabled %v, valid from %v until %v", r.Enabled(), r.ValidFrom(), r.ValidUntil())
+	}
+}
+
+func TestRule_Definition(t *testing.T) {
+	enabled := false
+	from := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	def := RuleDefinition{
+		Name:        "vip",
+		Condition:   "vipLevel > 5",
+		Action:      "balance * 0.3",
+		Tags:        []string{"region:eu"},
+		Description: "discount for vip customers",
+		Attributes:  map[string]string{"ticket": "PRICE-42"},
+		Enabled:     &enabled,
+		ValidFrom:   &from,
+		Rollout:     &RolloutDefinition{Percent: 10, Key: "userId"},
+		Experiment:  "discount",
+		Variant:     "treatment",
+	}
+	if got := def.Rule().Definition(); !reflect.DeepEqual(got, def) {
+		t.Errorf("Definition() = %+v, want %+v", got, def)
+	}
+
+	want := RuleDefinition{Name: "adult", Condition: "age >= 18"}
+	if got := NewRule("adult", "age >= 18", func(interface{}) (interface{}, error) { return nil, nil }).Definition(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Definition() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeFacts(t *testing.T) {
+	facts, err := DecodeFacts(strings.NewReader(`{"int": 1, "float": 1.5, "big": 1e3, "arr": [2, {"x": 3.25}]}`))
+	if err != nil {
+		t.Fatalf("DecodeFacts() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"int":   1,
+		"float": 1.5,
+		"big":   1000.0,
+		"arr":   []interface{}{2, map[string]interface{}{"x": 3.25}},
+	}
+	if !reflect.DeepEqual(facts, want) {
+		t.Errorf("DecodeFacts() = %v, want %v", facts, want)
+	}
+
+	if _, err := DecodeFacts(strings.NewReader(`[1]`)); err == nil {
+		t.Errorf("DecodeFacts() of array should fail")
+	}
+}
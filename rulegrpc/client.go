@@ -0,0 +1,184 @@
+package rulegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+	"github.com/spikewong/gorule/rulegrpc/rulepb"
+)
+
+// Client calls a rule service with Go values, converting facts and results like the server does.
+type Client struct {
+	rpc rulepb.RuleServiceClient
+}
+
+// NewClient creates a client for the rule service served on conn.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{rpc: rulepb.NewRuleServiceClient(conn)}
+}
+
+// MatchResult is the result of Match, with the rules ordered by name.
+type MatchResult struct {
+	Version     int
+	Rules       []MatchedRule
+	Assignments []gorule.Assignment
+}
+
+// MatchedRule is a rule matched along with the result of its action.
+type MatchedRule struct {
+	Name   string
+	Result interface{}
+	Error  string // set if the action failed
+}
+
+// Explanation is the value a sub-expression evaluated to, along with the explanations of its operands,
+// see Client.Explain.
+type Explanation struct {
+	Expr     string
+	Pos      int // position of the sub-expression in the expression, counting from 1
+	Value    interface{}
+	Error    string // set if the evaluation failed
+	Children []*Explanation
+}
+
+// String renders the explanation as a tree with one sub-expression per line, like the gorule explain command does.
+func (x *Explanation) String() string {
+	return x.parser().String()
+}
+
+func (x *Explanation) parser() *parser.Explanation {
+	px := &parser.Explanation{Expr: x.Expr, Pos: x.Pos, Value: x.Value, Error: x.Error}
+	for _, child := range x.Children {
+		px.Children = append(px.Children, child.parser())
+	}
+	return px
+}
+
+// notFound returns an error wrapping gorule.ErrRuleNotFound for NOT_FOUND errors, and err otherwise.
+func notFound(err error, name string) error {
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("%w: %s", gorule.ErrRuleNotFound, name)
+	}
+	return err
+}
+
+// Evaluate evaluates expression against facts.
+func (c *Client) Evaluate(ctx context.Context, expression string, facts map[string]interface{}) (interface{}, error) {
+	s, err := toStruct(facts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.rpc.Evaluate(ctx, &rulepb.EvaluateRequest{Expression: expression, Facts: s})
+	if err != nil {
+		return nil, err
+	}
+	return fromValue(resp.Result), nil
+}
+
+// Match matches facts against the rules, or only the rules carrying all tags, and returns the rules matched along with
+// the results of their actions.
+func (c *Client) Match(ctx context.Context, facts map[string]interface{}, tags ...string) (*MatchResult, error) {
+	s, err := toStruct(facts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.rpc.Match(ctx, &rulepb.MatchRequest{Facts: s, Tags: tags})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &MatchResult{Version: int(resp.Version)}
+	for _, r := range resp.Rules {
+		res.Rules = append(res.Rules, MatchedRule{Name: r.Name, Result: fromValue(r.Result), Error: r.Error})
+	}
+	for _, a := range resp.Assignments {
+		res.Assignments = append(res.Assignments, gorule.Assignment{
+			Experiment: a.Experiment,
+			Variant:    a.Variant,
+			Rule:       a.Rule,
+			Included:   a.Included,
+			Bucket:     int(a.Bucket),
+		})
+	}
+	return res, nil
+}
+
+// Explain explains how expression is evaluated against facts. If the evaluation fails, the explanation up to
+// the failing sub-expression is returned along with the error.
+func (c *Client) Explain(ctx context.Context, expression string, facts map[string]interface{}) (*Explanation, error) {
+	return c.explain(ctx, &rulepb.ExplainRequest{Target: &rulepb.ExplainRequest_Expression{Expression: expression}}, facts)
+}
+
+// ExplainRule explains how the condition of the rule named is evaluated against facts, see Explain.
+func (c *Client) ExplainRule(ctx context.Context, name string, facts map[string]interface{}) (*Explanation, error) {
+	x, err := c.explain(ctx, &rulepb.ExplainRequest{Target: &rulepb.ExplainRequest_Rule{Rule: name}}, facts)
+	if x == nil {
+		err = notFound(err, name)
+	}
+	return x, err
+}
+
+func (c *Client) explain(ctx context.Context, req *rulepb.ExplainRequest, facts map[string]interface{}) (*Explanation, error) {
+	var err error
+	if req.Facts, err = toStruct(facts); err != nil {
+		return nil, err
+	}
+	resp, err := c.rpc.Explain(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	x := fromExplanation(resp.Explanation)
+	if resp.Error != "" {
+		return x, errors.New(resp.Error)
+	}
+	return x, nil
+}
+
+// Rules returns the current version and the definitions of its rules, ordered by name.
+func (c *Client) Rules(ctx context.Context) (int, []gorule.RuleDefinition, error) {
+	resp, err := c.rpc.ListRules(ctx, &rulepb.ListRulesRequest{})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defs := make([]gorule.RuleDefinition, 0, len(resp.Rules))
+	for _, r := range resp.Rules {
+		defs = append(defs, fromRule(r))
+	}
+	return int(resp.Version), defs, nil
+}
+
+// Rule returns the definition of the rule named, or an error wrapping gorule.ErrRuleNotFound.
+func (c *Client) Rule(ctx context.Context, name string) (gorule.RuleDefinition, error) {
+	resp, err := c.rpc.GetRule(ctx, &rulepb.GetRuleRequest{Name: name})
+	if err != nil {
+		return gorule.RuleDefinition{}, notFound(err, name)
+	}
+	return fromRule(resp), nil
+}
+
+// PutRule adds the rule defined, or replaces the rule of the same name, and returns the new version.
+func (c *Client) PutRule(ctx context.Context, def gorule.RuleDefinition) (int, error) {
+	resp, err := c.rpc.PutRule(ctx, &rulepb.PutRuleRequest{Rule: toRule(def)})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Version), nil
+}
+
+// DeleteRule removes the rule named and returns the new version, or an error wrapping gorule.ErrRuleNotFound.
+func (c *Client) DeleteRule(ctx context.Context, name string) (int, error) {
+	resp, err := c.rpc.DeleteRule(ctx, &rulepb.DeleteRuleRequest{Name: name})
+	if err != nil {
+		return 0, notFound(err, name)
+	}
+	return int(resp.Version), nil
+}
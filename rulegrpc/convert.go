@@ -0,0 +1,158 @@
+package rulegrpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+	"github.com/spikewong/gorule/rulegrpc/rulepb"
+)
+
+// fromStruct converts facts to variables. Numbers of a Struct are float64, so integral numbers are converted to int,
+// like gorule.DecodeFacts does for facts read from JSON.
+func fromStruct(s *structpb.Struct) map[string]interface{} {
+	if s == nil {
+		return map[string]interface{}{}
+	}
+	return normalizeNumbers(s.AsMap()).(map[string]interface{})
+}
+
+// fromValue converts a value like fromStruct does.
+func fromValue(v *structpb.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	return normalizeNumbers(v.AsInterface())
+}
+
+func normalizeNumbers(val interface{}) interface{} {
+	switch v := val.(type) {
+	case float64:
+		if i := int64(v); float64(i) == v && int64(int(i)) == i {
+			return int(i)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalizeNumbers(v[k])
+		}
+	}
+	return val
+}
+
+// toValue converts a variable or the result of an expression to a Value. Types not supported by structpb,
+// e.g. []string, are converted like JSON.
+func toValue(val interface{}) (*structpb.Value, error) {
+	v, err := structpb.NewValue(val)
+	if err == nil {
+		return v, nil
+	}
+
+	b, jsonErr := json.Marshal(val)
+	if jsonErr != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if jsonErr = json.Unmarshal(b, &generic); jsonErr != nil {
+		return nil, err
+	}
+	return structpb.NewValue(generic)
+}
+
+func toStruct(facts map[string]interface{}) (*structpb.Struct, error) {
+	if facts == nil {
+		return nil, nil
+	}
+	v, err := toValue(facts)
+	if err != nil {
+		return nil, err
+	}
+	return v.GetStructValue(), nil
+}
+
+func toRule(def gorule.RuleDefinition) *rulepb.Rule {
+	r := &rulepb.Rule{
+		Name:        def.Name,
+		Condition:   def.Condition,
+		Action:      def.Action,
+		Tags:        def.Tags,
+		Description: def.Description,
+		Owner:       def.Owner,
+		Version:     def.Version,
+		Attributes:  def.Attributes,
+		Enabled:     def.Enabled,
+		Experiment:  def.Experiment,
+		Variant:     def.Variant,
+	}
+	if def.ValidFrom != nil {
+		r.ValidFrom = timestamppb.New(*def.ValidFrom)
+	}
+	if def.ValidUntil != nil {
+		r.ValidUntil = timestamppb.New(*def.ValidUntil)
+	}
+	if def.Rollout != nil {
+		r.Rollout = &rulepb.Rollout{Percent: def.Rollout.Percent, Key: def.Rollout.Key}
+	}
+	return r
+}
+
+func fromRule(r *rulepb.Rule) gorule.RuleDefinition {
+	def := gorule.RuleDefinition{
+		Name:        r.GetName(),
+		Condition:   r.GetCondition(),
+		Action:      r.GetAction(),
+		Tags:        r.GetTags(),
+		Description: r.GetDescription(),
+		Owner:       r.GetOwner(),
+		Version:     r.GetVersion(),
+		Attributes:  r.GetAttributes(),
+		Enabled:     r.Enabled,
+		Experiment:  r.GetExperiment(),
+		Variant:     r.GetVariant(),
+	}
+	if len(def.Attributes) == 0 {
+		def.Attributes = nil
+	}
+	if r.GetValidFrom() != nil {
+		from := r.ValidFrom.AsTime()
+		def.ValidFrom = &from
+	}
+	if r.GetValidUntil() != nil {
+		until := r.ValidUntil.AsTime()
+		def.ValidUntil = &until
+	}
+	if r.GetRollout() != nil {
+		def.Rollout = &gorule.RolloutDefinition{Percent: r.Rollout.Percent, Key: r.Rollout.Key}
+	}
+	return def
+}
+
+func toExplanation(x *parser.Explanation) (*rulepb.Explanation, error) {
+	value, err := toValue(x.Value)
+	if err != nil {
+		return nil, err
+	}
+	pb := &rulepb.Explanation{Expr: x.Expr, Pos: int32(x.Pos), Value: value, Error: x.Error}
+	for _, child := range x.Children {
+		c, err := toExplanation(child)
+		if err != nil {
+			return nil, err
+		}
+		pb.Children = append(pb.Children, c)
+	}
+	return pb, nil
+}
+
+func fromExplanation(pb *rulepb.Explanation) *Explanation {
+	x := &Explanation{Expr: pb.GetExpr(), Pos: int(pb.GetPos()), Value: fromValue(pb.GetValue()), Error: pb.GetError()}
+	for _, child := range pb.GetChildren() {
+		x.Children = append(x.Children, fromExplanation(child))
+	}
+	return x
+}
@@ -0,0 +1,194 @@
+package rulegrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+	"github.com/spikewong/gorule/rulegrpc/rulepb"
+)
+
+const rules = `{"rules": [
+	{"name": "vip", "condition": "vipLevel > 5 && !inBlacklist", "action": "balance * 0.3", "tags": ["discount"]},
+	{"name": "rich", "condition": "balance >= 100"}
+]}`
+
+func newClient(t *testing.T, opts ...Option) (*Client, *gorule.Engine) {
+	loaded, err := gorule.LoadRules(strings.NewReader(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gorule.NewEngine(gorule.WithLogger(log.New(io.Discard, "", 0)))
+	if _, err := engine.Reload(loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	rulepb.RegisterRuleServiceServer(server, NewServer(engine, opts...))
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return NewClient(conn), engine
+}
+
+func TestServer_Evaluate(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+
+	result, err := client.Evaluate(ctx, "age >= 18 ? age / 2 : 0", map[string]interface{}{"age": 20})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, result)
+
+	result, err = client.Evaluate(ctx, `tags[0] + "!"`, map[string]interface{}{"tags": []string{"a", "b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "a!", result)
+
+	_, err = client.Evaluate(ctx, "age >= 18", nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "does not exist")
+
+	_, err = client.Evaluate(ctx, "", nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Match(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+	facts := map[string]interface{}{"vipLevel": 10, "balance": 100, "inBlacklist": false}
+
+	res, err := client.Match(ctx, facts)
+	assert.NoError(t, err)
+	assert.Equal(t, &MatchResult{Version: 1, Rules: []MatchedRule{{Name: "rich"}, {Name: "vip", Result: 30}}}, res)
+
+	res, err = client.Match(ctx, facts, "discount")
+	assert.NoError(t, err)
+	assert.Equal(t, []MatchedRule{{Name: "vip", Result: 30}}, res.Rules)
+
+	_, err = client.Match(ctx, map[string]interface{}{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Explain(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+
+	x, err := client.ExplainRule(ctx, "rich", map[string]interface{}{"balance": 50})
+	assert.NoError(t, err)
+	assert.Equal(t, &Explanation{Expr: "balance >= 100", Pos: 1, Value: false, Children: []*Explanation{
+		{Expr: "balance", Pos: 1, Value: 50},
+	}}, x)
+	assert.Equal(t, "balance >= 100  => false\n└── balance  => 50\n", x.String())
+
+	x, err = client.Explain(ctx, "balance > 1 && missing", map[string]interface{}{"balance": 50})
+	assert.Error(t, err)
+	if assert.NotNil(t, x) {
+		assert.Equal(t, "balance > 1 && missing", x.Expr)
+		assert.NotEmpty(t, x.Error)
+	}
+
+	_, err = client.Explain(ctx, "balance >", nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ExplainRule(ctx, "unknown", nil)
+	assert.True(t, errors.Is(err, gorule.ErrRuleNotFound), err)
+}
+
+func TestServer_Rules(t *testing.T) {
+	client, engine := newClient(t)
+	ctx := context.Background()
+
+	version, defs, err := client.Rules(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, []gorule.RuleDefinition{
+		{Name: "rich", Condition: "balance >= 100"},
+		{Name: "vip", Condition: "vipLevel > 5 && !inBlacklist", Action: "balance * 0.3", Tags: []string{"discount"}},
+	}, defs)
+
+	from := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	enabled := false
+	adult := gorule.RuleDefinition{
+		Name:       "adult",
+		Condition:  "age >= 18",
+		Attributes: map[string]string{"ticket": "PRICE-42"},
+		Enabled:    &enabled,
+		ValidFrom:  &from,
+		Rollout:    &gorule.RolloutDefinition{Percent: 10, Key: "userId"},
+	}
+	version, err = client.PutRule(ctx, adult)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, 2, engine.Version())
+
+	def, err := client.Rule(ctx, "adult")
+	assert.NoError(t, err)
+	assert.Equal(t, adult, def)
+
+	_, err = client.PutRule(ctx, gorule.RuleDefinition{Name: "no condition"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.PutRule(ctx, gorule.RuleDefinition{Name: "treatment", Condition: "true", Experiment: "missing", Variant: "b"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), gorule.ErrExperimentNotFound.Error())
+
+	version, err = client.DeleteRule(ctx, "rich")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	_, err = client.DeleteRule(ctx, "rich")
+	assert.True(t, errors.Is(err, gorule.ErrRuleNotFound), err)
+	_, err = client.Rule(ctx, "rich")
+	assert.True(t, errors.Is(err, gorule.ErrRuleNotFound), err)
+}
+
+func TestServer_Panic(t *testing.T) {
+	boom := func(args ...interface{}) (interface{}, error) {
+		var m map[string]int
+		m["boom"]++
+		return nil, nil
+	}
+	client, _ := newClient(t, WithFunctions(map[string]parser.ExpressionFunction{"boom": boom}))
+	ctx := context.Background()
+
+	_, err := client.Evaluate(ctx, "boom()", nil)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, err.Error(), "internal error")
+
+	result, err := client.Evaluate(ctx, "1 + 1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result)
+}
+
+func TestServer_Deadline(t *testing.T) {
+	slow := func(args ...interface{}) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return true, nil
+	}
+	client, _ := newClient(t, WithFunctions(map[string]parser.ExpressionFunction{"slow": slow}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.Evaluate(ctx, "slow()", nil)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
@@ -0,0 +1,4 @@
+// Package rulepb holds the protobuf messages and the gRPC service of package rulegrpc, generated from rules.proto.
+package rulepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative rules.proto
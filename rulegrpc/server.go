@@ -0,0 +1,259 @@
+// Package rulegrpc serves the rules of an engine over gRPC, and provides a client for it.
+// The service is defined by rulepb/rules.proto, so clients can be generated for other languages:
+//
+//	server := grpc.NewServer()
+//	rulepb.RegisterRuleServiceServer(server, rulegrpc.NewServer(engine))
+//
+//	client := rulegrpc.NewClient(conn)
+//	matched, err := client.Match(ctx, map[string]interface{}{"vipLevel": 6})
+//
+// Facts are google.protobuf.Struct objects. As their numbers are float64, integral numbers are passed to expressions
+// as int, like facts read from JSON by gorule.DecodeFacts.
+package rulegrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+	"github.com/spikewong/gorule/rulegrpc/rulepb"
+)
+
+// Option configures the server.
+type Option func(*Server)
+
+// WithFunctions sets the functions expressions and rules can call.
+func WithFunctions(functions map[string]parser.ExpressionFunction) Option {
+	return func(s *Server) {
+		s.functions = functions
+	}
+}
+
+// Server implements rulepb.RuleServiceServer for an engine. Rules put or deleted through the server change the engine
+// only, so the rules of an engine synchronized with a gorule.RuleStore should be managed through the store instead.
+type Server struct {
+	rulepb.UnimplementedRuleServiceServer
+
+	engine    *gorule.Engine
+	functions map[string]parser.ExpressionFunction
+}
+
+// NewServer creates a server for the rules of engine.
+func NewServer(engine *gorule.Engine, opts ...Option) *Server {
+	s := &Server{engine: engine}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// invalid returns an INVALID_ARGUMENT error, for requests the client has to change.
+func invalid(err error) error {
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// statusError returns err with the status of its cause.
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, gorule.ErrRuleNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, gorule.ErrInvalidRuleFile), errors.Is(err, gorule.ErrRuleExists),
+		errors.Is(err, gorule.ErrExperimentNotFound):
+		return invalid(err)
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// run calls fn unless the request is cancelled or its deadline exceeded first. Evaluations cannot be stopped,
+// so fn keeps running in that case, but its result is discarded. The response set by fn may only be read
+// if run returns no error. A panic of fn, e.g. of a function, is returned as INTERNAL error.
+func run(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- status.Errorf(codes.Internal, "internal error: %v", r)
+			}
+		}()
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// Evaluate evaluates the expression of the request against its facts.
+func (s *Server) Evaluate(ctx context.Context, req *rulepb.EvaluateRequest) (*rulepb.EvaluateResponse, error) {
+	if req.GetExpression() == "" {
+		return nil, invalid(errors.New("missing expression"))
+	}
+
+	resp := &rulepb.EvaluateResponse{}
+	err := run(ctx, func() error {
+		result, err := parser.Evaluate(req.Expression, fromStruct(req.Facts), s.functions)
+		if err != nil {
+			// the expression is part of the request, so failing to evaluate it is the fault of the client
+			return invalid(err)
+		}
+		if resp.Result, err = toValue(result); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Match matches the facts of the request against the rules, see gorule.Engine.Run, and executes the actions
+// of the rules matched.
+func (s *Server) Match(ctx context.Context, req *rulepb.MatchRequest) (*rulepb.MatchResponse, error) {
+	resp := &rulepb.MatchResponse{}
+	err := run(ctx, func() error {
+		facts := fromStruct(req.Facts)
+		var opts []gorule.MatchOption
+		if len(req.Tags) > 0 {
+			opts = append(opts, gorule.OnlyTags(req.Tags...))
+		}
+		res, err := s.engine.Run(facts, s.functions, opts...)
+		if err != nil {
+			return invalid(err)
+		}
+
+		resp.Version = int64(res.Version)
+		sort.Slice(res.Rules, func(i, j int) bool { return res.Rules[i].Name() < res.Rules[j].Name() })
+		for _, r := range res.Rules {
+			matched := &rulepb.MatchedRule{Name: r.Name()}
+			result, err := r.Execute(facts)
+			if err != nil {
+				matched.Error = err.Error()
+			} else if matched.Result, err = toValue(result); err != nil {
+				return status.Error(codes.Internal, fmt.Sprintf("rule %s: %v", r.Name(), err))
+			}
+			resp.Rules = append(resp.Rules, matched)
+		}
+		for _, a := range res.Assignments {
+			resp.Assignments = append(resp.Assignments, &rulepb.Assignment{
+				Experiment: a.Experiment,
+				Variant:    a.Variant,
+				Rule:       a.Rule,
+				Included:   a.Included,
+				Bucket:     int32(a.Bucket),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Explain explains the expression of the request, or the condition of the rule named. A failing evaluation is not
+// an error of the call, but reported along with the explanation up to the failing sub-expression.
+func (s *Server) Explain(ctx context.Context, req *rulepb.ExplainRequest) (*rulepb.ExplainResponse, error) {
+	var expr string
+	switch target := req.GetTarget().(type) {
+	case *rulepb.ExplainRequest_Expression:
+		expr = target.Expression
+	case *rulepb.ExplainRequest_Rule:
+		r, err := s.rule(target.Rule)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		expr = r.Condition()
+	}
+	if expr == "" {
+		return nil, invalid(errors.New("missing expression or rule"))
+	}
+
+	resp := &rulepb.ExplainResponse{}
+	err := run(ctx, func() error {
+		explanation, err := parser.Explain(expr, fromStruct(req.Facts), s.functions)
+		if explanation == nil {
+			// the expression could not be parsed
+			return invalid(err)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if resp.Explanation, err = toExplanation(explanation); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Server) rule(name string) (*gorule.Rule, error) {
+	for _, r := range s.engine.Rules() {
+		if r.Name() == name {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", gorule.ErrRuleNotFound, name)
+}
+
+// ListRules returns the definitions of the rules, ordered by name.
+func (s *Server) ListRules(ctx context.Context, req *rulepb.ListRulesRequest) (*rulepb.ListRulesResponse, error) {
+	// the version is read first, so the rules are at least as new as the version reported
+	resp := &rulepb.ListRulesResponse{Version: int64(s.engine.Version())}
+	for _, r := range s.engine.Rules() {
+		resp.Rules = append(resp.Rules, toRule(r.Definition()))
+	}
+	return resp, nil
+}
+
+// GetRule returns the definition of the rule named.
+func (s *Server) GetRule(ctx context.Context, req *rulepb.GetRuleRequest) (*rulepb.Rule, error) {
+	r, err := s.rule(req.GetName())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toRule(r.Definition()), nil
+}
+
+// PutRule adds the rule of the request, or replaces the rule of the same name, and returns the new version.
+func (s *Server) PutRule(ctx context.Context, req *rulepb.PutRuleRequest) (*rulepb.PutRuleResponse, error) {
+	if req.GetRule() == nil {
+		return nil, invalid(errors.New("missing rule"))
+	}
+	def := fromRule(req.Rule)
+	if err := def.Validate(); err != nil {
+		return nil, statusError(err)
+	}
+
+	version, err := s.engine.Update(func(u *gorule.RuleSetUpdate) error {
+		u.ReplaceRule(def.Rule())
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &rulepb.PutRuleResponse{Version: int64(version)}, nil
+}
+
+// DeleteRule removes the rule named and returns the new version.
+func (s *Server) DeleteRule(ctx context.Context, req *rulepb.DeleteRuleRequest) (*rulepb.DeleteRuleResponse, error) {
+	version, err := s.engine.Update(func(u *gorule.RuleSetUpdate) error {
+		return u.RemoveRule(req.GetName())
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &rulepb.DeleteRuleResponse{Version: int64(version)}, nil
+}
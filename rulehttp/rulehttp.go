@@ -0,0 +1,315 @@
+// Package rulehttp serves the rules of an engine over HTTP, so services not written in Go can use them.
+// Requests and responses are JSON:
+//
+//	POST /v1/evaluate  {"expression": "age >= 18", "facts": {"age": 20}}
+//	                   {"result": true}
+//	POST /v1/match     {"facts": {"vipLevel": 6, "balance": 100}, "tags": ["discount"]}
+//	                   {"version": 1, "rules": [{"name": "vip", "result": 30}], "assignments": []}
+//	GET  /v1/rules     {"version": 1, "rules": [{"name": "vip", "condition": "vipLevel > 5", "action": "balance * 0.3"}]}
+//	POST /v1/reload    {"version": 2}
+//
+// Failed requests are answered with a 4xx or 5xx status and {"error": "message"}.
+package rulehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+const (
+	// DefaultMaxBodySize is the size limit of requests unless set by WithMaxBodySize.
+	DefaultMaxBodySize = 1 << 20
+	// DefaultTimeout is the time limit of requests unless set by WithTimeout.
+	DefaultTimeout = 5 * time.Second
+)
+
+// ReloadFunc reloads the rules of the engine, e.g. from a rule file, and returns the new version.
+type ReloadFunc func(ctx context.Context) (int, error)
+
+// Option configures the handler.
+type Option func(*handler)
+
+// WithMaxBodySize limits the size of request bodies, larger requests are answered with 413.
+func WithMaxBodySize(n int64) Option {
+	return func(h *handler) {
+		h.maxBodySize = n
+	}
+}
+
+// WithTimeout limits the time to answer a request, slower requests are answered with 504.
+// The evaluation of a request timed out is not stopped, but its result is discarded.
+func WithTimeout(d time.Duration) Option {
+	return func(h *handler) {
+		h.timeout = d
+	}
+}
+
+// WithFunctions sets the functions expressions and rules can call.
+func WithFunctions(functions map[string]parser.ExpressionFunction) Option {
+	return func(h *handler) {
+		h.functions = functions
+	}
+}
+
+// WithReload enables the reload endpoint, which calls reload. Without it, reload requests are answered with 501.
+func WithReload(reload ReloadFunc) Option {
+	return func(h *handler) {
+		h.reload = reload
+	}
+}
+
+type handler struct {
+	engine      *gorule.Engine
+	functions   map[string]parser.ExpressionFunction
+	reload      ReloadFunc
+	maxBodySize int64
+	timeout     time.Duration
+	mux         *http.ServeMux
+}
+
+// NewHandler creates a handler serving the rules of engine.
+func NewHandler(engine *gorule.Engine, opts ...Option) http.Handler {
+	h := &handler{engine: engine, maxBodySize: DefaultMaxBodySize, timeout: DefaultTimeout, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("/v1/evaluate", h.endpoint(http.MethodPost, h.evaluate))
+	h.mux.HandleFunc("/v1/match", h.endpoint(http.MethodPost, h.match))
+	h.mux.HandleFunc("/v1/rules", h.endpoint(http.MethodGet, h.rules))
+	h.mux.HandleFunc("/v1/reload", h.endpoint(http.MethodPost, h.reloadRules))
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// statusError is an error answered with its status instead of 500.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return &statusError{status: http.StatusBadRequest, err: err}
+}
+
+// endpoint wraps fn with the method check, the size limit and the timeout, and writes its result as JSON.
+func (h *handler) endpoint(method string, fn func(ctx context.Context, body []byte) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		// a byte more than the limit is read to tell whether the body exceeds it
+		var body bytes.Buffer
+		if _, err := body.ReadFrom(io.LimitReader(r.Body, h.maxBodySize+1)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if int64(body.Len()) > h.maxBodySize {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", h.maxBodySize))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+
+		type outcome struct {
+			res interface{}
+			err error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			// a panic, e.g. of a function, fails the request rather than the server
+			defer func() {
+				if r := recover(); r != nil {
+					done <- outcome{err: fmt.Errorf("internal error: %v", r)}
+				}
+			}()
+			res, err := fn(ctx, body.Bytes())
+			done <- outcome{res, err}
+		}()
+
+		select {
+		case o := <-done:
+			if o.err != nil {
+				status := http.StatusInternalServerError
+				var se *statusError
+				if errors.As(o.err, &se) {
+					status = se.status
+				}
+				writeError(w, status, o.err)
+				return
+			}
+			writeJSON(w, http.StatusOK, o.res)
+		case <-ctx.Done():
+			writeError(w, http.StatusGatewayTimeout, errors.New("request timed out"))
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// decode reads the request body into req. Facts are read like gorule.DecodeFacts does, so integral numbers are int.
+func decode(body []byte, req interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		return badRequest(fmt.Errorf("invalid request: %w", err))
+	}
+	return nil
+}
+
+func decodeFacts(raw json.RawMessage) (map[string]interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return map[string]interface{}{}, nil
+	}
+	facts, err := gorule.DecodeFacts(bytes.NewReader(raw))
+	if err != nil {
+		return nil, badRequest(err)
+	}
+	return facts, nil
+}
+
+// EvaluateRequest is the request of the evaluate endpoint.
+type EvaluateRequest struct {
+	Expression string          `json:"expression"`
+	Facts      json.RawMessage `json:"facts,omitempty"`
+}
+
+// EvaluateResponse is the response of the evaluate endpoint.
+type EvaluateResponse struct {
+	Result interface{} `json:"result"`
+}
+
+func (h *handler) evaluate(ctx context.Context, body []byte) (interface{}, error) {
+	var req EvaluateRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	if req.Expression == "" {
+		return nil, badRequest(errors.New("missing expression"))
+	}
+	facts, err := decodeFacts(req.Facts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := parser.Evaluate(req.Expression, facts, h.functions)
+	if err != nil {
+		// the expression is part of the request, so failing to evaluate it is the fault of the client
+		return nil, &statusError{status: http.StatusUnprocessableEntity, err: err}
+	}
+	return EvaluateResponse{Result: result}, nil
+}
+
+// MatchRequest is the request of the match endpoint. Without tags, all rules are matched.
+type MatchRequest struct {
+	Facts json.RawMessage `json:"facts"`
+	Tags  []string        `json:"tags,omitempty"`
+}
+
+// MatchResponse is the response of the match endpoint, with the rules ordered by name.
+type MatchResponse struct {
+	Version     int                 `json:"version"`
+	Rules       []MatchedRule       `json:"rules"`
+	Assignments []gorule.Assignment `json:"assignments"`
+}
+
+// MatchedRule is a rule matched along with the result of its action.
+type MatchedRule struct {
+	Name   string      `json:"name"`
+	Result interface{} `json:"result"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func (h *handler) match(ctx context.Context, body []byte) (interface{}, error) {
+	var req MatchRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	facts, err := decodeFacts(req.Facts)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []gorule.MatchOption
+	if len(req.Tags) > 0 {
+		opts = append(opts, gorule.OnlyTags(req.Tags...))
+	}
+	res, err := h.engine.Run(facts, h.functions, opts...)
+	if err != nil {
+		return nil, &statusError{status: http.StatusUnprocessableEntity, err: err}
+	}
+
+	resp := MatchResponse{Version: res.Version, Rules: make([]MatchedRule, 0, len(res.Rules)), Assignments: res.Assignments}
+	if resp.Assignments == nil {
+		resp.Assignments = []gorule.Assignment{}
+	}
+	sort.Slice(res.Rules, func(i, j int) bool { return res.Rules[i].Name() < res.Rules[j].Name() })
+	for _, r := range res.Rules {
+		matched := MatchedRule{Name: r.Name()}
+		if matched.Result, err = r.Execute(facts); err != nil {
+			matched.Error = err.Error()
+		}
+		resp.Rules = append(resp.Rules, matched)
+	}
+	return resp, nil
+}
+
+// RulesResponse is the response of the rules endpoint, with the rules ordered by name.
+type RulesResponse struct {
+	Version int                     `json:"version"`
+	Rules   []gorule.RuleDefinition `json:"rules"`
+}
+
+func (h *handler) rules(ctx context.Context, body []byte) (interface{}, error) {
+	// the version is read first, so the rules are at least as new as the version reported
+	resp := RulesResponse{Version: h.engine.Version(), Rules: make([]gorule.RuleDefinition, 0)}
+	for _, r := range h.engine.Rules() {
+		resp.Rules = append(resp.Rules, r.Definition())
+	}
+	return resp, nil
+}
+
+// ReloadResponse is the response of the reload endpoint.
+type ReloadResponse struct {
+	Version int `json:"version"`
+}
+
+func (h *handler) reloadRules(ctx context.Context, body []byte) (interface{}, error) {
+	if h.reload == nil {
+		return nil, &statusError{status: http.StatusNotImplemented, err: errors.New("reload is not enabled")}
+	}
+	version, err := h.reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ReloadResponse{Version: version}, nil
+}
@@ -0,0 +1,169 @@
+package rulehttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+const rules = `{"rules": [
+	{"name": "vip", "condition": "vipLevel > 5 && !inBlacklist", "action": "balance * 0.3", "tags": ["discount"]},
+	{"name": "rich", "condition": "balance >= 100"}
+]}`
+
+func newServer(t *testing.T, opts ...Option) (*httptest.Server, *gorule.Engine) {
+	loaded, err := gorule.LoadRules(strings.NewReader(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gorule.NewEngine(gorule.WithLogger(log.New(io.Discard, "", 0)))
+	if _, err := engine.Reload(loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(NewHandler(engine, opts...))
+	t.Cleanup(server.Close)
+	return server, engine
+}
+
+func request(t *testing.T, server *httptest.Server, method, path, body string) (int, string) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	return resp.StatusCode, string(content)
+}
+
+func TestHandler_Evaluate(t *testing.T) {
+	server, _ := newServer(t)
+
+	status, body := request(t, server, http.MethodPost, "/v1/evaluate", `{"expression": "age >= 18 ? age / 2 : 0", "facts": {"age": 20}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"result": 10}`, body)
+
+	status, body = request(t, server, http.MethodPost, "/v1/evaluate", `{"expression": "age >= 18"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Contains(t, body, "does not exist")
+
+	status, _ = request(t, server, http.MethodPost, "/v1/evaluate", `{"expr": "1"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = request(t, server, http.MethodGet, "/v1/evaluate", ``)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+}
+
+func TestHandler_Match(t *testing.T) {
+	server, _ := newServer(t)
+
+	status, body := request(t, server, http.MethodPost, "/v1/match", `{"facts": {"vipLevel": 10, "balance": 100, "inBlacklist": false}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"version": 1, "rules": [{"name": "rich", "result": null}, {"name": "vip", "result": 30}], "assignments": []}`, body)
+
+	status, body = request(t, server, http.MethodPost, "/v1/match", `{"facts": {"vipLevel": 10, "balance": 100, "inBlacklist": false}, "tags": ["discount"]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"version": 1, "rules": [{"name": "vip", "result": 30}], "assignments": []}`, body)
+
+	status, _ = request(t, server, http.MethodPost, "/v1/match", `{"facts": {}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+
+	status, _ = request(t, server, http.MethodPost, "/v1/match", `{"facts": [1]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestHandler_DivisionByZero(t *testing.T) {
+	server, engine := newServer(t)
+
+	for _, expr := range []string{"1 / 0", "1 % 0"} {
+		status, body := request(t, server, http.MethodPost, "/v1/evaluate", `{"expression": "`+expr+`"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, status, expr)
+		assert.Contains(t, body, "by zero", expr)
+	}
+
+	if err := engine.AddRule(gorule.NewRule("zero", "balance % 0 == 1", nil)); err != nil {
+		t.Fatal(err)
+	}
+	status, body := request(t, server, http.MethodPost, "/v1/match", `{"facts": {"vipLevel": 10, "balance": 100, "inBlacklist": false}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Contains(t, body, "by zero")
+}
+
+func TestHandler_Panic(t *testing.T) {
+	boom := func(args ...interface{}) (interface{}, error) {
+		var m map[string]int
+		m["boom"]++
+		return nil, nil
+	}
+	server, _ := newServer(t, WithFunctions(map[string]parser.ExpressionFunction{"boom": boom}))
+
+	status, body := request(t, server, http.MethodPost, "/v1/evaluate", `{"expression": "boom()"}`)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Contains(t, body, "internal error")
+
+	status, _ = request(t, server, http.MethodPost, "/v1/evaluate", `{"expression": "1 + 1"}`)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestHandler_RulesAndReload(t *testing.T) {
+	reload := func(ctx context.Context) (int, error) { return 0, errors.New("rule file missing") }
+	server, engine := newServer(t, WithReload(func(ctx context.Context) (int, error) { return reload(ctx) }))
+
+	status, body := request(t, server, http.MethodGet, "/v1/rules", ``)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"version": 1, "rules": [
+		{"name": "rich", "condition": "balance >= 100"},
+		{"name": "vip", "condition": "vipLevel > 5 && !inBlacklist", "action": "balance * 0.3", "tags": ["discount"]}
+	]}`, body)
+
+	status, body = request(t, server, http.MethodPost, "/v1/reload", ``)
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.JSONEq(t, `{"error": "rule file missing"}`, body)
+
+	reload = func(ctx context.Context) (int, error) {
+		return engine.Reload([]*gorule.Rule{gorule.NewRule("adult", "age >= 18", nil)})
+	}
+	status, body = request(t, server, http.MethodPost, "/v1/reload", ``)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"version": 2}`, body)
+
+	server, _ = newServer(t)
+	status, _ = request(t, server, http.MethodPost, "/v1/reload", ``)
+	assert.Equal(t, http.StatusNotImplemented, status)
+}
+
+func TestHandler_Limits(t *testing.T) {
+	slow := func(args ...interface{}) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return true, nil
+	}
+	server, _ := newServer(t, WithMaxBodySize(64), WithTimeout(20*time.Millisecond),
+		WithFunctions(map[string]parser.ExpressionFunction{"slow": slow}))
+
+	status, _ := request(t, server, http.MethodPost, "/v1/evaluate", `{"expression": "`+strings.Repeat("1 + ", 20)+`1"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+
+	status, body := request(t, server, http.MethodPost, "/v1/evaluate", `{"expression": "slow()"}`)
+	assert.Equal(t, http.StatusGatewayTimeout, status)
+	assert.JSONEq(t, `{"error": "request timed out"}`, body)
+}
@@ -0,0 +1,220 @@
+package gorule
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+var (
+	ErrInvalidRuleSet   = errors.New("invalid compiled rule set")
+	ErrRuleSetVersion   = errors.New("unsupported compiled rule set version")
+	ErrRuleSetChecksum  = errors.New("compiled rule set checksum mismatch")
+	ErrUnresolvedAction = errors.New("unresolved rule action")
+)
+
+// RuleSetFormat is the version of the format written by EncodeRuleSet. DecodeRuleSet only reads this version.
+const RuleSetFormat = 1
+
+var ruleSetMagic = []byte("GORULES\x00")
+
+// crcTable is used for the checksum of compiled rule sets.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// action kinds of ruleRecord
+const (
+	actionNone       = iota
+	actionExpression // created from a RuleDefinition, restored by evaluating the expression
+	actionFunction   // a Go function, restored by the rule name
+)
+
+// ruleRecord is a rule as written by EncodeRuleSet.
+type ruleRecord struct {
+	Name        string
+	Condition   string
+	Program     []byte // nil if the condition cannot be parsed
+	ActionKind  int
+	Action      string
+	Tags        []string
+	Description string
+	Owner       string
+	Version     string
+	Attributes  map[string]string
+	Disabled    bool
+	ValidFrom   time.Time
+	ValidUntil  time.Time
+	Rollout     *RolloutDefinition
+	Experiment  string
+	Variant     string
+}
+
+// EncodeRuleSet writes the rules with their conditions compiled, so DecodeRuleSet can restore them
+// without parsing the conditions again. The format starts with a header holding its version, RuleSetFormat,
+// and a checksum of the rules. Actions created from an expression, e.g. by rule files, are written as expression,
+// while Go functions are referred to by the rule name and have to be passed to DecodeRuleSet.
+func EncodeRuleSet(w io.Writer, rules []*Rule) error {
+	records := make([]ruleRecord, 0, len(rules))
+	for _, r := range rules {
+		record := ruleRecord{
+			Name:        r.name,
+			Condition:   r.condition,
+			Tags:        r.tags,
+			Description: r.description,
+			Owner:       r.owner,
+			Version:     r.version,
+			Attributes:  r.attributes,
+			Disabled:    r.disabled,
+			ValidFrom:   r.validFrom,
+			ValidUntil:  r.validUntil,
+			Experiment:  r.experiment,
+			Variant:     r.variant,
+		}
+
+		program := r.program
+		if program == nil {
+			program, _ = parser.Compile(r.condition)
+		}
+		if program != nil {
+			data, err := program.MarshalBinary()
+			if err != nil {
+				return fmt.Errorf("rule %s: %w", r.name, err)
+			}
+			record.Program = data
+		}
+
+		switch {
+		case r.actionExpr != nil:
+			record.ActionKind, record.Action = actionExpression, *r.actionExpr
+		case r.action != nil:
+			record.ActionKind = actionFunction
+		}
+		if r.rollout != nil {
+			record.Rollout = &RolloutDefinition{Percent: r.rollout.percent, Key: r.rollout.key}
+		}
+		records = append(records, record)
+	}
+	return writeRuleSet(w, records)
+}
+
+// writeRuleSet writes the header followed by the records.
+func writeRuleSet(w io.Writer, records []ruleRecord) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(records); err != nil {
+		return err
+	}
+
+	header := make([]byte, len(ruleSetMagic)+2+8+4)
+	n := copy(header, ruleSetMagic)
+	binary.BigEndian.PutUint16(header[n:], RuleSetFormat)
+	binary.BigEndian.PutUint64(header[n+2:], uint64(payload.Len()))
+	binary.BigEndian.PutUint32(header[n+10:], crc32.Checksum(payload.Bytes(), crcTable))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload.Bytes())
+	return err
+}
+
+// DecodeRuleSet reads rules written by EncodeRuleSet. actions maps the names of rules whose actions are Go functions
+// to the functions. Return error wrapping ErrRuleSetVersion if the rules were written in another version of the format,
+// ErrRuleSetChecksum if they were modified, and ErrUnresolvedAction if a function is missing.
+func DecodeRuleSet(r io.Reader, actions map[string]func(interface{}) (interface{}, error)) ([]*Rule, error) {
+	header := make([]byte, len(ruleSetMagic)+2+8+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRuleSet, err)
+	}
+	n := len(ruleSetMagic)
+	if !bytes.Equal(header[:n], ruleSetMagic) {
+		return nil, fmt.Errorf("%w: not a compiled rule set", ErrInvalidRuleSet)
+	}
+	if format := binary.BigEndian.Uint16(header[n:]); format != RuleSetFormat {
+		return nil, fmt.Errorf("%w: %d, want %d", ErrRuleSetVersion, format, RuleSetFormat)
+	}
+	length := binary.BigEndian.Uint64(header[n+2:])
+	checksum := binary.BigEndian.Uint32(header[n+10:])
+
+	if length > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: invalid length", ErrInvalidRuleSet)
+	}
+
+	// the length is not trusted before the checksum was verified, so the payload is not allocated up front
+	var payload bytes.Buffer
+	if _, err := io.Copy(&payload, io.LimitReader(r, int64(length))); err != nil {
+		return nil, err
+	}
+	if uint64(payload.Len()) != length {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidRuleSet)
+	}
+	if crc32.Checksum(payload.Bytes(), crcTable) != checksum {
+		return nil, ErrRuleSetChecksum
+	}
+
+	var records []ruleRecord
+	if err := gob.NewDecoder(&payload).Decode(&records); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRuleSet, err)
+	}
+
+	rules := make([]*Rule, 0, len(records))
+	for _, record := range records {
+		rule := &Rule{
+			name:        record.Name,
+			condition:   record.Condition,
+			tags:        record.Tags,
+			description: record.Description,
+			owner:       record.Owner,
+			version:     record.Version,
+			attributes:  record.Attributes,
+			disabled:    record.Disabled,
+			validFrom:   record.ValidFrom,
+			validUntil:  record.ValidUntil,
+			experiment:  record.Experiment,
+			variant:     record.Variant,
+		}
+		if record.Program != nil {
+			rule.program = &parser.Program{}
+			if err := rule.program.UnmarshalBinary(record.Program); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", record.Name, err)
+			}
+		}
+
+		switch record.ActionKind {
+		case actionExpression:
+			expr := record.Action
+			rule.action, rule.actionExpr = expressionAction(expr), &expr
+		case actionFunction:
+			action, ok := actions[record.Name]
+			if !ok {
+				return nil, fmt.Errorf("%w: rule %s", ErrUnresolvedAction, record.Name)
+			}
+			rule.action = action
+		}
+		if record.Rollout != nil {
+			rule.rollout = &rollout{percent: record.Rollout.Percent, key: record.Rollout.Key}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// WriteRuleSet writes the current version of the rules of the engine, see EncodeRuleSet.
+func (e *Engine) WriteRuleSet(w io.Writer) error {
+	return EncodeRuleSet(w, e.Rules())
+}
+
+// ReadRuleSet replaces the rules of the engine by the ones read, see DecodeRuleSet, creating a new version,
+// and returns its number. The conditions are not parsed again, so no warnings about them are logged.
+func (e *Engine) ReadRuleSet(r io.Reader, actions map[string]func(interface{}) (interface{}, error)) (int, error) {
+	rules, err := DecodeRuleSet(r, actions)
+	if err != nil {
+		return e.Version(), err
+	}
+	return e.Reload(rules)
+}
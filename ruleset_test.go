@@ -0,0 +1,128 @@
+package gorule
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ruleSetFile = `{
+	"experiments": [],
+	"rules": [
+		{"name": "vip", "condition": "true && vipLevel > 2 + 3 && !inBlacklist", "action": "balance * 0.3",
+		 "tags": ["discount"], "owner": "pricing", "attributes": {"ticket": "PRICE-42"}},
+		{"name": "christmas", "condition": "basket > 50", "enabled": false,
+		 "validFrom": "2024-12-01T00:00:00Z", "validUntil": "2024-12-27T00:00:00Z"},
+		{"name": "new", "condition": "basket > 10", "rollout": {"percent": 50, "key": "userId"}},
+		{"name": "broken", "condition": "basket >"}
+	]
+}`
+
+func TestEncodeRuleSet(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(ruleSetFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules = append(rules, NewRule("go", "basket > 100", func(interface{}) (interface{}, error) { return "go", nil }))
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	if _, err := e.Reload(rules); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.WriteRuleSet(&buf); err != nil {
+		t.Fatalf("WriteRuleSet() error = %v", err)
+	}
+	data := buf.Bytes()
+
+	restored := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	actions := map[string]func(interface{}) (interface{}, error){
+		"go": func(interface{}) (interface{}, error) { return "go", nil },
+	}
+	if _, err := restored.ReadRuleSet(bytes.NewReader(data), actions); err != nil {
+		t.Fatalf("ReadRuleSet() error = %v", err)
+	}
+
+	for i, r := range restored.Rules() {
+		want := e.Rules()[i]
+		if r.Name() != want.Name() || r.Condition() != want.Condition() || !reflect.DeepEqual(r.program, want.program) ||
+			!reflect.DeepEqual(r.Tags(), want.Tags()) || r.Owner() != want.Owner() || !reflect.DeepEqual(r.Attributes(), want.Attributes()) ||
+			r.Enabled() != want.Enabled() || !r.ValidFrom().Equal(want.ValidFrom()) || !r.ValidUntil().Equal(want.ValidUntil()) ||
+			!reflect.DeepEqual(r.rollout, want.rollout) {
+			t.Errorf("restored rule %+v, want %+v", r, want)
+		}
+	}
+	if restored.Rules()[0].program != nil {
+		t.Errorf("restored program of broken rule, want none")
+	}
+
+	vars := map[string]interface{}{"vipLevel": 6, "inBlacklist": false, "balance": 100, "basket": 200, "userId": 1}
+	got, err := restored.Match(vars, nil, OnlyRules(func(r *Rule) bool { return r.Name() != "broken" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string]interface{})
+	for _, r := range got {
+		results[r.Name()], _ = r.Execute(vars)
+	}
+	if results["vip"] != 30.0 || results["go"] != "go" {
+		t.Errorf("restored actions returned %v", results)
+	}
+
+	if _, err := DecodeRuleSet(bytes.NewReader(data), nil); !errors.Is(err, ErrUnresolvedAction) {
+		t.Errorf("DecodeRuleSet() without actions error = %v, want %v", err, ErrUnresolvedAction)
+	}
+}
+
+func TestDecodeRuleSet_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeRuleSet(&buf, []*Rule{NewRule("adult", "age >= 18", nil)}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	modified := func(i int, b byte) []byte {
+		copied := append([]byte(nil), data...)
+		copied[i] = b
+		return copied
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "empty", data: nil, want: ErrInvalidRuleSet},
+		{name: "rule file", data: []byte(`{"rules": []}`), want: ErrInvalidRuleSet},
+		{name: "newer format", data: modified(9, RuleSetFormat+1), want: ErrRuleSetVersion},
+		{name: "modified", data: modified(len(data)-1, data[len(data)-1]^0xff), want: ErrRuleSetChecksum},
+		{name: "truncated", data: data[:len(data)-1], want: ErrInvalidRuleSet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeRuleSet(bytes.NewReader(tt.data), nil); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeRuleSet() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	rules, err := DecodeRuleSet(bytes.NewReader(data), nil)
+	if err != nil || len(rules) != 1 || rules[0].action != nil {
+		t.Errorf("DecodeRuleSet() = %v, %v, want adult without action", rules, err)
+	}
+}
+
+func TestDecodeRuleSet_InvalidProgram(t *testing.T) {
+	// the program of `a + b` whose left operand is missing, with a valid header and checksum
+	program := []byte{1, 5, 'a', ' ', '+', ' ', 'b', 1, 9, 1, '+', 0, 0, 1, 6, 2, 0, 1, 3, 0, 1, 'b', 0, 5, 6, 0}
+	var buf bytes.Buffer
+	if err := writeRuleSet(&buf, []ruleRecord{{Name: "sum", Condition: "a + b", Program: program}}); err != nil {
+		t.Fatal(err)
+	}
+	if rules, err := DecodeRuleSet(&buf, nil); err == nil || !strings.Contains(err.Error(), "missing operand") {
+		t.Errorf("DecodeRuleSet() = %v, %v, want error for missing operand", rules, err)
+	}
+}
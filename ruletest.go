@@ -0,0 +1,222 @@
+package gorule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// TestSuite is the JSON representation of test cases for the rules of an engine, e.g.
+//
+//	{
+//	  "rules": "discount.json",
+//	  "tests": [
+//	    {"name": "vip", "facts": {"vipLevel": 10}, "matched": ["vip"], "results": {"vip": 30}}
+//	  ]
+//	}
+type TestSuite struct {
+	// Rules is the path of the rule file to test, relative to the test suite file.
+	Rules string     `json:"rules,omitempty"`
+	Tests []TestCase `json:"tests"`
+}
+
+// TestCase describes the expected outcome of matching the rules against facts.
+// Matched is only checked if set, so an empty list expects no rule to match.
+// Results holds the expected results of the actions of matched rules by rule name.
+// Error expects Match to fail with an error containing it.
+type TestCase struct {
+	Name    string                 `json:"name"`
+	Facts   map[string]interface{} `json:"facts"`
+	Matched []string               `json:"matched,omitempty"`
+	Results map[string]interface{} `json:"results,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// TestResult is the outcome of a test case. The test case passed if there are no failures.
+type TestResult struct {
+	Name     string   `json:"name"`
+	Matched  []string `json:"matched"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Passed reports whether the test case passed.
+func (r TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// TestReport holds the results of a test suite and how many test cases matched each rule.
+type TestReport struct {
+	Results  []TestResult   `json:"results"`
+	Coverage map[string]int `json:"coverage"`
+}
+
+// NewTestReport creates an empty report covering the rules of the engine.
+func NewTestReport(e *Engine) *TestReport {
+	report := &TestReport{Results: []TestResult{}, Coverage: map[string]int{}}
+	for _, r := range e.Rules() {
+		report.Coverage[r.Name()] = 0
+	}
+	return report
+}
+
+// Add adds the result of a test case to the report.
+func (r *TestReport) Add(res TestResult) {
+	for _, name := range res.Matched {
+		r.Coverage[name]++
+	}
+	r.Results = append(r.Results, res)
+}
+
+// Passed reports whether all test cases passed.
+func (r *TestReport) Passed() bool {
+	for _, res := range r.Results {
+		if !res.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Uncovered returns the names of the rules not matched by any test case.
+func (r *TestReport) Uncovered() []string {
+	names := make([]string, 0)
+	for name, count := range r.Coverage {
+		if count == 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CoverageRatio returns the share of the rules matched by at least one test case.
+func (r *TestReport) CoverageRatio() float64 {
+	if len(r.Coverage) == 0 {
+		return 1
+	}
+	return float64(len(r.Coverage)-len(r.Uncovered())) / float64(len(r.Coverage))
+}
+
+// DecodeTestSuite reads a test suite. Numbers within facts and results are decoded like DecodeFacts does.
+func DecodeTestSuite(r io.Reader) (*TestSuite, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+
+	var suite TestSuite
+	if err := dec.Decode(&suite); err != nil {
+		return nil, fmt.Errorf("cannot decode test suite: %w", err)
+	}
+
+	for i := range suite.Tests {
+		tc := &suite.Tests[i]
+		if tc.Name == "" {
+			return nil, fmt.Errorf("cannot decode test suite: test #%d has no name", i+1)
+		}
+		if tc.Facts == nil {
+			tc.Facts = map[string]interface{}{}
+		}
+		normalizeNumbers(tc.Facts)
+		normalizeNumbers(tc.Results)
+	}
+
+	return &suite, nil
+}
+
+// RunTests runs all test cases of the suite against the rules of the engine.
+func (e *Engine) RunTests(suite *TestSuite, functions map[string]parser.ExpressionFunction) *TestReport {
+	report := NewTestReport(e)
+	for _, tc := range suite.Tests {
+		report.Add(e.RunTest(tc, functions))
+	}
+
+	return report
+}
+
+// RunTest matches the rules of the engine against the facts of the test case and compares the outcome.
+func (e *Engine) RunTest(tc TestCase, functions map[string]parser.ExpressionFunction) TestResult {
+	res := TestResult{Name: tc.Name, Matched: []string{}}
+
+	rules, err := e.Match(tc.Facts, functions)
+	switch {
+	case err != nil && tc.Error == "":
+		res.Failures = append(res.Failures, fmt.Sprintf("unexpected error: %v", err))
+		return res
+	case err != nil && !strings.Contains(err.Error(), tc.Error):
+		res.Failures = append(res.Failures, fmt.Sprintf("expected error containing %q, but was: %v", tc.Error, err))
+		return res
+	case err != nil:
+		return res
+	case tc.Error != "":
+		res.Failures = append(res.Failures, fmt.Sprintf("expected error containing %q, but matched without error", tc.Error))
+	}
+
+	results := map[string]interface{}{}
+	for _, r := range rules {
+		res.Matched = append(res.Matched, r.Name())
+		if _, ok := tc.Results[r.Name()]; !ok {
+			continue
+		}
+		if results[r.Name()], err = r.Execute(tc.Facts); err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("action of %q failed: %v", r.Name(), err))
+		}
+	}
+	sort.Strings(res.Matched)
+
+	if tc.Matched != nil {
+		if diff := diffNames(tc.Matched, res.Matched); diff != "" {
+			res.Failures = append(res.Failures, "matched rules differ (- expected, + actual):\n"+diff)
+		}
+	}
+
+	names := make([]string, 0, len(tc.Results))
+	for name := range tc.Results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expected := tc.Results[name]
+		actual, ok := results[name]
+		switch {
+		case !ok:
+			res.Failures = append(res.Failures, fmt.Sprintf("result of %q: expected %s, but the rule did not match",
+				name, parser.FormatValue(expected)))
+		case !parser.Equal(expected, actual):
+			res.Failures = append(res.Failures, fmt.Sprintf("result of %q: expected %s, but was %s",
+				name, parser.FormatValue(expected), parser.FormatValue(actual)))
+		}
+	}
+
+	return res
+}
+
+// diffNames lists the names only expected prefixed with "-" and the ones only present in actual prefixed with "+".
+func diffNames(expected, actual []string) string {
+	inExpected := map[string]bool{}
+	for _, name := range expected {
+		inExpected[name] = true
+	}
+	inActual := map[string]bool{}
+	for _, name := range actual {
+		inActual[name] = true
+	}
+
+	var lines []string
+	for _, name := range expected {
+		if !inActual[name] {
+			lines = append(lines, "- "+name)
+		}
+	}
+	for _, name := range actual {
+		if !inExpected[name] {
+			lines = append(lines, "+ "+name)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,87 @@
+// Package ruletest runs declarative test cases for rules within go test.
+//
+// A test suite is a JSON file as described by gorule.TestSuite:
+//
+//	func TestDiscountRules(t *testing.T) {
+//		ruletest.RunFile(t, "testdata/discount_test.json", nil)
+//	}
+package ruletest
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spikewong/gorule"
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// Run runs each test case of the suite at path against the rules of the engine as subtest.
+func Run(t *testing.T, engine *gorule.Engine, functions map[string]parser.ExpressionFunction, path string) *gorule.TestReport {
+	t.Helper()
+
+	suite, err := LoadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return run(t, engine, functions, suite)
+}
+
+// RunFile runs the test suite at path against the rules of the rule file referenced by the suite.
+func RunFile(t *testing.T, path string, functions map[string]parser.ExpressionFunction) *gorule.TestReport {
+	t.Helper()
+
+	suite, err := LoadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.Rules == "" {
+		t.Fatalf("%s: the test suite does not reference a rule file", path)
+	}
+
+	// errors during matching are not logged, as they are reported by the test cases
+	engine, err := gorule.NewEngineFromFile(filepath.Join(filepath.Dir(path), suite.Rules),
+		gorule.WithLogger(log.New(io.Discard, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return run(t, engine, functions, suite)
+}
+
+func run(t *testing.T, engine *gorule.Engine, functions map[string]parser.ExpressionFunction, suite *gorule.TestSuite) *gorule.TestReport {
+	t.Helper()
+
+	report := gorule.NewTestReport(engine)
+	for _, tc := range suite.Tests {
+		res := engine.RunTest(tc, functions)
+		report.Add(res)
+
+		t.Run(tc.Name, func(t *testing.T) {
+			for _, failure := range res.Failures {
+				t.Error(failure)
+			}
+		})
+	}
+
+	return report
+}
+
+// LoadSuite reads the test suite at path.
+func LoadSuite(path string) (*gorule.TestSuite, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	suite, err := gorule.DecodeTestSuite(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return suite, nil
+}
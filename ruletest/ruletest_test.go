@@ -0,0 +1,29 @@
+package ruletest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spikewong/gorule"
+)
+
+func TestRunFile(t *testing.T) {
+	report := RunFile(t, "testdata/discount_test.json", nil)
+
+	assert.True(t, report.Passed())
+	assert.Len(t, report.Results, 3)
+	assert.Equal(t, map[string]int{"vip": 1, "rich": 1, "blacklist": 1}, report.Coverage)
+}
+
+func TestRun(t *testing.T) {
+	engine := gorule.NewEngine()
+	assert.NoError(t, engine.AddRule(gorule.NewRule("vip", "vipLevel > 5 && !inBlacklist", func(i interface{}) (interface{}, error) {
+		return 30, nil
+	})))
+
+	report := Run(t, engine, nil, "testdata/vip_test.json")
+
+	assert.True(t, report.Passed())
+	assert.Empty(t, report.Uncovered())
+}
@@ -0,0 +1,82 @@
+package gorule
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEngine_RunTests(t *testing.T) {
+	engine := NewEngine(WithLogger(log.New(io.Discard, "", log.LstdFlags)))
+	for _, r := range []*Rule{
+		NewRule("pass", "grade >= 60", func(i interface{}) (interface{}, error) { return "passed", nil }),
+		NewRule("fail", "grade < 40", func(i interface{}) (interface{}, error) { return "failed", nil }),
+		NewRule("excellent", "grade >= 90", func(i interface{}) (interface{}, error) { return 1.0, nil }),
+	} {
+		if err := engine.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	suite, err := DecodeTestSuite(strings.NewReader(`{"tests": [
+		{"name": "excellent", "facts": {"grade": 95}, "matched": ["excellent", "pass"], "results": {"excellent": 1}},
+		{"name": "wrong rules", "facts": {"grade": 30}, "matched": ["pass"]},
+		{"name": "wrong result", "facts": {"grade": 70}, "results": {"pass": "excellent", "fail": "failed"}},
+		{"name": "unexpected error", "facts": {}},
+		{"name": "expected error", "facts": {}, "error": "does not exist"},
+		{"name": "missing error", "facts": {"grade": 50}, "matched": [], "error": "does not exist"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := engine.RunTests(suite, nil)
+
+	failures := map[string][]string{}
+	for _, res := range report.Results {
+		failures[res.Name] = res.Failures
+	}
+	want := map[string][]string{
+		"excellent":   nil,
+		"wrong rules": {"matched rules differ (- expected, + actual):\n+ fail\n- pass"},
+		"wrong result": {
+			`result of "fail": expected "failed", but the rule did not match`,
+			`result of "pass": expected "excellent", but was "passed"`,
+		},
+		"unexpected error": {`unexpected error: unexpected error occured during match: var error: variable "grade" does not exist`},
+		"expected error":   nil,
+		"missing error":    {`expected error containing "does not exist", but matched without error`},
+	}
+	if !reflect.DeepEqual(failures, want) {
+		t.Errorf("RunTests() failures = %#v, want %#v", failures, want)
+	}
+
+	if report.Passed() {
+		t.Errorf("Passed() = true, want false")
+	}
+	if got := report.Uncovered(); !reflect.DeepEqual(got, []string{}) {
+		t.Errorf("Uncovered() = %v, want none", got)
+	}
+	if got := report.Coverage; !reflect.DeepEqual(got, map[string]int{"pass": 2, "fail": 1, "excellent": 1}) {
+		t.Errorf("Coverage = %v", got)
+	}
+}
+
+func TestEngine_Rules(t *testing.T) {
+	engine := NewEngine()
+	for _, name := range []string{"b", "c", "a"} {
+		if err := engine.AddRule(NewRule(name, "true", nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := make([]string, 0)
+	for _, r := range engine.Rules() {
+		names = append(names, r.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("Rules() = %v, want ordered by name", names)
+	}
+}
@@ -0,0 +1,201 @@
+package gorule
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/spikewong/gorule/internal/parser"
+)
+
+// ShadowSink records the differences found by shadow evaluation, see WithShadow.
+// Record is called by Match, so implementations have to be safe for concurrent use.
+type ShadowSink interface {
+	Record(diff *ShadowDiff)
+}
+
+// ShadowSinkFunc adapts a function to a ShadowSink.
+type ShadowSinkFunc func(diff *ShadowDiff)
+
+// Record calls f(diff).
+func (f ShadowSinkFunc) Record(diff *ShadowDiff) {
+	f(diff)
+}
+
+// ShadowDiff describes how the candidate rule set decided differently than the live one for the same facts.
+// Rule names are ordered. Error is set, and the other differences are empty, if matching the candidate rule set failed.
+type ShadowDiff struct {
+	Facts            map[string]interface{} `json:"facts"`
+	LiveVersion      int                    `json:"liveVersion"`
+	CandidateVersion int                    `json:"candidateVersion"`
+	OnlyLive         []string               `json:"onlyLive,omitempty"`      // matched by the live rule set only
+	OnlyCandidate    []string               `json:"onlyCandidate,omitempty"` // matched by the candidate rule set only
+	Results          []ResultDiff           `json:"results,omitempty"`
+	Error            string                 `json:"error,omitempty"`
+}
+
+// ResultDiff holds the differing results of the actions of a rule matched by both rule sets, see CompareActionResults.
+// An action failing is reported by its error message.
+type ResultDiff struct {
+	Rule           string      `json:"rule"`
+	Live           interface{} `json:"live"`
+	LiveError      string      `json:"liveError,omitempty"`
+	Candidate      interface{} `json:"candidate"`
+	CandidateError string      `json:"candidateError,omitempty"`
+}
+
+// Empty reports whether both rule sets decided the same.
+func (d *ShadowDiff) Empty() bool {
+	return len(d.OnlyLive) == 0 && len(d.OnlyCandidate) == 0 && len(d.Results) == 0 && d.Error == ""
+}
+
+type shadow struct {
+	candidate      *Engine
+	sink           ShadowSink
+	compareResults bool
+}
+
+// ShadowOption configures the evaluation of a candidate in shadow.
+type ShadowOption func(*shadow)
+
+// CompareActionResults additionally compares the rules matched by both rule sets by the results of their actions,
+// which are executed with the facts as input on every Match, so they must not have side effects.
+func CompareActionResults() ShadowOption {
+	return func(s *shadow) {
+		s.compareResults = true
+	}
+}
+
+func newShadow(candidate *Engine, sink ShadowSink, opts []ShadowOption) *shadow {
+	s := &shadow{candidate: candidate, sink: sink}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithShadow evaluates the rules of candidate in shadow: Match matches the candidate engine against the same facts
+// after the live rules and records the differences in the names of the rules matched to sink, but returns the result
+// of the live rules only, even if the candidate fails. Actions are never executed, unless CompareActionResults is given.
+func WithShadow(candidate *Engine, sink ShadowSink, opts ...ShadowOption) Option {
+	return func(e *Engine) {
+		e.shadow = newShadow(candidate, sink, opts)
+	}
+}
+
+// SetShadow replaces the candidate evaluated in shadow, see WithShadow. A nil candidate stops shadow evaluation.
+func (e *Engine) SetShadow(candidate *Engine, sink ShadowSink, opts ...ShadowOption) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if candidate == nil {
+		e.shadow = nil
+		return
+	}
+	e.shadow = newShadow(candidate, sink, opts)
+}
+
+// compare matches the candidate against vars and records the differences to the live result.
+func (s *shadow) compare(live *MatchResult, vars map[string]interface{}, functions map[string]parser.ExpressionFunction, opts []MatchOption) {
+	res, err := s.candidate.Run(vars, functions, opts...)
+	if err != nil {
+		s.sink.Record(&ShadowDiff{Facts: vars, LiveVersion: live.Version, Error: err.Error()})
+		return
+	}
+
+	diff := &ShadowDiff{Facts: vars, LiveVersion: live.Version, CandidateVersion: res.Version}
+	candidateRules := make(map[string]Rule, len(res.Rules))
+	for _, r := range res.Rules {
+		candidateRules[r.Name()] = r
+	}
+	liveRules := make(map[string]Rule, len(live.Rules))
+	for _, r := range live.Rules {
+		liveRules[r.Name()] = r
+	}
+
+	for _, r := range live.Rules {
+		c, ok := candidateRules[r.Name()]
+		if !ok {
+			diff.OnlyLive = append(diff.OnlyLive, r.Name())
+			continue
+		}
+		if !s.compareResults {
+			continue
+		}
+		liveRes, liveErr := execute(r, vars)
+		candidateRes, candidateErr := execute(c, vars)
+		if !reflect.DeepEqual(liveRes, candidateRes) || errorString(liveErr) != errorString(candidateErr) {
+			diff.Results = append(diff.Results, ResultDiff{
+				Rule:           r.Name(),
+				Live:           liveRes,
+				LiveError:      errorString(liveErr),
+				Candidate:      candidateRes,
+				CandidateError: errorString(candidateErr),
+			})
+		}
+	}
+	for _, r := range res.Rules {
+		if _, ok := liveRules[r.Name()]; !ok {
+			diff.OnlyCandidate = append(diff.OnlyCandidate, r.Name())
+		}
+	}
+
+	if diff.Empty() {
+		return
+	}
+	sort.Strings(diff.OnlyLive)
+	sort.Strings(diff.OnlyCandidate)
+	sort.Slice(diff.Results, func(i, j int) bool { return diff.Results[i].Rule < diff.Results[j].Rule })
+	s.sink.Record(diff)
+}
+
+// execute executes the action of r, if any, with vars as input.
+func execute(r Rule, vars map[string]interface{}) (interface{}, error) {
+	if r.action == nil {
+		return nil, nil
+	}
+	return r.Execute(vars)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// ShadowRecorder is a ShadowSink keeping the differences in memory.
+type ShadowRecorder struct {
+	mu    sync.Mutex
+	diffs []*ShadowDiff
+}
+
+// Record adds diff.
+func (r *ShadowRecorder) Record(diff *ShadowDiff) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.diffs = append(r.diffs, diff)
+}
+
+// Diffs returns the differences recorded, oldest first.
+func (r *ShadowRecorder) Diffs() []*ShadowDiff {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*ShadowDiff(nil), r.diffs...)
+}
+
+// NewJSONShadowSink creates a ShadowSink writing each difference as a line of JSON to w.
+func NewJSONShadowSink(w io.Writer) ShadowSink {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return ShadowSinkFunc(func(diff *ShadowDiff) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		_ = enc.Encode(diff)
+	})
+}
@@ -0,0 +1,129 @@
+package gorule
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestEngine_Shadow(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	live := NewEngine(WithLogger(logger))
+	candidate := NewEngine(WithLogger(logger))
+	if _, err := live.Reload([]*Rule{
+		NewRule("adult", "age >= 18", nil),
+		NewRule("discount", "age >= 65", func(interface{}) (interface{}, error) { return 0.3, nil }),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := candidate.Reload([]*Rule{
+		NewRule("adult", "age >= 21", nil),
+		NewRule("discount", "age >= 65", func(interface{}) (interface{}, error) { return 0.2, nil }),
+		NewRule("senior", "age >= 65 && member", nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &ShadowRecorder{}
+	live.SetShadow(candidate, recorder, CompareActionResults())
+
+	tests := []struct {
+		name string
+		vars map[string]interface{}
+		want *ShadowDiff
+	}{
+		{
+			name: "same decision",
+			vars: map[string]interface{}{"age": 30, "member": true},
+		},
+		{
+			name: "matched by live only",
+			vars: map[string]interface{}{"age": 19, "member": true},
+			want: &ShadowDiff{LiveVersion: 1, CandidateVersion: 1, OnlyLive: []string{"adult"}},
+		},
+		{
+			name: "matched by candidate only and differing results",
+			vars: map[string]interface{}{"age": 70, "member": true},
+			want: &ShadowDiff{
+				LiveVersion:      1,
+				CandidateVersion: 1,
+				OnlyCandidate:    []string{"senior"},
+				Results:          []ResultDiff{{Rule: "discount", Live: 0.3, Candidate: 0.2}},
+			},
+		},
+		{
+			name: "candidate fails",
+			vars: map[string]interface{}{"age": 70},
+			want: &ShadowDiff{LiveVersion: 1, Error: `unexpected error occured during match: var error: variable "member" does not exist`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Diffs())
+			res, err := live.Run(tt.vars, nil)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			for _, r := range res.Rules {
+				if r.Name() == "senior" {
+					t.Errorf("Run() returned rule %s of the candidate", r.Name())
+				}
+			}
+
+			diffs := recorder.Diffs()[before:]
+			if tt.want == nil {
+				if len(diffs) != 0 {
+					t.Errorf("recorded %+v, want no difference", diffs[0])
+				}
+				return
+			}
+			if len(diffs) != 1 {
+				t.Fatalf("recorded %d differences, want 1", len(diffs))
+			}
+			tt.want.Facts = tt.vars
+			if !reflect.DeepEqual(diffs[0], tt.want) {
+				t.Errorf("recorded %+v, want %+v", diffs[0], tt.want)
+			}
+		})
+	}
+
+	live.SetShadow(nil, nil)
+	before := len(recorder.Diffs())
+	if _, err := live.Match(map[string]interface{}{"age": 19}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Diffs()) != before {
+		t.Errorf("recorded differences after shadow evaluation stopped")
+	}
+}
+
+func TestEngine_ShadowWithoutActions(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	executed := 0
+	action := func(interface{}) (interface{}, error) {
+		executed++
+		return executed, nil
+	}
+	candidate := NewEngine(WithLogger(logger))
+	if err := candidate.AddRule(NewRule("adult", "age >= 21", action)); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &ShadowRecorder{}
+	live := NewEngine(WithLogger(logger), WithShadow(candidate, recorder))
+	if err := live.AddRule(NewRule("adult", "age >= 18", action)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, age := range []int{30, 19} {
+		if _, err := live.Match(map[string]interface{}{"age": age}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if executed != 0 {
+		t.Errorf("shadow evaluation executed %d actions, want none", executed)
+	}
+	want := []*ShadowDiff{{Facts: map[string]interface{}{"age": 19}, LiveVersion: 1, CandidateVersion: 1, OnlyLive: []string{"adult"}}}
+	if got := recorder.Diffs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded %+v, want %+v", got, want)
+	}
+}
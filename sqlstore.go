@@ -0,0 +1,193 @@
+package gorule
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLStore is a RuleStore keeping the rules in a table of a database/sql database, with the rule name
+// as primary key and the definition as JSON text:
+//
+//	CREATE TABLE rules (name VARCHAR(255) PRIMARY KEY, definition TEXT NOT NULL)
+//
+// The statements use ? as placeholder by default, see WithSQLPlaceholder for other databases.
+type SQLStore struct {
+	db           *sql.DB
+	table        string
+	pollInterval time.Duration
+	placeholder  func(n int) string
+}
+
+// SQLStoreOption configures a SQLStore.
+type SQLStoreOption func(*SQLStore)
+
+// WithSQLTable sets the table of the rules, "rules" by default. The name is used as it is, so it must not come from users.
+func WithSQLTable(table string) SQLStoreOption {
+	return func(s *SQLStore) {
+		s.table = table
+	}
+}
+
+// WithSQLPollInterval sets how often Watch looks for changes, every 10 seconds by default.
+// Intervals which are not positive keep the default.
+func WithSQLPollInterval(interval time.Duration) SQLStoreOption {
+	return func(s *SQLStore) {
+		if interval > 0 {
+			s.pollInterval = interval
+		}
+	}
+}
+
+// WithSQLPlaceholder sets the placeholder of the nth argument of a statement, counting from 1,
+// e.g. func(n int) string { return "$" + strconv.Itoa(n) } for PostgreSQL. See DollarPlaceholder.
+func WithSQLPlaceholder(placeholder func(n int) string) SQLStoreOption {
+	return func(s *SQLStore) {
+		s.placeholder = placeholder
+	}
+}
+
+// DollarPlaceholder is the placeholder of PostgreSQL, e.g. $1.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// NewSQLStore creates a store keeping the rules in db. The table has to exist, see CreateTable.
+func NewSQLStore(db *sql.DB, opts ...SQLStoreOption) *SQLStore {
+	s := &SQLStore{
+		db:           db,
+		table:        "rules",
+		pollInterval: 10 * time.Second,
+		placeholder:  func(int) string { return "?" },
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// query replaces the placeholders ? of q, and the table name {table}.
+func (s *SQLStore) query(q string) string {
+	q = strings.ReplaceAll(q, "{table}", s.table)
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString(s.placeholder(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// CreateTable creates the table of the rules if it does not exist.
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.query(`CREATE TABLE IF NOT EXISTS {table} (name VARCHAR(255) PRIMARY KEY, definition TEXT NOT NULL)`))
+	return err
+}
+
+// List returns the definitions of all rules ordered by name.
+func (s *SQLStore) List(ctx context.Context) ([]RuleDefinition, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT name, definition FROM {table} ORDER BY name`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := make([]RuleDefinition, 0)
+	for rows.Next() {
+		var name, definition string
+		if err := rows.Scan(&name, &definition); err != nil {
+			return nil, err
+		}
+		def, err := decodeDefinition(name, definition)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// Get returns the definition of the rule named name.
+func (s *SQLStore) Get(ctx context.Context, name string) (RuleDefinition, error) {
+	var definition string
+	err := s.db.QueryRowContext(ctx, s.query(`SELECT definition FROM {table} WHERE name = ?`), name).Scan(&definition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RuleDefinition{}, fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	if err != nil {
+		return RuleDefinition{}, err
+	}
+	return decodeDefinition(name, definition)
+}
+
+func decodeDefinition(name, definition string) (RuleDefinition, error) {
+	var def RuleDefinition
+	if err := json.Unmarshal([]byte(definition), &def); err != nil {
+		return def, fmt.Errorf("rule %s: %w: %v", name, ErrInvalidRuleFile, err)
+	}
+	// the column is authoritative, so renaming a row renames the rule
+	def.Name = name
+	return def, nil
+}
+
+// Put adds the definition, or replaces the one of the same name.
+func (s *SQLStore) Put(ctx context.Context, def RuleDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	definition, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// update or insert rather than an upsert, which is written differently by every database. The existence is
+	// queried, as some databases, e.g. MySQL, report no affected rows when an update leaves the row unchanged.
+	var n int
+	if err := tx.QueryRowContext(ctx, s.query(`SELECT COUNT(*) FROM {table} WHERE name = ?`), def.Name).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		_, err = tx.ExecContext(ctx, s.query(`UPDATE {table} SET definition = ? WHERE name = ?`), string(definition), def.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, s.query(`INSERT INTO {table} (name, definition) VALUES (?, ?)`), def.Name, string(definition))
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes the rule named name.
+func (s *SQLStore) Delete(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE name = ?`), name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	return nil
+}
+
+// Watch returns a channel receiving the changes of the rules, including the ones made by other processes,
+// until ctx is done. The table is read every poll interval, see WithSQLPollInterval.
+func (s *SQLStore) Watch(ctx context.Context) (<-chan StoreEvent, error) {
+	return pollStore(ctx, s.pollInterval, s.List)
+}
@@ -0,0 +1,6 @@
+//go:build cgo
+
+package gorule
+
+// the sqlite3 driver is only registered if it can be built, so TestSQLStore is skipped otherwise
+import _ "github.com/mattn/go-sqlite3"
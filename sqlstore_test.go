@@ -0,0 +1,57 @@
+package gorule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLStore(t *testing.T) {
+	if !hasDriver("sqlite3") {
+		t.Skip("sqlite3 driver needs cgo")
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "rules.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewSQLStore(db, WithSQLTable("gorule_rules"), WithSQLPollInterval(10*time.Millisecond))
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	testRuleStore(t, store)
+
+	if _, err := db.Exec(`INSERT INTO gorule_rules (name, definition) VALUES ('broken', '{')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(context.Background(), "broken"); !errors.Is(err, ErrInvalidRuleFile) {
+		t.Errorf("Get() error = %v, want %v", err, ErrInvalidRuleFile)
+	}
+}
+
+func hasDriver(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSQLStore_Placeholder(t *testing.T) {
+	store := NewSQLStore(nil, WithSQLPlaceholder(DollarPlaceholder))
+	got := store.query(`UPDATE {table} SET definition = ? WHERE name = ?`)
+	if want := `UPDATE rules SET definition = $1 WHERE name = $2`; got != want {
+		t.Errorf("query() = %q, want %q", got, want)
+	}
+}
+
+func TestSQLStore_PollInterval(t *testing.T) {
+	if got := NewSQLStore(nil, WithSQLPollInterval(0)).pollInterval; got != 10*time.Second {
+		t.Errorf("pollInterval = %v, want the default", got)
+	}
+}
@@ -0,0 +1,270 @@
+package gorule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RuleStore keeps rule definitions, e.g. in a directory or a database, which engines can sync from, see WithStore.
+// Implementations have to be safe for concurrent use.
+type RuleStore interface {
+	// List returns the definitions of all rules ordered by name.
+	List(ctx context.Context) ([]RuleDefinition, error)
+	// Get returns the definition of the rule named name, or an error wrapping ErrRuleNotFound.
+	Get(ctx context.Context, name string) (RuleDefinition, error)
+	// Put adds the definition, or replaces the one of the same name.
+	Put(ctx context.Context, def RuleDefinition) error
+	// Delete removes the rule named name, or returns an error wrapping ErrRuleNotFound.
+	Delete(ctx context.Context, name string) error
+	// Watch returns a channel receiving the changes of the rules until ctx is done, when it is closed.
+	Watch(ctx context.Context) (<-chan StoreEvent, error)
+}
+
+// StoreEventKind tells whether a rule was put or deleted.
+type StoreEventKind string
+
+const (
+	StorePut    StoreEventKind = "put"
+	StoreDelete StoreEventKind = "delete"
+)
+
+// StoreEvent is a change of a rule of a RuleStore.
+type StoreEvent struct {
+	Kind StoreEventKind
+	Name string
+}
+
+// MemoryStore is a RuleStore keeping the rules in memory, e.g. for tests.
+type MemoryStore struct {
+	mu       sync.Mutex
+	rules    map[string]RuleDefinition
+	watchers map[chan StoreEvent]struct{}
+}
+
+// NewMemoryStore creates a store holding the definitions.
+func NewMemoryStore(defs ...RuleDefinition) *MemoryStore {
+	s := &MemoryStore{rules: make(map[string]RuleDefinition, len(defs)), watchers: make(map[chan StoreEvent]struct{})}
+	for _, def := range defs {
+		s.rules[def.Name] = def
+	}
+	return s
+}
+
+// List returns the definitions of all rules ordered by name.
+func (s *MemoryStore) List(ctx context.Context) ([]RuleDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defs := make([]RuleDefinition, 0, len(s.rules))
+	for _, def := range s.rules {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs, nil
+}
+
+// Get returns the definition of the rule named name.
+func (s *MemoryStore) Get(ctx context.Context, name string) (RuleDefinition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	def, ok := s.rules[name]
+	if !ok {
+		return RuleDefinition{}, fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	return def, nil
+}
+
+// Put adds the definition, or replaces the one of the same name.
+func (s *MemoryStore) Put(ctx context.Context, def RuleDefinition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules[def.Name] = def
+	s.notify(StoreEvent{Kind: StorePut, Name: def.Name})
+	return nil
+}
+
+// Delete removes the rule named name.
+func (s *MemoryStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	delete(s.rules, name)
+	s.notify(StoreEvent{Kind: StoreDelete, Name: name})
+	return nil
+}
+
+// Watch returns a channel receiving the changes of the rules until ctx is done.
+// Watchers not keeping up with the changes miss some of them.
+func (s *MemoryStore) Watch(ctx context.Context) (<-chan StoreEvent, error) {
+	ch := make(chan StoreEvent, 16)
+
+	s.mu.Lock()
+	s.watchers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		delete(s.watchers, ch)
+		close(ch)
+		s.mu.Unlock()
+	}()
+	return ch, nil
+}
+
+// notify sends the event to the watchers. The caller holds s.mu.
+func (s *MemoryStore) notify(event StoreEvent) {
+	for ch := range s.watchers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// pollStore implements Watch for stores which cannot notify about changes by listing the rules every interval
+// and comparing them to the previous list. Return error if interval is not positive.
+func pollStore(ctx context.Context, interval time.Duration, list func(ctx context.Context) ([]RuleDefinition, error)) (<-chan StoreEvent, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %v", interval)
+	}
+	defs, err := list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	previous := definitionsByName(defs)
+
+	ch := make(chan StoreEvent)
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			defs, err := list(ctx)
+			if err != nil {
+				// the store might be unavailable for a while, so it is tried again at the next tick
+				continue
+			}
+			current := definitionsByName(defs)
+			for _, event := range diffDefinitions(previous, current) {
+				select {
+				case ch <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			previous = current
+		}
+	}()
+	return ch, nil
+}
+
+func definitionsByName(defs []RuleDefinition) map[string]RuleDefinition {
+	m := make(map[string]RuleDefinition, len(defs))
+	for _, def := range defs {
+		m[def.Name] = def
+	}
+	return m
+}
+
+// diffDefinitions returns the events changing previous into current, ordered by name.
+func diffDefinitions(previous, current map[string]RuleDefinition) []StoreEvent {
+	var events []StoreEvent
+	for name, def := range current {
+		if old, ok := previous[name]; !ok || !reflect.DeepEqual(old, def) {
+			events = append(events, StoreEvent{Kind: StorePut, Name: name})
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			events = append(events, StoreEvent{Kind: StoreDelete, Name: name})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
+
+// WithStore syncs the rule set of the engine from store: NewEngine loads its rules, logging an error if it fails,
+// and the rules are reloaded as a new version whenever the store reports a change, until ctx is done.
+func WithStore(ctx context.Context, store RuleStore) Option {
+	return func(e *Engine) {
+		e.store = store
+		e.storeCtx = ctx
+	}
+}
+
+// startSync loads the rules of the store and watches it, see WithStore.
+func (e *Engine) startSync() {
+	ctx := e.storeCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	events, err := e.store.Watch(ctx)
+	if err != nil {
+		e.logger.Printf("Error: cannot watch rule store: %v", err)
+	}
+	if _, err := e.SyncStore(ctx); err != nil {
+		e.logger.Printf("Error: cannot load rules from store: %v", err)
+	}
+	if events == nil {
+		return
+	}
+
+	go func() {
+		for range events {
+			// drain the events queued meanwhile, as a single reload covers them all
+			for drained := false; !drained; {
+				select {
+				case _, ok := <-events:
+					drained = !ok
+				default:
+					drained = true
+				}
+			}
+			if _, err := e.SyncStore(ctx); err != nil {
+				e.logger.Printf("Error: cannot reload rules from store: %v", err)
+			}
+		}
+	}()
+}
+
+// SyncStore replaces the rules of the engine by the ones of the store set by WithStore, creating a new version,
+// and returns its number. Stores keep no experiments, so the experiments of the variant rules in the store have to be
+// added to the engine beforehand, see WithExperiments; otherwise an error is returned, leaving the rule set unchanged.
+func (e *Engine) SyncStore(ctx context.Context) (int, error) {
+	if e.store == nil {
+		return e.Version(), errors.New("engine has no rule store")
+	}
+
+	defs, err := e.store.List(ctx)
+	if err != nil {
+		return e.Version(), err
+	}
+	rules := make([]*Rule, 0, len(defs))
+	for _, def := range defs {
+		rules = append(rules, def.Rule())
+	}
+	return e.Reload(rules)
+}
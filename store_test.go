@@ -0,0 +1,157 @@
+package gorule
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testRuleStore checks the behavior every RuleStore has to have. The store has to be empty.
+func testRuleStore(t *testing.T, store RuleStore) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := store.Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	vip := RuleDefinition{Name: "vip/eu", Condition: "vipLevel > 5", Action: "balance * 0.3", Tags: []string{"region:eu"}}
+	adult := RuleDefinition{Name: "adult", Condition: "age >= 18"}
+	for _, def := range []RuleDefinition{vip, adult} {
+		if err := store.Put(ctx, def); err != nil {
+			t.Fatalf("Put(%s) error = %v", def.Name, err)
+		}
+	}
+	vip.Condition = "vipLevel > 6"
+	// putting the same definition twice replaces it by itself
+	for i := 0; i < 2; i++ {
+		if err := store.Put(ctx, vip); err != nil {
+			t.Fatalf("Put(%s) error = %v", vip.Name, err)
+		}
+	}
+	if err := store.Put(ctx, RuleDefinition{Name: "no condition"}); !errors.Is(err, ErrInvalidRuleFile) {
+		t.Errorf("Put() error = %v, want %v", err, ErrInvalidRuleFile)
+	}
+
+	got, err := store.Get(ctx, "vip/eu")
+	if err != nil || !reflect.DeepEqual(got, vip) {
+		t.Errorf("Get() = %+v, %v, want %+v", got, err, vip)
+	}
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Get() error = %v, want %v", err, ErrRuleNotFound)
+	}
+
+	defs, err := store.List(ctx)
+	if err != nil || !reflect.DeepEqual(defs, []RuleDefinition{adult, vip}) {
+		t.Errorf("List() = %+v, %v, want %+v", defs, err, []RuleDefinition{adult, vip})
+	}
+
+	if err := store.Delete(ctx, "adult"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err := store.Delete(ctx, "adult"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Delete() error = %v, want %v", err, ErrRuleNotFound)
+	}
+
+	// stores polling for changes might report only the difference between two polls
+	timeout := time.After(5 * time.Second)
+	for put := false; !put; {
+		select {
+		case event := <-events:
+			put = event == StoreEvent{Kind: StorePut, Name: "vip/eu"}
+		case <-timeout:
+			t.Fatalf("Watch() did not report vip/eu put")
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testRuleStore(t, NewMemoryStore())
+}
+
+func TestDirStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rules")
+	store, err := NewDirStore(dir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRuleStore(t, store)
+
+	if _, err := os.Stat(filepath.Join(dir, "vip%2Feu.json")); err != nil {
+		t.Errorf("rule file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"name": "broken"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.List(context.Background()); !errors.Is(err, ErrInvalidRuleFile) {
+		t.Errorf("List() error = %v, want %v", err, ErrInvalidRuleFile)
+	}
+
+	if _, err := NewDirStore(dir, 0); err == nil {
+		t.Errorf("NewDirStore() with poll interval 0 succeeded")
+	}
+	if _, err := (&DirStore{dir: dir}).Watch(context.Background()); err == nil {
+		t.Errorf("Watch() with poll interval 0 succeeded")
+	}
+}
+
+func TestEngine_WithStore(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore(RuleDefinition{Name: "adult", Condition: "age >= 18"})
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithStore(ctx, store))
+	if got := ruleNames(e.Rules()); !reflect.DeepEqual(got, []string{"adult"}) {
+		t.Fatalf("Rules() = %v, want [adult]", got)
+	}
+
+	if err := store.Put(ctx, RuleDefinition{Name: "vip", Condition: "vipLevel > 5"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(e.Rules()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Rules() = %v after Put, want [adult vip]", ruleNames(e.Rules()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v := e.Version(); v < 2 {
+		t.Errorf("Version() = %d, want the store changes as new versions", v)
+	}
+
+	if _, err := NewEngine().SyncStore(ctx); err == nil {
+		t.Errorf("SyncStore() without store succeeded")
+	}
+}
+
+func TestEngine_WithStore_Experiments(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewMemoryStore(RuleDefinition{Name: "generous", Condition: "true", Experiment: "discount", Variant: "treatment"})
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithStore(ctx, store))
+	if _, err := e.SyncStore(ctx); !errors.Is(err, ErrExperimentNotFound) {
+		t.Errorf("SyncStore() without experiment error = %v, want %v", err, ErrExperimentNotFound)
+	}
+
+	x := Experiment{Name: "discount", Key: "userId", Variants: []Variant{{Name: "treatment", Weight: 100}}}
+	e = NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithExperiments(x), WithStore(ctx, store))
+	matched, err := e.Match(map[string]interface{}{"userId": "u1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 1 || matched[0].Name() != "generous" {
+		t.Errorf("Match() = %v, want generous", matched)
+	}
+}
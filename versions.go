@@ -0,0 +1,245 @@
+package gorule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrVersionNotFound = errors.New("rule set version not found")
+
+// RuleSetVersion is an immutable snapshot of the rules of an engine. Every change of the rule set,
+// e.g. AddRule, DisableRule or a batch of changes applied by Update, creates a new version numbered
+// one more than the latest one. Engines only keep the versions to roll back to if created WithHistoryLimit.
+type RuleSetVersion struct {
+	Number      int
+	Created     time.Time
+	Description string // the changes creating the version, e.g. "add vip, remove blacklist"
+
+	rules map[string]*Rule // never changed once the version is created
+}
+
+// Rules returns the rules of the version ordered by name.
+func (v *RuleSetVersion) Rules() []*Rule {
+	return sortedRules(v.rules)
+}
+
+func sortedRules(m map[string]*Rule) []*Rule {
+	rules := make([]*Rule, 0, len(m))
+	for _, r := range m {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name() < rules[j].Name() })
+	return rules
+}
+
+// WithHistoryLimit keeps the latest n versions of the rule set to roll back to. By default, no versions are kept:
+// as each version holds the rules it consists of, every change of the rule set copies the rules while a history is kept.
+func WithHistoryLimit(n int) Option {
+	return func(e *Engine) {
+		e.maxVersions = n
+	}
+}
+
+// RuleSetUpdate collects the changes applied by Engine.Update.
+type RuleSetUpdate struct {
+	engine      *Engine
+	rules       map[string]*Rule
+	experiments map[string]*Experiment // replacing the ones of the engine if not nil
+	added       []*Rule
+	changes     []string
+}
+
+// AddRule adds rule, return error if rule name exists or if it is part of a variant the engine lacks, see WithVariant.
+func (u *RuleSetUpdate) AddRule(rule *Rule) error {
+	if _, ok := u.rules[rule.Name()]; ok {
+		return fmt.Errorf("%w: %s", ErrRuleExists, rule.Name())
+	}
+	if err := checkVariant(u.experimentsOrEngine(), rule); err != nil {
+		return err
+	}
+	u.put(rule)
+	u.changes = append(u.changes, "add "+rule.Name())
+	return nil
+}
+
+// ReplaceRule adds rule or replaces the rule of the same name.
+func (u *RuleSetUpdate) ReplaceRule(rule *Rule) {
+	if _, ok := u.rules[rule.Name()]; ok {
+		u.changes = append(u.changes, "replace "+rule.Name())
+	} else {
+		u.changes = append(u.changes, "add "+rule.Name())
+	}
+	u.put(rule)
+}
+
+// RemoveRule removes the rule named name, return error if there is no such rule.
+func (u *RuleSetUpdate) RemoveRule(name string) error {
+	if _, ok := u.rules[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	delete(u.rules, name)
+	u.changes = append(u.changes, "remove "+name)
+	return nil
+}
+
+// Rules returns the rules including the changes made so far, ordered by name.
+func (u *RuleSetUpdate) Rules() []*Rule {
+	return sortedRules(u.rules)
+}
+
+func (u *RuleSetUpdate) experimentsOrEngine() map[string]*Experiment {
+	if u.experiments != nil {
+		return u.experiments
+	}
+	return u.engine.experiments
+}
+
+// checkVariants returns an error if a rule added, or any rule if the experiments are replaced,
+// is part of a variant the experiments lack.
+func (u *RuleSetUpdate) checkVariants() error {
+	rules := u.added
+	if u.experiments != nil {
+		rules = sortedRules(u.rules)
+	}
+	for _, r := range rules {
+		if u.rules[r.Name()] != r {
+			continue // replaced or removed meanwhile
+		}
+		if err := checkVariant(u.experimentsOrEngine(), r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *RuleSetUpdate) put(rule *Rule) {
+	u.engine.compile(rule)
+	u.rules[rule.Name()] = rule
+	u.added = append(u.added, rule)
+}
+
+// Update applies the changes fn makes as a whole, creating a single new version of the rule set,
+// and returns its number. If fn returns an error, or a rule is part of a variant the engine lacks, see WithVariant,
+// the rule set is left unchanged.
+// Match never sees a part of the changes. fn must not call methods of the engine.
+func (e *Engine) Update(fn func(u *RuleSetUpdate) error) (int, error) {
+	return e.update(fn, false)
+}
+
+// update works like Update. If fn only fails before making any changes, inPlace allows to change the rules of
+// the engine directly instead of a copy, unless they are kept as a version, so that single changes do not copy the rules.
+func (e *Engine) update(fn func(u *RuleSetUpdate) error, inPlace bool) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	u := &RuleSetUpdate{engine: e, rules: e.rules}
+	if !inPlace || e.maxVersions > 0 {
+		u.rules = make(map[string]*Rule, len(e.rules)+1)
+		for name, r := range e.rules {
+			u.rules[name] = r
+		}
+	}
+	if err := fn(u); err != nil {
+		return e.version, err
+	}
+	if len(u.changes) == 0 {
+		return e.version, nil
+	}
+	if err := u.checkVariants(); err != nil {
+		return e.version, err
+	}
+	if u.experiments != nil {
+		e.experiments = u.experiments
+	}
+
+	if e.coverage != nil {
+		for _, r := range u.added {
+			e.coverage.add(r)
+		}
+	}
+	return e.commit(u.rules, strings.Join(u.changes, ", ")), nil
+}
+
+// Reload replaces all rules of the engine by rules, creating a single new version of the rule set, and returns its number.
+// Return error if two rules have the same name, leaving the rule set unchanged.
+func (e *Engine) Reload(rules []*Rule) (int, error) {
+	return e.Update(func(u *RuleSetUpdate) error {
+		u.rules = make(map[string]*Rule, len(rules))
+		for _, r := range rules {
+			if err := u.AddRule(r); err != nil {
+				return err
+			}
+		}
+		u.changes = []string{"reload"}
+		return nil
+	})
+}
+
+// commit makes rules the current rule set as a new version. The caller holds e.mu.
+func (e *Engine) commit(rules map[string]*Rule, description string) int {
+	number := e.version + 1
+	if n := len(e.history); n > 0 && e.history[n-1].Number >= number {
+		// the current version was rolled back to
+		number = e.history[n-1].Number + 1
+	}
+
+	e.rules = rules
+	e.version = number
+	if e.maxVersions <= 0 {
+		return number
+	}
+	e.history = append(e.history, &RuleSetVersion{Number: number, Created: e.now(), Description: description, rules: rules})
+	if len(e.history) > e.maxVersions {
+		e.history = append([]*RuleSetVersion(nil), e.history[len(e.history)-e.maxVersions:]...)
+	}
+	return number
+}
+
+// Version returns the number of the current version of the rule set, which is 0 until the rule set is changed.
+func (e *Engine) Version() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.version
+}
+
+// Versions returns the versions of the rule set kept, oldest first, see WithHistoryLimit.
+func (e *Engine) Versions() []*RuleSetVersion {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*RuleSetVersion(nil), e.history...)
+}
+
+// Rollback makes the version numbered number the current rule set again. Match sees either the rule set
+// before or after the rollback, never a mix. The versions after it are kept, so it is possible to roll forward,
+// and the next change creates a version numbered one more than the latest one.
+// History is opt-in: versions are only kept by engines created WithHistoryLimit, so Rollback always returns
+// an error otherwise. Return error if the version is not kept.
+func (e *Engine) Rollback(number int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.maxVersions <= 0 {
+		return fmt.Errorf("%w: %d, as the engine keeps no history, see WithHistoryLimit", ErrVersionNotFound, number)
+	}
+
+	for _, v := range e.history {
+		if v.Number != number {
+			continue
+		}
+		e.rules = v.rules
+		e.version = v.Number
+		if e.coverage != nil {
+			for _, r := range v.rules {
+				e.coverage.add(r)
+			}
+		}
+		e.logger.Printf("Info: rolled back rule set to version %d", number)
+		return nil
+	}
+	return fmt.Errorf("%w: %d", ErrVersionNotFound, number)
+}
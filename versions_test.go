@@ -0,0 +1,174 @@
+package gorule
+
+import (
+	"errors"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ruleNames(rules []*Rule) []string {
+	names := make([]string, 0, len(rules))
+	for _, r := range rules {
+		names = append(names, r.Name())
+	}
+	return names
+}
+
+func TestEngine_Versions(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithHistoryLimit(10))
+	if got := e.Version(); got != 0 {
+		t.Fatalf("Version() = %d, want 0", got)
+	}
+
+	if err := e.AddRule(NewRule("adult", "age >= 18", nil)); err != nil {
+		t.Fatal(err)
+	}
+	v, err := e.Update(func(u *RuleSetUpdate) error {
+		u.ReplaceRule(NewRule("adult", "age >= 21", nil))
+		return u.AddRule(NewRule("vip", "vipLevel > 5", nil))
+	})
+	if err != nil || v != 2 {
+		t.Fatalf("Update() = %d, %v, want 2", v, err)
+	}
+	if err := e.DisableRule("vip"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := e.Update(func(u *RuleSetUpdate) error {
+		u.ReplaceRule(NewRule("minor", "age < 18", nil))
+		return u.RemoveRule("missing")
+	}); !errors.Is(err, ErrRuleNotFound) || v != 3 {
+		t.Fatalf("Update() = %d, %v, want 3, %v", v, err, ErrRuleNotFound)
+	}
+
+	var got []string
+	for _, v := range e.Versions() {
+		got = append(got, v.Description)
+	}
+	want := []string{"add adult", "replace adult, add vip", "disable vip"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Versions() = %v, want %v", got, want)
+	}
+	if got := ruleNames(e.Versions()[0].Rules()); !reflect.DeepEqual(got, []string{"adult"}) {
+		t.Errorf("Versions()[0].Rules() = %v, want [adult]", got)
+	}
+	if !e.Versions()[1].Rules()[1].Enabled() {
+		t.Errorf("disabling vip changed version 2")
+	}
+}
+
+func TestEngine_Rollback(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithHistoryLimit(10))
+	if _, err := e.Reload([]*Rule{NewRule("adult", "age >= 18", nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Reload([]*Rule{NewRule("adult", "age >= 21", nil)}); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]interface{}{"age": 20}
+
+	res, err := e.Run(vars, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != 2 || len(res.Rules) != 0 {
+		t.Errorf("Run() = version %d, %d rules, want version 2, 0 rules", res.Version, len(res.Rules))
+	}
+
+	if err := e.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	res, err = e.Run(vars, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != 1 || len(res.Rules) != 1 {
+		t.Errorf("Run() after Rollback(1) = version %d, %d rules, want version 1, 1 rule", res.Version, len(res.Rules))
+	}
+
+	if err := e.Rollback(5); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Rollback(5) error = %v, want %v", err, ErrVersionNotFound)
+	}
+
+	if err := e.AddRule(NewRule("vip", "vipLevel > 5", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Version(); got != 3 {
+		t.Errorf("Version() after change = %d, want 3", got)
+	}
+	if got := ruleNames(e.Rules()); !reflect.DeepEqual(got, []string{"adult", "vip"}) {
+		t.Errorf("Rules() = %v, want [adult vip]", got)
+	}
+	if cond := e.Rules()[0].condition; cond != "age >= 18" {
+		t.Errorf("change after rollback is based on %q, want the rolled back version", cond)
+	}
+}
+
+func TestEngine_NoHistory(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	for _, r := range []*Rule{NewRule("adult", "age >= 18", nil), NewRule("vip", "vipLevel > 5", nil)} {
+		if err := e.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.AddRule(NewRule("vip", "true", nil)); !errors.Is(err, ErrRuleExists) {
+		t.Errorf("AddRule() error = %v, want %v", err, ErrRuleExists)
+	}
+	if err := e.DisableRule("vip"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.RemoveRule("adult"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := e.Version(); got != 4 {
+		t.Errorf("Version() = %d, want 4", got)
+	}
+	if got := e.Versions(); len(got) != 0 {
+		t.Errorf("Versions() = %v, want none", got)
+	}
+	if got := e.Rules(); len(got) != 1 || got[0].Name() != "vip" || got[0].Enabled() {
+		t.Errorf("Rules() = %v, want disabled vip", ruleNames(got))
+	}
+	if err := e.Rollback(3); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Rollback(3) error = %v, want %v", err, ErrVersionNotFound)
+	}
+}
+
+func TestEngine_ReloadDuplicate(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)), WithHistoryLimit(2))
+	for i := 0; i < 3; i++ {
+		if _, err := e.Reload([]*Rule{NewRule("adult", "age >= 18", nil)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := e.Reload([]*Rule{NewRule("a", "true", nil), NewRule("a", "false", nil)}); !errors.Is(err, ErrRuleExists) || v != 3 {
+		t.Errorf("Reload() = %d, %v, want 3, %v", v, err, ErrRuleExists)
+	}
+
+	var got []int
+	for _, v := range e.Versions() {
+		got = append(got, v.Number)
+	}
+	if !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("Versions() = %v, want [2 3]", got)
+	}
+	if err := e.Rollback(1); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Rollback(1) error = %v, want %v", err, ErrVersionNotFound)
+	}
+}
+
+func TestEngine_Rollback_NoHistory(t *testing.T) {
+	e := NewEngine(WithLogger(log.New(io.Discard, "", 0)))
+	if err := e.AddRule(NewRule("adult", "age >= 18", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Rollback(1); !errors.Is(err, ErrVersionNotFound) || !strings.Contains(err.Error(), "WithHistoryLimit") {
+		t.Errorf("Rollback(1) error = %v, want %v mentioning WithHistoryLimit", err, ErrVersionNotFound)
+	}
+	if v := e.Versions(); len(v) != 0 {
+		t.Errorf("Versions() = %v, want none", v)
+	}
+}